@@ -8,13 +8,15 @@ import (
 	"github.com/cago-frame/cago/configs"
 	cache2 "github.com/cago-frame/cago/database/cache/cache"
 	"github.com/cago-frame/cago/database/cache/memory"
+	"github.com/cago-frame/cago/database/cache/multilevel"
 	"github.com/cago-frame/cago/database/cache/redis"
 	redis2 "github.com/redis/go-redis/v9"
 )
 
 const (
-	Redis  Type = "redis"
-	Memory Type = "memory"
+	Redis      Type = "redis"
+	Memory     Type = "memory"
+	Multilevel Type = "multilevel"
 )
 
 type Type string
@@ -24,6 +26,15 @@ type Config struct {
 	Addr     string
 	Password string //nolint:gosec // G117
 	DB       int
+	// Codec 序列化方式: json(默认)、msgpack、gob、protobuf
+	Codec string `yaml:"codec"`
+	// Compression 压缩方式: gzip、zstd，序列化后的数据超过 CompressThreshold 字节时才会压缩
+	Compression       string `yaml:"compression"`
+	CompressThreshold int    `yaml:"compressThreshold"`
+	// Memory 内存缓存配置，可以限制大小并设置淘汰策略，仅在 Type 为 memory 时生效
+	Memory memory.Config `yaml:"memory"`
+	// Multilevel 多级缓存配置，本地缓存在前，redis在后，仅在 Type 为 multilevel 时生效
+	Multilevel multilevel.Config `yaml:"multilevel"`
 }
 
 var defaultCache cache2.Cache
@@ -55,6 +66,37 @@ func (c *cache) CloseHandle() {
 }
 
 func NewWithConfig(ctx context.Context, cfg *Config, opts ...cache2.Option) (cache2.Cache, error) {
+	if cfg.Codec != "" {
+		codec, err := cache2.CodecByName(cfg.Codec)
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]cache2.Option{cache2.WithCodec(codec)}, opts...)
+	}
+	if cfg.Compression != "" {
+		compressor, err := cache2.CompressorByName(cfg.Compression)
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]cache2.Option{cache2.WithCompression(compressor, cfg.CompressThreshold)}, opts...)
+	}
+	c, err := newCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts) > 0 {
+		c = cache2.NewOptionCache(c, opts...)
+	}
+	// 链路追踪与指标
+	w, err := newWrap()
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return newWrapCache(c, w), nil
+}
+
+func newCache(cfg *Config) (cache2.Cache, error) {
 	switch cfg.Type {
 	case Redis:
 		return redis.NewRedisCache(&redis2.Options{
@@ -63,7 +105,26 @@ func NewWithConfig(ctx context.Context, cfg *Config, opts ...cache2.Option) (cac
 			DB:       cfg.DB,
 		})
 	case Memory:
-		return memory.NewMemoryCache()
+		c, err := memory.NewMemoryCache(memory.WithConfig(&cfg.Memory))
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case Multilevel:
+		client, err := redis.NewClient(&redis2.Options{
+			Addr:     cfg.Addr,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		})
+		if err != nil {
+			return nil, err
+		}
+		c, err := multilevel.NewMultilevelCache(client, multilevel.WithConfig(&cfg.Multilevel))
+		if err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+		return c, nil
 	default:
 		return nil, errors.New("not support cache type")
 	}
@@ -15,6 +15,16 @@ type Cache interface {
 	Get(ctx context.Context, key string, opts ...Option) Value
 	Has(ctx context.Context, key string) (bool, error)
 	Del(ctx context.Context, key string) error
+	// MGet 批量获取，返回的结果与keys一一对应，不存在的key返回 ErrNil
+	MGet(ctx context.Context, keys []string, opts ...Option) []Value
+	// MSet 批量设置
+	MSet(ctx context.Context, values map[string]interface{}, opts ...Option) error
+	// MDel 批量删除
+	MDel(ctx context.Context, keys ...string) error
+	// DelByPrefix 删除以prefix开头的所有key
+	DelByPrefix(ctx context.Context, prefix string) error
+	// InvalidateTags 删除带有这些标签的所有key，标签通过 WithTags 设置
+	InvalidateTags(ctx context.Context, tags ...string) error
 	Close() error
 }
 
@@ -74,6 +84,101 @@ func (p *prefixCache) Del(ctx context.Context, key string) error {
 	return p.Cache.Del(ctx, p.prefix+key)
 }
 
+func (p *prefixCache) MGet(ctx context.Context, keys []string, opts ...Option) []Value {
+	prefixKeys := make([]string, len(keys))
+	for i, key := range keys {
+		prefixKeys[i] = p.key(key)
+	}
+	return p.Cache.MGet(ctx, prefixKeys, opts...)
+}
+
+func (p *prefixCache) MSet(ctx context.Context, values map[string]interface{}, opts ...Option) error {
+	prefixValues := make(map[string]interface{}, len(values))
+	for key, val := range values {
+		prefixValues[p.key(key)] = val
+	}
+	return p.Cache.MSet(ctx, prefixValues, opts...)
+}
+
+func (p *prefixCache) MDel(ctx context.Context, keys ...string) error {
+	prefixKeys := make([]string, len(keys))
+	for i, key := range keys {
+		prefixKeys[i] = p.key(key)
+	}
+	return p.Cache.MDel(ctx, prefixKeys...)
+}
+
+// DelByPrefix 删除前缀下以prefix开头的所有key，prefix为空时删除该前缀下的所有key
+func (p *prefixCache) DelByPrefix(ctx context.Context, prefix string) error {
+	return p.Cache.DelByPrefix(ctx, p.key(prefix))
+}
+
+// InvalidateTags 标签是全局的，不会添加前缀
+func (p *prefixCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return p.Cache.InvalidateTags(ctx, tags...)
+}
+
 func (p *prefixCache) Close() error {
 	return p.Cache.Close()
 }
+
+// optionCache 为每次调用添加默认选项
+type optionCache struct {
+	Cache Cache
+	opts  []Option
+}
+
+// NewOptionCache 为缓存设置默认选项，每次调用时传入的选项会追加在默认选项后面
+//
+//	cache.NewOptionCache(c, cache.WithCodec(cache.Msgpack), cache.WithCompression(cache.Zstd, 1024))
+func NewOptionCache(cache Cache, opts ...Option) Cache {
+	return &optionCache{Cache: cache, opts: opts}
+}
+
+func (o *optionCache) with(opts []Option) []Option {
+	return append(append(make([]Option, 0, len(o.opts)+len(opts)), o.opts...), opts...)
+}
+
+func (o *optionCache) GetOrSet(ctx context.Context, key string, set func() (interface{}, error), opts ...Option) Value {
+	return o.Cache.GetOrSet(ctx, key, set, o.with(opts)...)
+}
+
+func (o *optionCache) Set(ctx context.Context, key string, val interface{}, opts ...Option) Value {
+	return o.Cache.Set(ctx, key, val, o.with(opts)...)
+}
+
+func (o *optionCache) Get(ctx context.Context, key string, opts ...Option) Value {
+	return o.Cache.Get(ctx, key, o.with(opts)...)
+}
+
+func (o *optionCache) Has(ctx context.Context, key string) (bool, error) {
+	return o.Cache.Has(ctx, key)
+}
+
+func (o *optionCache) Del(ctx context.Context, key string) error {
+	return o.Cache.Del(ctx, key)
+}
+
+func (o *optionCache) MGet(ctx context.Context, keys []string, opts ...Option) []Value {
+	return o.Cache.MGet(ctx, keys, o.with(opts)...)
+}
+
+func (o *optionCache) MSet(ctx context.Context, values map[string]interface{}, opts ...Option) error {
+	return o.Cache.MSet(ctx, values, o.with(opts)...)
+}
+
+func (o *optionCache) MDel(ctx context.Context, keys ...string) error {
+	return o.Cache.MDel(ctx, keys...)
+}
+
+func (o *optionCache) DelByPrefix(ctx context.Context, prefix string) error {
+	return o.Cache.DelByPrefix(ctx, prefix)
+}
+
+func (o *optionCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return o.Cache.InvalidateTags(ctx, tags...)
+}
+
+func (o *optionCache) Close() error {
+	return o.Cache.Close()
+}
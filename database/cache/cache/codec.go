@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cago-frame/cago/pkg/utils/protoutils"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec 缓存值的序列化方式
+type Codec interface {
+	// ID 唯一标识，会写入缓存数据中，读取时根据它选择解码方式，不能修改
+	ID() byte
+	// Name 名称，用于配置文件
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Compressor 缓存值的压缩方式
+type Compressor interface {
+	// ID 唯一标识，会写入缓存数据中，读取时根据它选择解压方式，不能修改，0表示不压缩
+	ID() byte
+	// Name 名称，用于配置文件
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	JSON     Codec = jsonCodec{}
+	Gob      Codec = gobCodec{}
+	Msgpack  Codec = msgpackCodec{}
+	Protobuf Codec = protobufCodec{}
+
+	Gzip Compressor = gzipCompressor{}
+	Zstd Compressor = &zstdCompressor{}
+)
+
+var (
+	codecLock   sync.RWMutex
+	codecs      = map[byte]Codec{}
+	compressors = map[byte]Compressor{}
+)
+
+func init() {
+	for _, c := range []Codec{JSON, Gob, Msgpack, Protobuf} {
+		RegisterCodec(c)
+	}
+	for _, c := range []Compressor{Gzip, Zstd} {
+		RegisterCompressor(c)
+	}
+}
+
+// RegisterCodec 注册序列化方式，注册后才能读取使用该方式写入的数据
+func RegisterCodec(c Codec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[c.ID()] = c
+}
+
+// RegisterCompressor 注册压缩方式，注册后才能读取使用该方式写入的数据
+func RegisterCompressor(c Compressor) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	compressors[c.ID()] = c
+}
+
+// CodecByName 根据名称获取序列化方式
+func CodecByName(name string) (Codec, error) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("cache: unknown codec %q", name)
+}
+
+// CompressorByName 根据名称获取压缩方式
+func CompressorByName(name string) (Compressor, error) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	for _, c := range compressors {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("cache: unknown compressor %q", name)
+}
+
+func codecByID(id byte) (Codec, error) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	if c, ok := codecs[id]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("cache: unknown codec id %d", id)
+}
+
+func compressorByID(id byte) (Compressor, error) {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	if c, ok := compressors[id]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("cache: unknown compressor id %d", id)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte     { return 1 }
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ID() byte     { return 2 }
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte     { return 3 }
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// protobufCodec 值必须实现 proto.Message，读取时也支持传入指向 proto.Message 指针的指针
+type protobufCodec struct{}
+
+func (protobufCodec) ID() byte     { return 4 }
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := protoutils.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cache: protobuf codec: %w", err)
+	}
+	return data, nil
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	if err := protoutils.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("cache: protobuf codec: %w", err)
+	}
+	return nil
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) ID() byte     { return 1 }
+func (gzipCompressor) Name() string { return "gzip" }
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //nolint:errcheck
+	return io.ReadAll(r)
+}
+
+type zstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (*zstdCompressor) ID() byte     { return 2 }
+func (*zstdCompressor) Name() string { return "zstd" }
+
+func (z *zstdCompressor) init() error {
+	z.once.Do(func() {
+		z.encoder, z.err = zstd.NewWriter(nil)
+		if z.err != nil {
+			return
+		}
+		z.decoder, z.err = zstd.NewReader(nil)
+	})
+	return z.err
+}
+
+func (z *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.encoder.EncodeAll(data, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	if err := z.init(); err != nil {
+		return nil, err
+	}
+	return z.decoder.DecodeAll(data, nil)
+}
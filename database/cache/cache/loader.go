@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/gogo"
+	"github.com/cago-frame/cago/pkg/logger"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// Loader GetOrSet 的通用实现，各缓存后端嵌入后使用
+// 同一个key的并发加载会合并为一次，并支持分布式锁、提前刷新、过期后返回旧数据和缓存未找到的结果
+type Loader struct {
+	group      singleflight.Group
+	refreshing sync.Map
+}
+
+// loadEntry 使用了 WithEarlyRefresh、WithStale、WithNotFound 时实际存储的数据
+type loadEntry struct {
+	// Data 使用 Marshal 序列化后的数据，带有序列化方式
+	Data []byte `json:"data,omitempty"`
+	// Expire 逻辑过期时间(毫秒)，为0时不过期
+	Expire int64 `json:"expire,omitempty"`
+	// Delta 加载数据的耗时(微秒)，用于计算提前刷新的概率，至少为1，毫秒级以下的加载也能提前刷新
+	Delta    int64 `json:"delta,omitempty"`
+	NotFound bool  `json:"not_found,omitempty"`
+}
+
+func useEntry(options *Options) bool {
+	return options.EarlyRefresh > 0 || options.Stale > 0 || options.NotFoundTTL > 0
+}
+
+func (e *loadEntry) expired(now time.Time) bool {
+	return e.Expire > 0 && now.UnixMilli() >= e.Expire
+}
+
+// shouldEarlyRefresh 按 XFetch 算法计算是否需要提前刷新
+func (e *loadEntry) shouldEarlyRefresh(now time.Time, beta float64) bool {
+	if beta <= 0 || e.Expire == 0 {
+		return false
+	}
+	gap := -float64(e.Delta) * beta * math.Log(1-rand.Float64())
+	return float64(now.UnixMicro())+gap >= float64(e.Expire)*1000
+}
+
+func (e *loadEntry) value(ctx context.Context, options *Options) Value {
+	if e.NotFound {
+		return NewValue(ctx, "", options, options.NotFoundErr)
+	}
+	// 依赖在读取 loadEntry 时已经校验过了
+	return NewValue(ctx, string(e.Data), &Options{Expiration: options.Expiration}, nil)
+}
+
+// LoadStat GetOrSet 的命中统计，使用 WithLoadStat 放入ctx后由 Loader 记录
+// 返回缓存中的数据(包括过期后返回的旧数据与提前刷新)为命中，需要加载(包括等待其它调用加载)为未命中，
+// 后台刷新不会记录
+type LoadStat struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (s *LoadStat) Hits() int64 {
+	return s.hits.Load()
+}
+
+func (s *LoadStat) Misses() int64 {
+	return s.misses.Load()
+}
+
+type loadStatKey struct{}
+
+// WithLoadStat 在ctx中带上命中统计
+func WithLoadStat(ctx context.Context, stat *LoadStat) context.Context {
+	return context.WithValue(ctx, loadStatKey{}, stat)
+}
+
+func recordLoad(ctx context.Context, hit bool) {
+	stat, ok := ctx.Value(loadStatKey{}).(*LoadStat)
+	if !ok {
+		return
+	}
+	if hit {
+		stat.hits.Add(1)
+	} else {
+		stat.misses.Add(1)
+	}
+}
+
+func (l *Loader) GetOrSet(ctx context.Context, c Cache, key string, set func() (interface{}, error), opts ...Option) Value {
+	options := NewOptions(opts...)
+	if !useEntry(options) {
+		ret := c.Get(ctx, key, opts...)
+		// 先检查依赖，依赖失效时直接加载，命中情况在返回前就能确定
+		if err := checkValue(ret); err != nil {
+			recordLoad(ctx, false)
+			return l.load(ctx, c, key, set, opts)
+		}
+		recordLoad(ctx, true)
+		if val, ok := ret.(*value); ok {
+			// 依赖已经校验过了，读取时不再重复校验
+			return val.withoutDepend()
+		}
+		return &GetOrSetValue{Value: ret, Set: func() Value {
+			return l.load(ctx, c, key, set, opts)
+		}}
+	}
+	entry := &loadEntry{}
+	if err := c.Get(ctx, key, opts...).Scan(entry); err != nil {
+		recordLoad(ctx, false)
+		return l.load(ctx, c, key, set, opts)
+	}
+	now := time.Now()
+	if entry.expired(now) {
+		if options.Stale <= 0 {
+			recordLoad(ctx, false)
+			return l.load(ctx, c, key, set, opts)
+		}
+		l.refresh(ctx, c, key, set, opts)
+	} else if entry.shouldEarlyRefresh(now, options.EarlyRefresh) {
+		l.refresh(ctx, c, key, set, opts)
+	}
+	recordLoad(ctx, true)
+	return entry.value(ctx, options)
+}
+
+// refresh 在后台刷新数据，同一个key同时只会有一个刷新
+func (l *Loader) refresh(ctx context.Context, c Cache, key string, set func() (interface{}, error), opts []Option) {
+	if _, ok := l.refreshing.LoadOrStore(key, struct{}{}); ok {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	gogo.Go(func() error {
+		defer l.refreshing.Delete(key)
+		if err := l.load(ctx, c, key, set, opts).Err(); err != nil {
+			logger.Ctx(ctx).Warn("cache refresh error", zap.String("key", key), zap.Error(err))
+		}
+		return nil
+	}, gogo.WithIgnorePanic())
+}
+
+// load 加载数据并写入缓存，同一个key的并发加载会合并为一次
+// 合并后的加载由所有等待的调用共享，不受发起调用的ctx取消影响，避免其它调用一起失败；
+// 每个调用仍然只等待到自己的ctx取消或者超时
+func (l *Loader) load(ctx context.Context, c Cache, key string, set func() (interface{}, error), opts []Option) Value {
+	ch := l.group.DoChan(key, func() (ret interface{}, err error) {
+		loadCtx := context.WithoutCancel(ctx)
+		// DoChan 会在另外的协程中重新panic，转换为错误返回给等待的调用
+		defer func() {
+			if r := recover(); r != nil {
+				ret = NewValue(loadCtx, "", NewOptions(opts...), fmt.Errorf("cache: load panic: %v", r))
+			}
+		}()
+		return l.doLoad(loadCtx, c, key, set, opts), nil
+	})
+	select {
+	case ret := <-ch:
+		return ret.Val.(Value)
+	case <-ctx.Done():
+		return NewValue(ctx, "", NewOptions(opts...), ctx.Err())
+	}
+}
+
+func (l *Loader) doLoad(ctx context.Context, c Cache, key string, set func() (interface{}, error), opts []Option) Value {
+	options := NewOptions(opts...)
+	if options.Locker != nil {
+		if err := options.Locker.LockKey(ctx, key); err != nil {
+			return NewValue(ctx, "", options, err)
+		}
+		defer func() {
+			_ = options.Locker.UnlockKey(ctx, key)
+		}()
+		// 获取到锁后，其它实例可能已经加载完成
+		if ret, ok := l.fresh(ctx, c, key, options, opts); ok {
+			return ret
+		}
+	}
+	start := time.Now()
+	val, err := set()
+	if !useEntry(options) {
+		if err != nil {
+			return NewValue(ctx, "", options, err)
+		}
+		return c.Set(ctx, key, val, opts...)
+	}
+	entry := &loadEntry{Delta: max(time.Since(start).Microseconds(), 1)}
+	expiration := options.Expiration
+	if err != nil {
+		if options.NotFoundTTL <= 0 || options.NotFoundErr == nil || !errors.Is(err, options.NotFoundErr) {
+			return NewValue(ctx, "", options, err)
+		}
+		entry.NotFound = true
+		expiration = options.NotFoundTTL
+	} else {
+		data, err := Marshal(ctx, val, &Options{Codec: options.Codec})
+		if err != nil {
+			return NewValue(ctx, "", options, err)
+		}
+		entry.Data = data
+		if expiration > 0 {
+			entry.Expire = start.Add(expiration).UnixMilli()
+			// 过期后还需要保留 stale 时间用于返回旧数据
+			expiration += options.Stale
+		}
+	}
+	// loadEntry 本身固定使用JSON序列化，数据已经按照设置的方式序列化过了
+	setOpts := append(append(make([]Option, 0, len(opts)+2), opts...), Expiration(expiration), WithCodec(JSON))
+	if err := c.Set(ctx, key, entry, setOpts...).Err(); err != nil {
+		return NewValue(ctx, "", options, err)
+	}
+	return entry.value(ctx, options)
+}
+
+// fresh 检查缓存中是否已经有未过期的数据
+func (l *Loader) fresh(ctx context.Context, c Cache, key string, options *Options, opts []Option) (Value, bool) {
+	ret := c.Get(ctx, key, opts...)
+	if !useEntry(options) {
+		if err := checkValue(ret); err != nil {
+			return nil, false
+		}
+		return ret, true
+	}
+	entry := &loadEntry{}
+	if err := ret.Scan(entry); err != nil || entry.expired(time.Now()) {
+		return nil, false
+	}
+	return entry.value(ctx, options), true
+}
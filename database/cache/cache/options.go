@@ -2,6 +2,8 @@ package cache
 
 import (
 	"time"
+
+	"github.com/cago-frame/cago/pkg/sync"
 )
 
 type Option func(*Options)
@@ -9,6 +11,18 @@ type Option func(*Options)
 type Options struct {
 	Expiration time.Duration
 	Depend     Depend
+	Tags       []string
+	// Codec 序列化方式，默认为JSON
+	Codec Codec
+	// Compressor 压缩方式，数据大小超过 CompressThreshold 时才会压缩
+	Compressor        Compressor
+	CompressThreshold int
+	// 以下选项仅在 GetOrSet 中生效
+	Locker       sync.Locker
+	EarlyRefresh float64
+	Stale        time.Duration
+	NotFoundTTL  time.Duration
+	NotFoundErr  error
 }
 
 func NewOptions(opts ...Option) *Options {
@@ -30,3 +44,60 @@ func WithDepend(depend Depend) Option {
 		options.Depend = depend
 	}
 }
+
+// WithTags 设置key的标签，可以通过 InvalidateTags 删除带有某个标签的所有key
+//
+//	cache.Set(ctx, "user:list:1", list, cache.WithTags("user:1"))
+//	cache.InvalidateTags(ctx, "user:1")
+func WithTags(tags ...string) Option {
+	return func(options *Options) {
+		options.Tags = append(options.Tags, tags...)
+	}
+}
+
+// WithCodec 设置序列化方式，读取时会自动识别数据的序列化方式，不需要设置
+func WithCodec(codec Codec) Option {
+	return func(options *Options) {
+		options.Codec = codec
+	}
+}
+
+// WithCompression 设置压缩方式，序列化后的数据大小超过 threshold 字节时才会压缩，读取时会自动识别
+func WithCompression(compressor Compressor, threshold int) Option {
+	return func(options *Options) {
+		options.Compressor = compressor
+		options.CompressThreshold = threshold
+	}
+}
+
+// WithLocker GetOrSet 加载数据时使用分布式锁，保证多个实例之间同一个key同时只有一个在加载
+func WithLocker(locker sync.Locker) Option {
+	return func(options *Options) {
+		options.Locker = locker
+	}
+}
+
+// WithEarlyRefresh GetOrSet 在过期之前按概率提前在后台刷新数据，避免过期时大量请求同时加载
+// beta 越大越倾向于提前刷新，一般设置为1
+func WithEarlyRefresh(beta float64) Option {
+	return func(options *Options) {
+		options.EarlyRefresh = beta
+	}
+}
+
+// WithStale GetOrSet 在数据过期后的 stale 时间内，返回旧数据并在后台刷新
+func WithStale(stale time.Duration) Option {
+	return func(options *Options) {
+		options.Stale = stale
+	}
+}
+
+// WithNotFound GetOrSet 加载数据返回的错误为 err 时，缓存这个结果 ttl 时间，期间直接返回 err
+//
+//	cache.WithNotFound(time.Minute, gorm.ErrRecordNotFound)
+func WithNotFound(ttl time.Duration, err error) Option {
+	return func(options *Options) {
+		options.NotFoundTTL = ttl
+		options.NotFoundErr = err
+	}
+}
@@ -2,8 +2,10 @@ package cache
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 )
 
@@ -76,13 +78,62 @@ func (v *value) Scan(data interface{}) error {
 	return Unmarshal(v.ctx, []byte(v.data), data, v.options)
 }
 
+// check 检查数据是否存在以及依赖是否有效，不会反序列化数据
+func (v *value) check() error {
+	if v.err != nil {
+		return v.err
+	}
+	if v.options.Depend == nil {
+		return nil
+	}
+	data := []byte(v.data)
+	if len(data) > 0 && data[0] == formatMagic {
+		_, _, err := decodeFormat(v.ctx, data, v.options)
+		return err
+	}
+	var raw json.RawMessage
+	return Unmarshal(v.ctx, data, &raw, v.options)
+}
+
+// withoutDepend 依赖校验通过后，返回读取时不再校验依赖的值
+func (v *value) withoutDepend() Value {
+	if v.options.Depend == nil {
+		return v
+	}
+	options := *v.options
+	options.Depend = &NilDep{}
+	return &value{ctx: v.ctx, data: v.data, err: v.err, options: &options}
+}
+
+// checkValue 检查缓存值是否有效
+func checkValue(v Value) error {
+	if val, ok := v.(*value); ok {
+		return val.check()
+	}
+	return v.Err()
+}
+
 // 带依赖的缓存数据
 type dependStore struct {
 	Depend interface{} `json:"depend"`
 	Data   interface{} `json:"data"`
 }
 
+// 缓存数据格式，为了兼容旧数据，使用默认的JSON序列化且不压缩时直接存储JSON
+// 否则存储为: magic(1) | version(1) | codec(1) | compressor(1) | flags(1) | body
+// body 可能被压缩，有依赖时为: uvarint(依赖长度) | 依赖(JSON) | 数据，否则为数据
+// JSON 不会以 0x00 开头，以此区分两种格式
+const (
+	formatMagic      byte = 0x00
+	formatVersion    byte = 1
+	formatHeaderSize      = 5
+	flagDepend       byte = 1 << 0
+)
+
 func Unmarshal(ctx context.Context, data []byte, v interface{}, options *Options) error {
+	if len(data) > 0 && data[0] == formatMagic {
+		return unmarshalFormat(ctx, data, v, options)
+	}
 	// 反序列化时,如果有依赖,带上依赖
 	if options.Depend != nil {
 		newV := reflect.New(reflect.TypeOf(v).Elem())
@@ -109,7 +160,74 @@ func Unmarshal(ctx context.Context, data []byte, v interface{}, options *Options
 	}
 }
 
+func unmarshalFormat(ctx context.Context, data []byte, v interface{}, options *Options) error {
+	codec, body, err := decodeFormat(ctx, data, options)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(body, v)
+}
+
+// decodeFormat 解析数据头，解压并校验依赖，返回序列化方式和数据
+func decodeFormat(ctx context.Context, data []byte, options *Options) (Codec, []byte, error) {
+	if len(data) < formatHeaderSize {
+		return nil, nil, errors.New("cache: invalid data")
+	}
+	if data[1] != formatVersion {
+		return nil, nil, fmt.Errorf("cache: unsupported format version %d", data[1])
+	}
+	codec, err := codecByID(data[2])
+	if err != nil {
+		return nil, nil, err
+	}
+	flags := data[4]
+	body := data[formatHeaderSize:]
+	if data[3] != 0 {
+		compressor, err := compressorByID(data[3])
+		if err != nil {
+			return nil, nil, err
+		}
+		if body, err = compressor.Decompress(body); err != nil {
+			return nil, nil, err
+		}
+	}
+	var depend []byte
+	if flags&flagDepend != 0 {
+		n, l := binary.Uvarint(body)
+		if l <= 0 || uint64(len(body)-l) < n {
+			return nil, nil, errors.New("cache: invalid depend data")
+		}
+		depend = body[l : l+int(n)]
+		body = body[l+int(n):]
+	}
+	if options.Depend != nil {
+		if flags&flagDepend == 0 {
+			return nil, nil, ErrDependNotValid
+		}
+		dependValue, err := options.Depend.ValInterface()
+		if err != nil {
+			return nil, nil, err
+		}
+		if dependValue != nil {
+			if err := json.Unmarshal(depend, dependValue); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := options.Depend.Valid(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	return codec, body, nil
+}
+
 func Marshal(ctx context.Context, data interface{}, options *Options) ([]byte, error) {
+	codec := options.Codec
+	if codec == nil {
+		codec = JSON
+	}
+	if codec.ID() != JSON.ID() || options.Compressor != nil {
+		return marshalFormat(ctx, codec, data, options)
+	}
 	if options.Depend != nil {
 		val, err := options.Depend.Val(ctx)
 		if err != nil {
@@ -126,6 +244,38 @@ func Marshal(ctx context.Context, data interface{}, options *Options) ([]byte, e
 	}
 }
 
+func marshalFormat(ctx context.Context, codec Codec, data interface{}, options *Options) ([]byte, error) {
+	payload, err := codec.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var flags byte
+	body := payload
+	if options.Depend != nil {
+		val, err := options.Depend.Val(ctx)
+		if err != nil {
+			return nil, err
+		}
+		depend, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		flags |= flagDepend
+		body = binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(depend)+len(payload)), uint64(len(depend)))
+		body = append(append(body, depend...), payload...)
+	}
+	var compressorID byte
+	if c := options.Compressor; c != nil && len(body) >= options.CompressThreshold {
+		if body, err = c.Compress(body); err != nil {
+			return nil, err
+		}
+		compressorID = c.ID()
+	}
+	ret := make([]byte, 0, formatHeaderSize+len(body))
+	ret = append(ret, formatMagic, formatVersion, codec.ID(), compressorID, flags)
+	return append(ret, body...), nil
+}
+
 type GetOrSetValue struct {
 	Value
 	Set func() Value
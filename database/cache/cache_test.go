@@ -2,11 +2,21 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	cache2 "github.com/cago-frame/cago/database/cache/cache"
 	"github.com/cago-frame/cago/database/cache/memory"
+	"github.com/cago-frame/cago/database/cache/redis"
+	redis2 "github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestDepend(t *testing.T) {
@@ -83,3 +93,275 @@ func TestCache(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("test"), resultByte)
 }
+
+func TestGetOrSet(t *testing.T) {
+	c, _ := memory.NewMemoryCache()
+	ctx := context.Background()
+
+	// 并发加载合并为一次
+	var calls atomic.Int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := c.GetOrSet(ctx, "singleflight", func() (interface{}, error) {
+				calls.Add(1)
+				time.Sleep(50 * time.Millisecond)
+				return 1, nil
+			}).Int64()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), result)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), calls.Load())
+
+	// 调用方的ctx取消时不再等待，合并的加载继续执行并写入缓存
+	release := make(chan struct{})
+	cancelCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.GetOrSet(cancelCtx, "cancel", func() (interface{}, error) {
+			<-release
+			return 1, nil
+		}).Err()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("GetOrSet did not return after ctx was canceled")
+	}
+	close(release)
+	assert.Eventually(t, func() bool {
+		result, err := c.Get(ctx, "cancel").Int64()
+		return err == nil && result == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// 加载时panic返回错误
+	assert.ErrorContains(t, c.GetOrSet(ctx, "panic", func() (interface{}, error) {
+		panic("boom")
+	}).Err(), "boom")
+
+	// 缓存未找到的结果
+	errNotFound := errors.New("not found")
+	calls.Store(0)
+	for i := 0; i < 3; i++ {
+		err := c.GetOrSet(ctx, "not_found", func() (interface{}, error) {
+			calls.Add(1)
+			return nil, errNotFound
+		}, WithNotFound(time.Minute, errNotFound)).Err()
+		assert.ErrorIs(t, err, errNotFound)
+	}
+	assert.Equal(t, int64(1), calls.Load())
+	// 其它错误不缓存
+	calls.Store(0)
+	for i := 0; i < 2; i++ {
+		err := c.GetOrSet(ctx, "other_err", func() (interface{}, error) {
+			calls.Add(1)
+			return nil, errors.New("other")
+		}, WithNotFound(time.Minute, errNotFound)).Err()
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int64(2), calls.Load())
+
+	// 过期后返回旧数据并在后台刷新
+	var version atomic.Int64
+	load := func() (interface{}, error) {
+		return version.Add(1), nil
+	}
+	result, err := c.GetOrSet(ctx, "stale", load, Expiration(50*time.Millisecond), WithStale(time.Minute)).Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+	time.Sleep(60 * time.Millisecond)
+	result, err = c.GetOrSet(ctx, "stale", load, Expiration(50*time.Millisecond), WithStale(time.Minute)).Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+	assert.Eventually(t, func() bool {
+		result, err := c.GetOrSet(ctx, "stale", load, Expiration(50*time.Millisecond), WithStale(time.Minute)).Int64()
+		return err == nil && result == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// 毫秒级以下的加载也会提前刷新
+	version.Store(0)
+	result, err = c.GetOrSet(ctx, "early", load, Expiration(time.Minute), WithEarlyRefresh(1e9)).Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+	assert.Eventually(t, func() bool {
+		result, err := c.GetOrSet(ctx, "early", load, Expiration(time.Minute), WithEarlyRefresh(1e9)).Int64()
+		return err == nil && result > 1
+	}, time.Second, 10*time.Millisecond)
+
+	// 带依赖
+	dep := cache2.NewKeyDepend(c, "entry:dep")
+	result, err = c.GetOrSet(ctx, "entry", load, WithStale(time.Minute), WithDepend(dep)).Int64()
+	assert.NoError(t, err)
+	_ = dep.InvalidKey(ctx)
+	newResult, err := c.GetOrSet(ctx, "entry", load, WithStale(time.Minute),
+		WithDepend(cache2.NewKeyDepend(c, "entry:dep"))).Int64()
+	assert.NoError(t, err)
+	assert.NotEqual(t, result, newResult)
+}
+
+func TestBatch(t *testing.T) {
+	m := miniredis.RunT(t)
+	redisCache, err := redis.NewRedisCache(&redis2.Options{Addr: m.Addr()})
+	require.NoError(t, err)
+	memoryCache, _ := memory.NewMemoryCache()
+	for name, c := range map[string]cache2.Cache{
+		"memory": memoryCache,
+		"redis":  redisCache,
+		"prefix": cache2.NewPrefixCache("prefix:", memoryCache),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			assert.NoError(t, c.MSet(ctx, map[string]interface{}{
+				"user:1": 1,
+				"user:2": 2,
+			}))
+			values := c.MGet(ctx, []string{"user:1", "user:3", "user:2"})
+			result, err := values[0].Int64()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), result)
+			assert.True(t, IsNil(values[1].Err()))
+			result, err = values[2].Int64()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), result)
+
+			assert.NoError(t, c.MDel(ctx, "user:1", "user:2"))
+			ok, _ := c.Has(ctx, "user:1")
+			assert.False(t, ok)
+
+			// 前缀删除
+			assert.NoError(t, c.MSet(ctx, map[string]interface{}{
+				"list:1":  1,
+				"list:2":  2,
+				"other:1": 1,
+			}))
+			assert.NoError(t, c.DelByPrefix(ctx, "list:"))
+			ok, _ = c.Has(ctx, "list:1")
+			assert.False(t, ok)
+			ok, _ = c.Has(ctx, "other:1")
+			assert.True(t, ok)
+
+			// 标签
+			assert.NoError(t, c.Set(ctx, "article:1", 1, WithTags("user:1")).Err())
+			assert.NoError(t, c.MSet(ctx, map[string]interface{}{
+				"article:list:1": 1,
+			}, WithTags("user:1", "article")))
+			assert.NoError(t, c.Set(ctx, "article:2", 1, WithTags("user:2")).Err())
+			assert.NoError(t, c.InvalidateTags(ctx, "user:1"))
+			ok, _ = c.Has(ctx, "article:1")
+			assert.False(t, ok)
+			ok, _ = c.Has(ctx, "article:list:1")
+			assert.False(t, ok)
+			ok, _ = c.Has(ctx, "article:2")
+			assert.True(t, ok)
+		})
+	}
+}
+
+type typedUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+func TestTyped(t *testing.T) {
+	c, _ := memory.NewMemoryCache()
+	ctx := context.Background()
+	userCache := NewTyped[*typedUser](cache2.NewPrefixCache("typed:", c),
+		WithKeyBuilder(KeyFormat("user:%d")), WithOptions(Expiration(time.Minute)))
+	assert.Equal(t, "user:1", userCache.Key(1))
+
+	_, err := userCache.Get(ctx, userCache.Key(1))
+	assert.True(t, IsNil(err))
+	user, err := userCache.GetOrSet(ctx, userCache.Key(1), func() (*typedUser, error) {
+		return &typedUser{ID: 1, Username: "admin"}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", user.Username)
+	user, err = userCache.Get(ctx, userCache.Key(1))
+	assert.NoError(t, err)
+	assert.Equal(t, &typedUser{ID: 1, Username: "admin"}, user)
+	ok, _ := c.Has(ctx, "typed:user:1")
+	assert.True(t, ok)
+
+	// 加载错误
+	_, err = userCache.GetOrSet(ctx, userCache.Key(2), func() (*typedUser, error) {
+		return nil, errors.New("load error")
+	})
+	assert.EqualError(t, err, "load error")
+
+	assert.NoError(t, userCache.Set(ctx, userCache.Key(2), &typedUser{ID: 2}))
+	users, err := userCache.MGet(ctx, []string{userCache.Key(1), userCache.Key(2), userCache.Key(3)})
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, int64(2), users["user:2"].ID)
+
+	// 默认使用 Default()
+	prev := Default()
+	t.Cleanup(func() {
+		SetDefault(prev)
+	})
+	SetDefault(c)
+	count := NewTyped[int64](nil)
+	assert.Equal(t, "count:1", count.Key("count", 1))
+	assert.NoError(t, count.Set(ctx, count.Key("count", 1), 10))
+	result, err := count.Get(ctx, count.Key("count", 1))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), result)
+}
+
+func TestCodec(t *testing.T) {
+	c, _ := memory.NewMemoryCache()
+	ctx := context.Background()
+	user := &typedUser{ID: 1, Username: strings.Repeat("admin", 100)}
+	for _, codec := range []cache2.Codec{JSON, Msgpack, Gob} {
+		for _, compressor := range []cache2.Compressor{nil, Gzip, Zstd} {
+			opts := []cache2.Option{WithCodec(codec)}
+			if compressor != nil {
+				opts = append(opts, WithCompression(compressor, 100))
+			}
+			assert.NoError(t, c.Set(ctx, "codec", user, opts...).Err())
+			// 读取时不需要指定序列化方式
+			result := &typedUser{}
+			assert.NoError(t, c.Get(ctx, "codec").Scan(result))
+			assert.Equal(t, user, result)
+
+			// 带依赖
+			dep := cache2.NewKeyDepend(c, "codec:dep")
+			assert.NoError(t, c.Set(ctx, "codec", user, append(opts, WithDepend(dep))...).Err())
+			result = &typedUser{}
+			assert.NoError(t, c.Get(ctx, "codec", WithDepend(cache2.NewKeyDepend(c, "codec:dep"))).Scan(result))
+			assert.Equal(t, user, result)
+			_ = dep.InvalidKey(ctx)
+			assert.ErrorIs(t, c.Get(ctx, "codec", WithDepend(cache2.NewKeyDepend(c, "codec:dep"))).Scan(result),
+				cache2.ErrDependNotValid)
+
+			// GetOrSet
+			result = &typedUser{}
+			assert.NoError(t, c.GetOrSet(ctx, "codec:getOrSet", func() (interface{}, error) {
+				return user, nil
+			}, append(opts, WithStale(time.Minute))...).Scan(result))
+			assert.Equal(t, user, result)
+			assert.NoError(t, c.Del(ctx, "codec:getOrSet"))
+		}
+	}
+
+	// 旧的JSON数据仍然可以读取
+	assert.NoError(t, c.Set(ctx, "legacy", user).Err())
+	result := &typedUser{}
+	assert.NoError(t, c.Get(ctx, "legacy", WithCodec(Msgpack)).Scan(result))
+	assert.Equal(t, user, result)
+
+	// protobuf
+	pc := cache2.NewOptionCache(c, WithCodec(Protobuf))
+	assert.NoError(t, pc.Set(ctx, "protobuf", wrapperspb.String("hello")).Err())
+	var msg *wrapperspb.StringValue
+	assert.NoError(t, pc.Get(ctx, "protobuf").Scan(&msg))
+	assert.Equal(t, "hello", msg.GetValue())
+	assert.Error(t, pc.Set(ctx, "protobuf", 1).Err())
+}
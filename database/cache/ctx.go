@@ -34,3 +34,23 @@ func (c *CtxCache) Has(key string) (bool, error) {
 func (c *CtxCache) Del(key string) error {
 	return c.Cache.Del(c.ctx, key)
 }
+
+func (c *CtxCache) MGet(keys []string, opts ...cache2.Option) []cache2.Value {
+	return c.Cache.MGet(c.ctx, keys, opts...)
+}
+
+func (c *CtxCache) MSet(values map[string]interface{}, opts ...cache2.Option) error {
+	return c.Cache.MSet(c.ctx, values, opts...)
+}
+
+func (c *CtxCache) MDel(keys ...string) error {
+	return c.Cache.MDel(c.ctx, keys...)
+}
+
+func (c *CtxCache) DelByPrefix(prefix string) error {
+	return c.Cache.DelByPrefix(c.ctx, prefix)
+}
+
+func (c *CtxCache) InvalidateTags(tags ...string) error {
+	return c.Cache.InvalidateTags(c.ctx, tags...)
+}
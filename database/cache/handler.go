@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cago-frame/cago"
+	"github.com/cago-frame/cago/pkg/opentelemetry/metric"
+	"github.com/cago-frame/cago/pkg/opentelemetry/trace"
+	"github.com/cago-frame/cago/pkg/utils/wrap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	metric2 "go.opentelemetry.io/otel/metric"
+	trace2 "go.opentelemetry.io/otel/trace"
+)
+
+const instrumName = "github.com/cago-frame/cago/database/cache"
+
+// keyPrefix 取key中第一个":"之前的部分作为指标的标签，避免完整的key导致标签过多
+func keyPrefix(key string) string {
+	if i := strings.Index(key, ":"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// argPrefix 获取中间件参数中key的前缀
+func argPrefix(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return keyPrefix(v)
+	case []string:
+		if len(v) > 0 {
+			return keyPrefix(v[0])
+		}
+	}
+	return ""
+}
+
+func newWrap() (*wrap.Wrap, error) {
+	w := wrap.New()
+	if tp := trace.Default(); tp != nil {
+		tracer := tp.Tracer(
+			instrumName,
+			trace2.WithInstrumentationVersion("semver:"+cago.Version()),
+		)
+		w.Wrap(func(ctx *wrap.Context) {
+			sctx, span := tracer.Start(ctx.Context, "Cache."+ctx.Name(),
+				trace2.WithAttributes(
+					attribute.String("cache.operation", ctx.Name()),
+					attribute.String("cache.key_prefix", argPrefix(ctx.Args(0))),
+				),
+				trace2.WithSpanKind(trace2.SpanKindClient),
+			)
+			defer span.End()
+			switch ctx.Name() {
+			case "Get", "GetOrSet", "Set", "Del", "Has":
+				span.SetAttributes(attribute.String("cache.key", ctx.Args(0).(string)))
+			}
+			ctx = ctx.WithContext(sctx)
+			ctx.Next()
+			result := ctx.Args(1).(*wrapResult)
+			if result.hits+result.misses > 0 {
+				span.SetAttributes(
+					attribute.Int("cache.hits", result.hits),
+					attribute.Int("cache.misses", result.misses),
+				)
+			}
+			if err := ctx.IsAbort(); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+		})
+	}
+	if mp := metric.Default(); mp != nil {
+		meter := mp.Meter(instrumName, metric2.WithInstrumentationVersion(cago.Version()))
+		requestTotal, err := meter.Int64Counter(
+			"cache_request_total", metric2.WithDescription("缓存请求数量"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		hitTotal, err := meter.Int64Counter(
+			"cache_hit_total", metric2.WithDescription("缓存命中数量"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		missTotal, err := meter.Int64Counter(
+			"cache_miss_total", metric2.WithDescription("缓存未命中数量"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		errorTotal, err := meter.Int64Counter(
+			"cache_error_total", metric2.WithDescription("缓存错误数量"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := meter.Float64Histogram(
+			"cache_request_duration", metric2.WithDescription("缓存请求耗时"), metric2.WithUnit("ms"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		w.Wrap(func(ctx *wrap.Context) {
+			ts := time.Now()
+			ctx.Next()
+			attr := metric2.WithAttributes(
+				attribute.String("operation", ctx.Name()),
+				attribute.String("prefix", argPrefix(ctx.Args(0))),
+			)
+			requestTotal.Add(ctx, 1, attr)
+			duration.Record(ctx, float64(time.Since(ts).Microseconds())/1000, attr)
+			result := ctx.Args(1).(*wrapResult)
+			if result.hits > 0 {
+				hitTotal.Add(ctx, int64(result.hits), attr)
+			}
+			if result.misses > 0 {
+				missTotal.Add(ctx, int64(result.misses), attr)
+			}
+			if ctx.IsAbort() != nil {
+				errorTotal.Add(ctx, 1, attr)
+			}
+		})
+	}
+	return w, nil
+}
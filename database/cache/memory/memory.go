@@ -2,53 +2,229 @@ package memory
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cago-frame/cago/database/cache/cache"
-	gocache "github.com/patrickmn/go-cache"
+	"github.com/cago-frame/cago/pkg/opentelemetry/metric"
+	"go.opentelemetry.io/otel/attribute"
+	metric2 "go.opentelemetry.io/otel/metric"
 )
 
-type memoryCache struct {
-	cache *gocache.Cache
+// Stats 内存缓存的统计数据
+type Stats struct {
+	Hits   int64
+	Misses int64
+	// Evictions 因为超出大小限制被淘汰的数量
+	Evictions int64
+	// Expirations 因为过期被移除的数量
+	Expirations int64
+	Entries     int64
+	Bytes       int64
 }
 
-func NewMemoryCache() (cache.Cache, error) {
-	c := gocache.New(5*time.Minute, 10*time.Minute)
-	return &memoryCache{
-		cache: c,
-	}, nil
+// Cache 内存缓存，设置了 MaxEntries 或 MaxBytes 后会按照淘汰策略淘汰数据
+type Cache struct {
+	options *Options
+	mu      sync.Mutex
+	items   map[string]*entry
+	// policy 未限制大小时为nil
+	policy       policy
+	stats        Stats
+	tags         *tagIndex
+	loader       cache.Loader
+	registration metric2.Registration
+	closeOnce    sync.Once
+	stop         chan struct{}
 }
 
-func (m *memoryCache) GetOrSet(ctx context.Context, key string, set func() (interface{}, error), opts ...cache.Option) cache.Value {
-	ret := m.Get(ctx, key, opts...)
-	if ret.Err() != nil {
-		val, err := set()
+func NewMemoryCache(opts ...Option) (*Cache, error) {
+	options := newOptions(opts...)
+	m := &Cache{
+		options: options,
+		items:   make(map[string]*entry),
+		tags:    newTagIndex(),
+		stop:    make(chan struct{}),
+	}
+	if options.maxEntries > 0 || options.maxBytes > 0 {
+		p, err := newPolicy(options.policy, options.maxEntries)
 		if err != nil {
-			return cache.NewValue(ctx, "", cache.NewOptions(opts...), err)
+			return nil, err
 		}
-		return m.Set(ctx, key, val, opts...)
+		m.policy = p
 	}
-	return &cache.GetOrSetValue{Value: ret, Set: func() cache.Value {
-		val, err := set()
-		if err != nil {
-			return cache.NewValue(ctx, "", cache.NewOptions(opts...), err)
+	if err := m.registerMetrics(); err != nil {
+		return nil, err
+	}
+	go m.janitor()
+	return m, nil
+}
+
+func (m *Cache) registerMetrics() error {
+	if metric.Default() == nil {
+		return nil
+	}
+	meter := metric.Default().Meter("github.com/cago-frame/cago/database/cache/memory")
+	requests, err := meter.Int64ObservableCounter("cache.memory.requests",
+		metric2.WithDescription("memory cache lookups by result"))
+	if err != nil {
+		return err
+	}
+	removals, err := meter.Int64ObservableCounter("cache.memory.removals",
+		metric2.WithDescription("memory cache entries removed by eviction or expiration"))
+	if err != nil {
+		return err
+	}
+	entries, err := meter.Int64ObservableGauge("cache.memory.entries",
+		metric2.WithDescription("memory cache entries"))
+	if err != nil {
+		return err
+	}
+	bytes, err := meter.Int64ObservableGauge("cache.memory.bytes",
+		metric2.WithDescription("memory cache size in bytes"), metric2.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	m.registration, err = meter.RegisterCallback(func(ctx context.Context, o metric2.Observer) error {
+		s := m.Stats()
+		o.ObserveInt64(requests, s.Hits, metric2.WithAttributes(attribute.String("result", "hit")))
+		o.ObserveInt64(requests, s.Misses, metric2.WithAttributes(attribute.String("result", "miss")))
+		o.ObserveInt64(removals, s.Evictions, metric2.WithAttributes(attribute.String("reason", "evicted")))
+		o.ObserveInt64(removals, s.Expirations, metric2.WithAttributes(attribute.String("reason", "expired")))
+		o.ObserveInt64(entries, s.Entries)
+		o.ObserveInt64(bytes, s.Bytes)
+		return nil
+	}, requests, removals, entries, bytes)
+	return err
+}
+
+// janitor 定时清理过期的数据
+func (m *Cache) janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.deleteExpired()
 		}
-		return m.Set(ctx, key, val, opts...)
-	}}
+	}
 }
 
-func (m *memoryCache) Set(ctx context.Context, key string, val interface{}, opts ...cache.Option) cache.Value {
-	options := cache.NewOptions(opts...)
-	ttl := time.Duration(0)
-	if options.Expiration > 0 {
-		ttl = options.Expiration
+func (m *Cache) deleteExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UnixNano()
+	for _, e := range m.items {
+		if e.expired(now) {
+			m.remove(e)
+			m.stats.Expirations++
+		}
+	}
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expireAt > 0 && now >= e.expireAt
+}
+
+// remove 移除数据，需要持有锁
+func (m *Cache) remove(e *entry) {
+	delete(m.items, e.key)
+	m.stats.Bytes -= e.size
+	if m.policy != nil {
+		m.policy.remove(e)
+	}
+	m.tags.delete(e.key)
+}
+
+// lookup 获取未过期的数据，过期的数据会被移除，需要持有锁
+func (m *Cache) lookup(key string) (*entry, bool) {
+	e, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	if e.expired(time.Now().UnixNano()) {
+		m.remove(e)
+		m.stats.Expirations++
+		return nil, false
+	}
+	return e, true
+}
+
+// set 写入数据并设置标签，标签与数据在同一把锁内更新
+func (m *Cache) set(key, value string, ttl time.Duration, tags []string) {
+	if ttl <= 0 {
+		ttl = m.options.defaultExpiration
+	}
+	expireAt := int64(0)
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl).UnixNano()
+	}
+	size := int64(len(key) + len(value))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 先设置标签，写入时可能立即被淘汰
+	m.tags.set(key, tags)
+	if e, ok := m.items[key]; ok {
+		m.stats.Bytes += size - e.size
+		e.value, e.size, e.expireAt = value, size, expireAt
+		if m.policy != nil {
+			m.policy.access(e)
+		}
+	} else {
+		// 先腾出空间再写入，否则新数据的访问次数最少，LFU下会被立即淘汰
+		m.evict(1, size)
+		e := &entry{key: key, value: value, size: size, expireAt: expireAt}
+		m.items[key] = e
+		m.stats.Bytes += size
+		if m.policy != nil {
+			m.policy.add(e)
+		}
+	}
+	// 单条数据超出 MaxBytes 时会被淘汰
+	m.evict(0, 0)
+}
+
+// evict 按淘汰策略淘汰数据，直到再写入 entries 条 bytes 字节的数据后不超出大小限制，需要持有锁
+func (m *Cache) evict(entries int, bytes int64) {
+	if m.policy == nil {
+		return
+	}
+	for (m.options.maxEntries > 0 && len(m.items)+entries > m.options.maxEntries) ||
+		(m.options.maxBytes > 0 && m.stats.Bytes+bytes > m.options.maxBytes) {
+		e := m.policy.evict()
+		if e == nil {
+			return
+		}
+		m.remove(e)
+		m.stats.Evictions++
+	}
+}
+
+func (m *Cache) delete(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if e, ok := m.items[key]; ok {
+			m.remove(e)
+		}
 	}
+}
+
+func (m *Cache) GetOrSet(ctx context.Context, key string, set func() (interface{}, error), opts ...cache.Option) cache.Value {
+	return m.loader.GetOrSet(ctx, m, key, set, opts...)
+}
+
+func (m *Cache) Set(ctx context.Context, key string, val interface{}, opts ...cache.Option) cache.Value {
+	options := cache.NewOptions(opts...)
 	data, err := cache.Marshal(ctx, val, options)
 	if err != nil {
 		return cache.NewValue(ctx, "", options, err)
 	}
 	s := string(data)
-	m.cache.Set(key, s, ttl)
+	m.set(key, s, options.Expiration, options.Tags)
 	if options.Depend != nil {
 		// 移除掉依赖
 		options.Depend = &cache.NilDep{}
@@ -56,25 +232,96 @@ func (m *memoryCache) Set(ctx context.Context, key string, val interface{}, opts
 	return cache.NewValue(ctx, s, options, err)
 }
 
-func (m *memoryCache) Get(ctx context.Context, key string, opts ...cache.Option) cache.Value {
-	data, ok := m.cache.Get(key)
+func (m *Cache) Get(ctx context.Context, key string, opts ...cache.Option) cache.Value {
 	options := cache.NewOptions(opts...)
+	m.mu.Lock()
+	e, ok := m.lookup(key)
 	if !ok {
+		m.stats.Misses++
+		m.mu.Unlock()
 		return cache.NewValue(ctx, "", options, cache.ErrNil)
 	}
-	return cache.NewValue(ctx, data.(string), options, nil)
+	m.stats.Hits++
+	if m.policy != nil {
+		m.policy.access(e)
+	}
+	value := e.value
+	m.mu.Unlock()
+	return cache.NewValue(ctx, value, options, nil)
 }
 
-func (m *memoryCache) Has(ctx context.Context, key string) (bool, error) {
-	_, ok := m.cache.Get(key)
+func (m *Cache) Has(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.lookup(key)
 	return ok, nil
 }
 
-func (m *memoryCache) Del(ctx context.Context, key string) error {
-	m.cache.Delete(key)
+func (m *Cache) Del(ctx context.Context, key string) error {
+	m.delete(key)
 	return nil
 }
 
-func (m *memoryCache) Close() error {
+func (m *Cache) MGet(ctx context.Context, keys []string, opts ...cache.Option) []cache.Value {
+	ret := make([]cache.Value, len(keys))
+	for i, key := range keys {
+		ret[i] = m.Get(ctx, key, opts...)
+	}
+	return ret
+}
+
+func (m *Cache) MSet(ctx context.Context, values map[string]interface{}, opts ...cache.Option) error {
+	for key, val := range values {
+		if err := m.Set(ctx, key, val, opts...).Err(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (m *Cache) MDel(ctx context.Context, keys ...string) error {
+	m.delete(keys...)
+	return nil
+}
+
+func (m *Cache) DelByPrefix(ctx context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, e := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(e)
+		}
+	}
+	return nil
+}
+
+func (m *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.tags.members(tags...) {
+		if e, ok := m.items[key]; ok {
+			m.remove(e)
+		}
+	}
+	return nil
+}
+
+// Stats 获取统计数据
+func (m *Cache) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stats
+	s.Entries = int64(len(m.items))
+	return s
+}
+
+func (m *Cache) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		if m.registration != nil {
+			err = m.registration.Unregister()
+		}
+	})
+	return err
+}
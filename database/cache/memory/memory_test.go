@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cago-frame/cago/database/cache/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func has(t *testing.T, c *Cache, key string) bool {
+	ok, err := c.Has(context.Background(), key)
+	require.NoError(t, err)
+	return ok
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewMemoryCache(WithMaxEntries(3), WithPolicy(LRU))
+	require.NoError(t, err)
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Set(ctx, key, key).Err())
+	}
+	// 访问a后，b为最久未访问的数据
+	require.NoError(t, c.Get(ctx, "a").Err())
+	require.NoError(t, c.Set(ctx, "d", "d").Err())
+	assert.True(t, has(t, c, "a"))
+	assert.False(t, has(t, c, "b"))
+	assert.True(t, has(t, c, "c"))
+	assert.True(t, has(t, c, "d"))
+
+	s := c.Stats()
+	assert.Equal(t, int64(1), s.Hits)
+	assert.Equal(t, int64(1), s.Evictions)
+	assert.Equal(t, int64(3), s.Entries)
+}
+
+func TestLFU(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewMemoryCache(WithMaxEntries(3), WithPolicy(LFU))
+	require.NoError(t, err)
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Set(ctx, key, key).Err())
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Get(ctx, "a").Err())
+		require.NoError(t, c.Get(ctx, "b").Err())
+	}
+	require.NoError(t, c.Get(ctx, "c").Err())
+	// 访问次数 a:4 b:4 c:2，淘汰c
+	require.NoError(t, c.Set(ctx, "d", "d").Err())
+	assert.True(t, has(t, c, "a"))
+	assert.True(t, has(t, c, "b"))
+	assert.False(t, has(t, c, "c"))
+	assert.True(t, has(t, c, "d"))
+	// 访问次数相同时淘汰最久未访问的，d:1 e:1
+	require.NoError(t, c.Set(ctx, "e", "e").Err())
+	assert.False(t, has(t, c, "d"))
+	assert.True(t, has(t, c, "e"))
+}
+
+func TestTinyLFU(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewMemoryCache(WithMaxEntries(100), WithPolicy(TinyLFU))
+	require.NoError(t, err)
+	defer c.Close()
+	// 热点数据
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("hot:%d", i)
+		require.NoError(t, c.Set(ctx, key, i).Err())
+		for j := 0; j < 5; j++ {
+			require.NoError(t, c.Get(ctx, key).Err())
+		}
+	}
+	// 大量只访问一次的数据不会把热点数据挤出去
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("scan:%d", i), i).Err())
+	}
+	hot := 0
+	for i := 0; i < 50; i++ {
+		if has(t, c, fmt.Sprintf("hot:%d", i)) {
+			hot++
+		}
+	}
+	assert.Greater(t, hot, 45)
+	s := c.Stats()
+	assert.Equal(t, int64(100), s.Entries)
+	assert.Equal(t, int64(950), s.Evictions)
+}
+
+func TestMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewMemoryCache(WithMaxBytes(100))
+	require.NoError(t, err)
+	defer c.Close()
+	for i := 0; i < 10; i++ {
+		// key 2字节，序列化后的值 18字节
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("k%d", i), "0123456789abcdef").Err())
+	}
+	s := c.Stats()
+	assert.Equal(t, int64(5), s.Entries)
+	assert.Equal(t, int64(100), s.Bytes)
+	assert.Equal(t, int64(5), s.Evictions)
+	assert.False(t, has(t, c, "k4"))
+	assert.True(t, has(t, c, "k5"))
+
+	// 删除后释放空间
+	require.NoError(t, c.Del(ctx, "k5"))
+	assert.Equal(t, int64(80), c.Stats().Bytes)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewMemoryCache(WithDefaultExpiration(time.Hour))
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.Set(ctx, "a", "a", cache.Expiration(10*time.Millisecond)).Err())
+	require.NoError(t, c.Set(ctx, "b", "b").Err())
+	time.Sleep(20 * time.Millisecond)
+	assert.ErrorIs(t, c.Get(ctx, "a").Err(), cache.ErrNil)
+	assert.True(t, has(t, c, "b"))
+	c.deleteExpired()
+	s := c.Stats()
+	assert.Equal(t, int64(1), s.Expirations)
+	assert.Equal(t, int64(1), s.Misses)
+	assert.Equal(t, int64(1), s.Entries)
+
+	_, err = NewMemoryCache(WithMaxEntries(1), WithPolicy("unknown"))
+	assert.Error(t, err)
+}
+
+func TestTags_Lock(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewMemoryCache()
+	require.NoError(t, err)
+	defer c.Close()
+	c.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, c.Set(ctx, "a", "a", cache.WithTags("tag")).Err())
+	}()
+	// 标签索引与数据在同一把锁内更新，拿不到锁时不会只写入标签
+	time.Sleep(20 * time.Millisecond)
+	assert.NotContains(t, c.tags.keys, "a")
+	c.mu.Unlock()
+	<-done
+	assert.True(t, has(t, c, "a"))
+	require.NoError(t, c.InvalidateTags(ctx, "tag"))
+	assert.False(t, has(t, c, "a"))
+}
@@ -0,0 +1,89 @@
+package memory
+
+import "time"
+
+// Policy 淘汰策略
+type Policy string
+
+const (
+	// LRU 淘汰最久未访问的数据
+	LRU Policy = "lru"
+	// LFU 淘汰访问次数最少的数据
+	LFU Policy = "lfu"
+	// TinyLFU W-TinyLFU，新数据先进入窗口区，只有比主区中的淘汰对象访问频率更高时才会进入主区
+	TinyLFU Policy = "tinylfu"
+)
+
+// Config 内存缓存配置，MaxEntries 与 MaxBytes 都为0时不限制大小
+type Config struct {
+	// MaxEntries 最大条目数
+	MaxEntries int `yaml:"maxEntries"`
+	// MaxBytes 最大字节数，按照key与序列化后的值的长度计算
+	MaxBytes int64 `yaml:"maxBytes"`
+	// Policy 淘汰策略，默认为lru
+	Policy Policy `yaml:"policy"`
+	// DefaultExpiration 未设置过期时间时的默认过期时间，默认为5分钟
+	DefaultExpiration time.Duration `yaml:"defaultExpiration"`
+}
+
+type Options struct {
+	maxEntries        int
+	maxBytes          int64
+	policy            Policy
+	defaultExpiration time.Duration
+}
+
+type Option func(*Options)
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		policy:            LRU,
+		defaultExpiration: 5 * time.Minute,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return options
+}
+
+// WithConfig 使用配置文件设置选项
+func WithConfig(cfg *Config) Option {
+	return func(options *Options) {
+		options.maxEntries = cfg.MaxEntries
+		options.maxBytes = cfg.MaxBytes
+		if cfg.Policy != "" {
+			options.policy = cfg.Policy
+		}
+		if cfg.DefaultExpiration > 0 {
+			options.defaultExpiration = cfg.DefaultExpiration
+		}
+	}
+}
+
+// WithMaxEntries 设置最大条目数
+func WithMaxEntries(n int) Option {
+	return func(options *Options) {
+		options.maxEntries = n
+	}
+}
+
+// WithMaxBytes 设置最大字节数
+func WithMaxBytes(n int64) Option {
+	return func(options *Options) {
+		options.maxBytes = n
+	}
+}
+
+// WithPolicy 设置淘汰策略
+func WithPolicy(policy Policy) Option {
+	return func(options *Options) {
+		options.policy = policy
+	}
+}
+
+// WithDefaultExpiration 设置默认过期时间，小于等于0时不过期
+func WithDefaultExpiration(d time.Duration) Option {
+	return func(options *Options) {
+		options.defaultExpiration = d
+	}
+}
@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+)
+
+// entry 有大小限制的内存缓存中的条目
+type entry struct {
+	key      string
+	value    string
+	size     int64
+	expireAt int64
+	// 淘汰策略使用的数据
+	elem      *list.Element
+	segment   segment
+	candidate bool
+	freq      int
+	tick      uint64
+	index     int
+}
+
+// policy 淘汰策略，调用方需要保证并发安全
+type policy interface {
+	add(e *entry)
+	access(e *entry)
+	remove(e *entry)
+	// evict 选择一个需要淘汰的条目
+	evict() *entry
+}
+
+func newPolicy(p Policy, maxEntries int) (policy, error) {
+	switch p {
+	case "", LRU:
+		return newLRU(), nil
+	case LFU:
+		return newLFU(), nil
+	case TinyLFU:
+		return newTinyLFU(maxEntries), nil
+	default:
+		return nil, fmt.Errorf("memory cache: unknown policy %q", p)
+	}
+}
+
+type lru struct {
+	list *list.List
+}
+
+func newLRU() *lru {
+	return &lru{list: list.New()}
+}
+
+func (l *lru) add(e *entry) {
+	e.elem = l.list.PushFront(e)
+}
+
+func (l *lru) access(e *entry) {
+	l.list.MoveToFront(e.elem)
+}
+
+func (l *lru) remove(e *entry) {
+	l.list.Remove(e.elem)
+}
+
+func (l *lru) evict() *entry {
+	if back := l.list.Back(); back != nil {
+		return back.Value.(*entry)
+	}
+	return nil
+}
+
+// lfu 访问次数相同时淘汰最久未访问的
+type lfu struct {
+	heap  lfuHeap
+	clock uint64
+}
+
+func newLFU() *lfu {
+	return &lfu{}
+}
+
+func (l *lfu) add(e *entry) {
+	l.clock++
+	e.freq = 1
+	e.tick = l.clock
+	heap.Push(&l.heap, e)
+}
+
+func (l *lfu) access(e *entry) {
+	l.clock++
+	e.freq++
+	e.tick = l.clock
+	heap.Fix(&l.heap, e.index)
+}
+
+func (l *lfu) remove(e *entry) {
+	heap.Remove(&l.heap, e.index)
+}
+
+func (l *lfu) evict() *entry {
+	if len(l.heap) == 0 {
+		return nil
+	}
+	return l.heap[0]
+}
+
+type lfuHeap []*entry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
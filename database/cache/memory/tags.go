@@ -0,0 +1,58 @@
+package memory
+
+// tagIndex 标签与key的索引，与数据一起由 Cache.mu 保护
+type tagIndex struct {
+	tags map[string]map[string]struct{}
+	keys map[string][]string
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		tags: make(map[string]map[string]struct{}),
+		keys: make(map[string][]string),
+	}
+}
+
+// set 设置key的标签，会覆盖之前的标签
+func (t *tagIndex) set(key string, tags []string) {
+	t.delete(key)
+	if len(tags) == 0 {
+		return
+	}
+	for _, tag := range tags {
+		keys, ok := t.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	t.keys[key] = tags
+}
+
+// delete key被删除或者过期时移除索引
+func (t *tagIndex) delete(key string) {
+	for _, tag := range t.keys[key] {
+		delete(t.tags[tag], key)
+		if len(t.tags[tag]) == 0 {
+			delete(t.tags, tag)
+		}
+	}
+	delete(t.keys, key)
+}
+
+// members 获取带有这些标签的所有key
+func (t *tagIndex) members(tags ...string) []string {
+	ret := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, tag := range tags {
+		for key := range t.tags[tag] {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			ret = append(ret, key)
+		}
+	}
+	return ret
+}
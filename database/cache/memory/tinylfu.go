@@ -0,0 +1,181 @@
+package memory
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+type segment uint8
+
+const (
+	segmentWindow segment = iota
+	segmentProbation
+	segmentProtected
+)
+
+// tinyLFU W-TinyLFU 淘汰策略
+// 新数据进入窗口区(约1%)，窗口区溢出的数据作为候选进入主区的试用区
+// 需要淘汰时，候选者与试用区中最久未访问的数据比较访问频率，频率低的被淘汰
+// 试用区中的数据再次被访问后进入保护区(主区的80%)
+type tinyLFU struct {
+	sketch    *countMinSketch
+	window    *list.List
+	probation *list.List
+	protected *list.List
+}
+
+func newTinyLFU(maxEntries int) *tinyLFU {
+	return &tinyLFU{
+		sketch:    newCountMinSketch(maxEntries),
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+	}
+}
+
+func (t *tinyLFU) list(s segment) *list.List {
+	switch s {
+	case segmentProbation:
+		return t.probation
+	case segmentProtected:
+		return t.protected
+	default:
+		return t.window
+	}
+}
+
+func (t *tinyLFU) move(e *entry, s segment) {
+	t.list(e.segment).Remove(e.elem)
+	e.segment = s
+	e.elem = t.list(s).PushFront(e)
+}
+
+func (t *tinyLFU) add(e *entry) {
+	t.sketch.increment(e.key)
+	e.segment = segmentWindow
+	e.elem = t.window.PushFront(e)
+	total := t.window.Len() + t.probation.Len() + t.protected.Len()
+	windowCap := total / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+	if t.window.Len() <= windowCap {
+		return
+	}
+	// 之前的候选者没有遇到淘汰，直接进入主区
+	if front := t.probation.Front(); front != nil {
+		front.Value.(*entry).candidate = false
+	}
+	overflow := t.window.Back().Value.(*entry)
+	t.move(overflow, segmentProbation)
+	overflow.candidate = true
+}
+
+func (t *tinyLFU) access(e *entry) {
+	t.sketch.increment(e.key)
+	switch e.segment {
+	case segmentWindow:
+		t.window.MoveToFront(e.elem)
+	case segmentProbation:
+		e.candidate = false
+		t.move(e, segmentProtected)
+		// 保护区超出主区的80%时，最久未访问的降级到试用区
+		if t.protected.Len() > (t.probation.Len()+t.protected.Len())*8/10 {
+			t.move(t.protected.Back().Value.(*entry), segmentProbation)
+		}
+	case segmentProtected:
+		t.protected.MoveToFront(e.elem)
+	}
+}
+
+func (t *tinyLFU) remove(e *entry) {
+	t.list(e.segment).Remove(e.elem)
+}
+
+func (t *tinyLFU) evict() *entry {
+	if front := t.probation.Front(); front != nil && front.Value.(*entry).candidate {
+		candidate := front.Value.(*entry)
+		var victim *entry
+		if back := t.probation.Back(); back != front {
+			victim = back.Value.(*entry)
+		} else if back := t.protected.Back(); back != nil {
+			victim = back.Value.(*entry)
+		}
+		if victim == nil {
+			return candidate
+		}
+		if t.sketch.estimate(candidate.key) > t.sketch.estimate(victim.key) {
+			candidate.candidate = false
+			return victim
+		}
+		return candidate
+	}
+	for _, l := range []*list.List{t.probation, t.protected, t.window} {
+		if back := l.Back(); back != nil {
+			return back.Value.(*entry)
+		}
+	}
+	return nil
+}
+
+// countMinSketch 估算key的访问频率，计数达到上限后会整体减半，使频率随时间衰减
+type countMinSketch struct {
+	seed      maphash.Seed
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(maxEntries int) *countMinSketch {
+	width := 1024
+	for width < maxEntries && width < 1<<24 {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(width - 1),
+		resetAt: width * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) indexes(key string) [4]uint64 {
+	h := maphash.String(s.seed, key)
+	lo, hi := h, h>>32|h<<32
+	var ret [4]uint64
+	for i := range ret {
+		ret[i] = (lo + uint64(i)*hi) & s.mask
+	}
+	return ret
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	min := uint8(255)
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < min {
+			min = s.rows[i][idx]
+		}
+	}
+	return min
+}
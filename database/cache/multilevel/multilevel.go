@@ -0,0 +1,437 @@
+package multilevel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cago-frame/cago/database/cache/cache"
+	redisCache "github.com/cago-frame/cago/database/cache/redis"
+	"github.com/cago-frame/cago/pkg/logger"
+	"github.com/cago-frame/cago/pkg/opentelemetry/metric"
+	"github.com/cago-frame/cago/pkg/utils"
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	metric2 "go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Stats 多级缓存的统计数据
+type Stats struct {
+	L1Hits        int64
+	L1Misses      int64
+	L2Hits        int64
+	L2Misses      int64
+	Invalidations int64
+}
+
+type stats struct {
+	l1Hits        atomic.Int64
+	l1Misses      atomic.Int64
+	l2Hits        atomic.Int64
+	l2Misses      atomic.Int64
+	invalidations atomic.Int64
+}
+
+// invalidation 失效通知的消息
+type invalidation struct {
+	Instance string   `json:"instance"`
+	Keys     []string `json:"keys,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// Cache 多级缓存，本地缓存(L1)在前，redis(L2)在后
+// Set/Del 时会通过 redis pub/sub 通知其它实例删除本地缓存
+type Cache struct {
+	options  *Options
+	instance string
+	l1       *gocache.Cache
+	redis    *redis.Client
+	pubsub   *redis.PubSub
+	stats    stats
+	cancel   context.CancelFunc
+	done     chan struct{}
+	loader   cache.Loader
+	// generation 本地缓存的代数，每次删除或写入本地缓存之前递增
+	// 从redis读取之后，代数发生了变化说明读取期间有过失效，读到的可能是旧数据，不写入本地缓存
+	generation atomic.Uint64
+	// registration 指标的回调，关闭时取消注册
+	registration metric2.Registration
+}
+
+// NewMultilevelCache 创建多级缓存，关闭缓存时会一并关闭传入的redis客户端
+func NewMultilevelCache(client *redis.Client, opts ...Option) (*Cache, error) {
+	options := newOptions(opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	pubsub := client.Subscribe(ctx, options.channel)
+	// 等待订阅成功
+	if _, err := pubsub.Receive(ctx); err != nil {
+		cancel()
+		_ = pubsub.Close()
+		return nil, err
+	}
+	c := &Cache{
+		options:  options,
+		instance: utils.RandString(16, utils.Mix),
+		l1:       gocache.New(options.l1TTL, 10*time.Minute),
+		redis:    client,
+		pubsub:   pubsub,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	if err := c.registerMetrics(); err != nil {
+		cancel()
+		_ = pubsub.Close()
+		return nil, err
+	}
+	go c.subscribe(ctx)
+	return c, nil
+}
+
+func (c *Cache) registerMetrics() error {
+	if metric.Default() == nil {
+		return nil
+	}
+	meter := metric.Default().Meter("github.com/cago-frame/cago/database/cache/multilevel")
+	counter, err := meter.Int64ObservableCounter("cache.multilevel.requests",
+		metric2.WithDescription("multilevel cache lookups by level and result"))
+	if err != nil {
+		return err
+	}
+	invalidations, err := meter.Int64ObservableCounter("cache.multilevel.invalidations",
+		metric2.WithDescription("local cache entries invalidated by other instances"))
+	if err != nil {
+		return err
+	}
+	c.registration, err = meter.RegisterCallback(func(ctx context.Context, o metric2.Observer) error {
+		s := c.Stats()
+		o.ObserveInt64(counter, s.L1Hits, metric2.WithAttributes(levelAttr("l1", "hit")...))
+		o.ObserveInt64(counter, s.L1Misses, metric2.WithAttributes(levelAttr("l1", "miss")...))
+		o.ObserveInt64(counter, s.L2Hits, metric2.WithAttributes(levelAttr("l2", "hit")...))
+		o.ObserveInt64(counter, s.L2Misses, metric2.WithAttributes(levelAttr("l2", "miss")...))
+		o.ObserveInt64(invalidations, s.Invalidations)
+		return nil
+	}, counter, invalidations)
+	return err
+}
+
+func levelAttr(level, result string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("level", level),
+		attribute.String("result", result),
+	}
+}
+
+func (c *Cache) subscribe(ctx context.Context) {
+	defer close(c.done)
+	ch := c.pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			inv := &invalidation{}
+			if err := json.Unmarshal([]byte(msg.Payload), inv); err != nil {
+				logger.Default().Error("multilevel cache invalidation unmarshal error",
+					zap.String("payload", msg.Payload), zap.Error(err))
+				continue
+			}
+			// 自己发出的通知在本地已经处理过了
+			if inv.Instance == c.instance {
+				continue
+			}
+			c.generation.Add(1)
+			for _, key := range inv.Keys {
+				c.l1.Delete(key)
+			}
+			for _, prefix := range inv.Prefixes {
+				c.delL1Prefix(prefix)
+			}
+			c.stats.invalidations.Add(int64(len(inv.Keys) + len(inv.Prefixes)))
+		}
+	}
+}
+
+// publish 通知其它实例删除本地缓存
+func (c *Cache) publish(ctx context.Context, keys ...string) error {
+	return c.publishInvalidation(ctx, &invalidation{Keys: keys})
+}
+
+func (c *Cache) publishInvalidation(ctx context.Context, inv *invalidation) error {
+	inv.Instance = c.instance
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return c.redis.Publish(ctx, c.options.channel, b).Err()
+}
+
+func (c *Cache) delL1Prefix(prefix string) {
+	for key := range c.l1.Items() {
+		if strings.HasPrefix(key, prefix) {
+			c.l1.Delete(key)
+		}
+	}
+}
+
+// l1TTL 获取key在本地缓存的过期时间，匹配最长的前缀
+func (c *Cache) l1TTL(key string, expiration time.Duration) time.Duration {
+	ttl := c.options.l1TTL
+	matched := -1
+	for prefix, v := range c.options.keyTTL {
+		if len(prefix) > matched && strings.HasPrefix(key, prefix) {
+			ttl = v
+			matched = len(prefix)
+		}
+	}
+	// 本地缓存不能比redis中的数据活得更久
+	if expiration > 0 && ttl > expiration {
+		ttl = expiration
+	}
+	return ttl
+}
+
+func (c *Cache) setL1(key, data string, expiration time.Duration) {
+	if ttl := c.l1TTL(key, expiration); ttl > 0 {
+		c.l1.Set(key, data, ttl)
+	}
+}
+
+// fillL1 将从redis读取的数据写入本地缓存，generation 为读取redis之前的代数
+func (c *Cache) fillL1(key, data string, expiration time.Duration, generation uint64) {
+	if c.generation.Load() != generation {
+		return
+	}
+	c.setL1(key, data, expiration)
+	// 写入的同时发生了失效，删除可能是旧数据的本地缓存，失效总是先递增代数再删除
+	if c.generation.Load() != generation {
+		c.l1.Delete(key)
+	}
+}
+
+func (c *Cache) GetOrSet(ctx context.Context, key string, set func() (interface{}, error), opts ...cache.Option) cache.Value {
+	return c.loader.GetOrSet(ctx, c, key, set, opts...)
+}
+
+func (c *Cache) Set(ctx context.Context, key string, val interface{}, opts ...cache.Option) cache.Value {
+	options := cache.NewOptions(opts...)
+	ttl := time.Duration(0)
+	if options.Expiration > 0 {
+		ttl = options.Expiration
+	}
+	data, err := cache.Marshal(ctx, val, options)
+	if err != nil {
+		return cache.NewValue(ctx, "", options, err)
+	}
+	s := string(data)
+	if err := c.redis.Set(ctx, key, s, ttl).Err(); err != nil {
+		return cache.NewValue(ctx, "", options, err)
+	}
+	if err := redisCache.AddTags(ctx, c.redis, key, options.Tags, ttl); err != nil {
+		return cache.NewValue(ctx, "", options, err)
+	}
+	c.generation.Add(1)
+	c.setL1(key, s, ttl)
+	if err := c.publish(ctx, key); err != nil {
+		return cache.NewValue(ctx, "", options, err)
+	}
+	if options.Depend != nil {
+		// 移除掉依赖
+		options.Depend = &cache.NilDep{}
+	}
+	return cache.NewValue(ctx, s, options, nil)
+}
+
+func (c *Cache) Get(ctx context.Context, key string, opts ...cache.Option) cache.Value {
+	options := cache.NewOptions(opts...)
+	if data, ok := c.l1.Get(key); ok {
+		c.stats.l1Hits.Add(1)
+		return cache.NewValue(ctx, data.(string), options, nil)
+	}
+	c.stats.l1Misses.Add(1)
+	generation := c.generation.Load()
+	// 同时取出剩余的过期时间，本地缓存不能比redis中的数据活得更久
+	pipe := c.redis.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return cache.NewValue(ctx, "", options, err)
+	}
+	data, err := get.Result()
+	if err != nil {
+		if err == redis.Nil {
+			c.stats.l2Misses.Add(1)
+			err = cache.ErrNil
+		}
+		return cache.NewValue(ctx, "", options, err)
+	}
+	c.stats.l2Hits.Add(1)
+	expiration := time.Duration(0)
+	if ttl := pttl.Val(); ttl > 0 {
+		expiration = ttl
+	}
+	c.fillL1(key, data, expiration, generation)
+	return cache.NewValue(ctx, data, options, nil)
+}
+
+func (c *Cache) Has(ctx context.Context, key string) (bool, error) {
+	if _, ok := c.l1.Get(key); ok {
+		return true, nil
+	}
+	ok, err := c.redis.Exists(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (c *Cache) Del(ctx context.Context, key string) error {
+	return c.MDel(ctx, key)
+}
+
+func (c *Cache) MGet(ctx context.Context, keys []string, opts ...cache.Option) []cache.Value {
+	options := cache.NewOptions(opts...)
+	ret := make([]cache.Value, len(keys))
+	// 本地缓存中没有的再从redis中批量获取
+	missing := make([]int, 0, len(keys))
+	for i, key := range keys {
+		if data, ok := c.l1.Get(key); ok {
+			c.stats.l1Hits.Add(1)
+			ret[i] = cache.NewValue(ctx, data.(string), options, nil)
+			continue
+		}
+		c.stats.l1Misses.Add(1)
+		missing = append(missing, i)
+	}
+	if len(missing) == 0 {
+		return ret
+	}
+	generation := c.generation.Load()
+	pipe := c.redis.Pipeline()
+	gets := make([]*redis.StringCmd, len(missing))
+	pttls := make([]*redis.DurationCmd, len(missing))
+	for n, i := range missing {
+		gets[n] = pipe.Get(ctx, keys[i])
+		pttls[n] = pipe.PTTL(ctx, keys[i])
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		for _, i := range missing {
+			ret[i] = cache.NewValue(ctx, "", options, err)
+		}
+		return ret
+	}
+	for n, i := range missing {
+		data, err := gets[n].Result()
+		if err != nil {
+			if err == redis.Nil {
+				c.stats.l2Misses.Add(1)
+				err = cache.ErrNil
+			}
+			ret[i] = cache.NewValue(ctx, "", options, err)
+			continue
+		}
+		c.stats.l2Hits.Add(1)
+		expiration := time.Duration(0)
+		if ttl := pttls[n].Val(); ttl > 0 {
+			expiration = ttl
+		}
+		c.fillL1(keys[i], data, expiration, generation)
+		ret[i] = cache.NewValue(ctx, data, options, nil)
+	}
+	return ret
+}
+
+func (c *Cache) MSet(ctx context.Context, values map[string]interface{}, opts ...cache.Option) error {
+	options := cache.NewOptions(opts...)
+	ttl := time.Duration(0)
+	if options.Expiration > 0 {
+		ttl = options.Expiration
+	}
+	data := make(map[string]string, len(values))
+	pipe := c.redis.Pipeline()
+	for key, val := range values {
+		b, err := cache.Marshal(ctx, val, options)
+		if err != nil {
+			return err
+		}
+		data[key] = string(b)
+		pipe.Set(ctx, key, data[key], ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(data))
+	c.generation.Add(1)
+	for key, s := range data {
+		if err := redisCache.AddTags(ctx, c.redis, key, options.Tags, ttl); err != nil {
+			return err
+		}
+		c.setL1(key, s, ttl)
+		keys = append(keys, key)
+	}
+	return c.publish(ctx, keys...)
+}
+
+func (c *Cache) MDel(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	// 先删除redis再删除本地缓存，避免同时进行的读取把旧数据重新写入本地缓存
+	err := c.redis.Del(ctx, keys...).Err()
+	c.generation.Add(1)
+	for _, key := range keys {
+		c.l1.Delete(key)
+	}
+	if err != nil {
+		return err
+	}
+	return c.publish(ctx, keys...)
+}
+
+func (c *Cache) DelByPrefix(ctx context.Context, prefix string) error {
+	err := redisCache.ScanPrefix(ctx, c.redis, prefix, func(keys []string) error {
+		return c.redis.Del(ctx, keys...).Err()
+	})
+	c.generation.Add(1)
+	c.delL1Prefix(prefix)
+	if err != nil {
+		return err
+	}
+	return c.publishInvalidation(ctx, &invalidation{Prefixes: []string{prefix}})
+}
+
+func (c *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	keys, err := redisCache.PopTags(ctx, c.redis, tags...)
+	if err != nil {
+		return err
+	}
+	return c.MDel(ctx, keys...)
+}
+
+// Stats 获取统计数据
+func (c *Cache) Stats() Stats {
+	return Stats{
+		L1Hits:        c.stats.l1Hits.Load(),
+		L1Misses:      c.stats.l1Misses.Load(),
+		L2Hits:        c.stats.l2Hits.Load(),
+		L2Misses:      c.stats.l2Misses.Load(),
+		Invalidations: c.stats.invalidations.Load(),
+	}
+}
+
+func (c *Cache) Close() error {
+	c.cancel()
+	err := c.pubsub.Close()
+	<-c.done
+	if c.registration != nil {
+		err = errors.Join(err, c.registration.Unregister())
+	}
+	return errors.Join(err, c.redis.Close())
+}
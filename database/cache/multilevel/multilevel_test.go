@@ -0,0 +1,190 @@
+package multilevel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cago-frame/cago/database/cache/cache"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T, m *miniredis.Miniredis, opts ...Option) *Cache {
+	c, err := NewMultilevelCache(redis.NewClient(&redis.Options{Addr: m.Addr()}), opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestMultilevel(t *testing.T) {
+	m := miniredis.RunT(t)
+	ctx := context.Background()
+	c1 := newTestCache(t, m)
+	c2 := newTestCache(t, m)
+
+	assert.NoError(t, c1.Set(ctx, "key", 1).Err())
+	assert.Eventually(t, func() bool {
+		return c2.Stats().Invalidations == 1
+	}, time.Second, 10*time.Millisecond)
+	// c1 写入时已经填充了本地缓存
+	result, err := c1.Get(ctx, "key").Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+	assert.Equal(t, int64(1), c1.Stats().L1Hits)
+
+	// c2 第一次从redis中读取，之后从本地缓存读取
+	result, err = c2.Get(ctx, "key").Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+	_, _ = c2.Get(ctx, "key").Int64()
+	assert.Equal(t, Stats{L1Hits: 1, L1Misses: 1, L2Hits: 1, Invalidations: 1}, c2.Stats())
+
+	// c1 更新后 c2 的本地缓存失效
+	assert.NoError(t, c1.Set(ctx, "key", 2).Err())
+	assert.Eventually(t, func() bool {
+		return c2.Stats().Invalidations == 2
+	}, time.Second, 10*time.Millisecond)
+	result, err = c2.Get(ctx, "key").Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result)
+
+	// 删除
+	_, _ = c2.Get(ctx, "key").Int64()
+	assert.NoError(t, c1.Del(ctx, "key"))
+	assert.Eventually(t, func() bool {
+		return c2.Stats().Invalidations == 3
+	}, time.Second, 10*time.Millisecond)
+	ok, err := c2.Has(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestKeyTTL(t *testing.T) {
+	m := miniredis.RunT(t)
+	c := newTestCache(t, m, WithL1TTL(time.Minute),
+		WithKeyTTL("user:", time.Second), WithKeyTTL("user:list:", 0))
+	assert.Equal(t, time.Minute, c.l1TTL("article:1", 0))
+	assert.Equal(t, time.Second, c.l1TTL("user:1", 0))
+	assert.Equal(t, time.Duration(0), c.l1TTL("user:list:1", 0))
+	// 不超过redis中的过期时间
+	assert.Equal(t, 10*time.Second, c.l1TTL("article:1", 10*time.Second))
+
+	ctx := context.Background()
+	assert.NoError(t, c.Set(ctx, "user:list:1", 1).Err())
+	_, ok := c.l1.Get("user:list:1")
+	assert.False(t, ok)
+	assert.NoError(t, c.Set(ctx, "user:1", 1).Err())
+	_, ok = c.l1.Get("user:1")
+	assert.True(t, ok)
+}
+
+func TestBatch(t *testing.T) {
+	m := miniredis.RunT(t)
+	ctx := context.Background()
+	c1 := newTestCache(t, m)
+	c2 := newTestCache(t, m)
+
+	assert.NoError(t, c1.MSet(ctx, map[string]interface{}{"list:1": 1, "list:2": 2}))
+	// 收到失效通知之前的读取不会写入本地缓存
+	assert.Eventually(t, func() bool {
+		return c2.Stats().Invalidations == 2
+	}, time.Second, 10*time.Millisecond)
+	values := c2.MGet(ctx, []string{"list:1", "list:2", "list:3"})
+	result, err := values[1].Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result)
+	assert.True(t, cache.IsNil(values[2].Err()))
+	_, ok := c2.l1.Get("list:1")
+	assert.True(t, ok)
+
+	// 前缀删除同时会清除其它实例的本地缓存
+	invalidations := c2.Stats().Invalidations
+	assert.NoError(t, c1.DelByPrefix(ctx, "list:"))
+	assert.Eventually(t, func() bool {
+		return c2.Stats().Invalidations > invalidations
+	}, time.Second, 10*time.Millisecond)
+	_, ok = c2.l1.Get("list:1")
+	assert.False(t, ok)
+	assert.True(t, cache.IsNil(c2.Get(ctx, "list:2").Err()))
+
+	// 标签
+	assert.NoError(t, c1.Set(ctx, "article:1", 1, cache.WithTags("user:1")).Err())
+	_, _ = c2.Get(ctx, "article:1").Int64()
+	invalidations = c2.Stats().Invalidations
+	assert.NoError(t, c1.InvalidateTags(ctx, "user:1"))
+	assert.Eventually(t, func() bool {
+		return c2.Stats().Invalidations > invalidations
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, cache.IsNil(c2.Get(ctx, "article:1").Err()))
+}
+
+// staleHook 在读取redis之后执行 after，模拟读取与写入本地缓存之间发生的失效
+type staleHook struct {
+	after func()
+}
+
+func (h *staleHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *staleHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *staleHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		if h.after != nil {
+			after := h.after
+			h.after = nil
+			after()
+		}
+		return err
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	m := miniredis.RunT(t)
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	hook := &staleHook{}
+	client.AddHook(hook)
+	c1, err := NewMultilevelCache(client)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c1.Close() })
+	c2 := newTestCache(t, m)
+
+	for name, get := range map[string]func(key string) (int64, error){
+		"get": func(key string) (int64, error) {
+			return c1.Get(ctx, key).Int64()
+		},
+		"mget": func(key string) (int64, error) {
+			return c1.MGet(ctx, []string{key})[0].Int64()
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key := "generation:" + name
+			require.NoError(t, c2.Set(ctx, key, 1).Err())
+			// c1 读到旧数据之后，c2 更新了数据并且 c1 已经收到了失效通知
+			hook.after = func() {
+				invalidations := c1.Stats().Invalidations
+				require.NoError(t, c2.Set(ctx, key, 2).Err())
+				require.Eventually(t, func() bool {
+					return c1.Stats().Invalidations > invalidations
+				}, time.Second, 10*time.Millisecond)
+			}
+			result, err := get(key)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), result)
+			// 旧数据没有写入本地缓存
+			_, ok := c1.l1.Get(key)
+			assert.False(t, ok)
+			result, err = get(key)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), result)
+		})
+	}
+}
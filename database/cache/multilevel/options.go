@@ -0,0 +1,72 @@
+package multilevel
+
+import (
+	"time"
+)
+
+// Config 多级缓存配置
+type Config struct {
+	// L1TTL 本地缓存的过期时间，默认1分钟
+	L1TTL time.Duration `yaml:"l1TTL"`
+	// KeyTTL 按key前缀覆盖本地缓存的过期时间，小于等于0表示该前缀不使用本地缓存
+	KeyTTL map[string]time.Duration `yaml:"keyTTL"`
+	// Channel 失效通知的频道
+	Channel string `yaml:"channel"`
+}
+
+type Options struct {
+	l1TTL   time.Duration
+	keyTTL  map[string]time.Duration
+	channel string
+}
+
+type Option func(*Options)
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		l1TTL:   time.Minute,
+		keyTTL:  make(map[string]time.Duration),
+		channel: "cago:cache:invalidate",
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return options
+}
+
+// WithConfig 使用配置文件设置选项
+func WithConfig(cfg *Config) Option {
+	return func(options *Options) {
+		if cfg.L1TTL > 0 {
+			options.l1TTL = cfg.L1TTL
+		}
+		if cfg.Channel != "" {
+			options.channel = cfg.Channel
+		}
+		for prefix, ttl := range cfg.KeyTTL {
+			options.keyTTL[prefix] = ttl
+		}
+	}
+}
+
+// WithL1TTL 设置本地缓存的默认过期时间
+func WithL1TTL(ttl time.Duration) Option {
+	return func(options *Options) {
+		options.l1TTL = ttl
+	}
+}
+
+// WithKeyTTL 按key前缀设置本地缓存的过期时间，匹配最长的前缀
+// ttl 小于等于0表示该前缀的key不使用本地缓存
+func WithKeyTTL(prefix string, ttl time.Duration) Option {
+	return func(options *Options) {
+		options.keyTTL[prefix] = ttl
+	}
+}
+
+// WithChannel 设置失效通知的频道，同一个频道下的实例会互相通知
+func WithChannel(channel string) Option {
+	return func(options *Options) {
+		options.channel = channel
+	}
+}
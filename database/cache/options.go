@@ -7,6 +7,21 @@ import (
 var (
 	Expiration = cache2.Expiration
 	WithDepend = cache2.WithDepend
+	WithTags   = cache2.WithTags
+	// 序列化与压缩
+	WithCodec       = cache2.WithCodec
+	WithCompression = cache2.WithCompression
+	JSON            = cache2.JSON
+	Gob             = cache2.Gob
+	Msgpack         = cache2.Msgpack
+	Protobuf        = cache2.Protobuf
+	Gzip            = cache2.Gzip
+	Zstd            = cache2.Zstd
+	// GetOrSet 的选项
+	WithLocker       = cache2.WithLocker
+	WithEarlyRefresh = cache2.WithEarlyRefresh
+	WithStale        = cache2.WithStale
+	WithNotFound     = cache2.WithNotFound
 )
 
 func IsNil(err error) bool {
@@ -13,10 +13,22 @@ import (
 )
 
 type redisCache struct {
-	redis *redis.Client
+	redis  *redis.Client
+	loader cache.Loader
 }
 
 func NewRedisCache(config *redis.Options) (cache.Cache, error) {
+	client, err := NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &redisCache{
+		redis: client,
+	}, nil
+}
+
+// NewClient 创建缓存使用的redis客户端，会根据配置自动开启链路追踪和指标
+func NewClient(config *redis.Options) (*redis.Client, error) {
 	client := redis.NewClient(config)
 	err := client.Ping(context.Background()).Err()
 	if err != nil {
@@ -37,27 +49,11 @@ func NewRedisCache(config *redis.Options) (cache.Cache, error) {
 			return nil, err
 		}
 	}
-	return &redisCache{
-		redis: client,
-	}, nil
+	return client, nil
 }
 
 func (r *redisCache) GetOrSet(ctx context.Context, key string, set func() (interface{}, error), opts ...cache.Option) cache.Value {
-	ret := r.Get(ctx, key, opts...)
-	if ret.Err() != nil {
-		val, err := set()
-		if err != nil {
-			return cache.NewValue(ctx, "", cache.NewOptions(opts...), err)
-		}
-		return r.Set(ctx, key, val, opts...)
-	}
-	return &cache.GetOrSetValue{Value: ret, Set: func() cache.Value {
-		val, err := set()
-		if err != nil {
-			return cache.NewValue(ctx, "", cache.NewOptions(opts...), err)
-		}
-		return r.Set(ctx, key, val, opts...)
-	}}
+	return r.loader.GetOrSet(ctx, r, key, set, opts...)
 }
 
 func (r *redisCache) Unmarshal(data []byte, v interface{}) error {
@@ -91,6 +87,9 @@ func (r *redisCache) Set(ctx context.Context, key string, val interface{}, opts
 	if err := r.redis.Set(ctx, key, s, ttl).Err(); err != nil {
 		return cache.NewValue(ctx, "", options, err)
 	}
+	if err := AddTags(ctx, r.redis, key, options.Tags, ttl); err != nil {
+		return cache.NewValue(ctx, "", options, err)
+	}
 	if options.Depend != nil {
 		// 移除掉依赖
 		options.Depend = &cache.NilDep{}
@@ -113,6 +112,72 @@ func (r *redisCache) Del(ctx context.Context, key string) error {
 	return r.redis.Del(ctx, key).Err()
 }
 
+func (r *redisCache) MGet(ctx context.Context, keys []string, opts ...cache.Option) []cache.Value {
+	ret := make([]cache.Value, len(keys))
+	if len(keys) == 0 {
+		return ret
+	}
+	options := cache.NewOptions(opts...)
+	data, err := r.redis.MGet(ctx, keys...).Result()
+	for i := range keys {
+		switch {
+		case err != nil:
+			ret[i] = cache.NewValue(ctx, "", options, err)
+		case data[i] == nil:
+			ret[i] = cache.NewValue(ctx, "", options, cache.ErrNil)
+		default:
+			ret[i] = cache.NewValue(ctx, data[i].(string), options, nil)
+		}
+	}
+	return ret
+}
+
+func (r *redisCache) MSet(ctx context.Context, values map[string]interface{}, opts ...cache.Option) error {
+	options := cache.NewOptions(opts...)
+	ttl := time.Duration(0)
+	if options.Expiration > 0 {
+		ttl = options.Expiration
+	}
+	pipe := r.redis.Pipeline()
+	for key, val := range values {
+		data, err := cache.Marshal(ctx, val, options)
+		if err != nil {
+			return err
+		}
+		pipe.Set(ctx, key, data, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	for key := range values {
+		if err := AddTags(ctx, r.redis, key, options.Tags, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *redisCache) MDel(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.redis.Del(ctx, keys...).Err()
+}
+
+func (r *redisCache) DelByPrefix(ctx context.Context, prefix string) error {
+	return ScanPrefix(ctx, r.redis, prefix, func(keys []string) error {
+		return r.redis.Del(ctx, keys...).Err()
+	})
+}
+
+func (r *redisCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	keys, err := PopTags(ctx, r.redis, tags...)
+	if err != nil {
+		return err
+	}
+	return r.MDel(ctx, keys...)
+}
+
 func (r *redisCache) Close() error {
 	return r.redis.Close()
 }
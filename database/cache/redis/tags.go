@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TagKeyPrefix 标签在redis中存储的key前缀，标签下的key使用set存储
+const TagKeyPrefix = "cago:cache:tag:"
+
+// addTagScript 将key加入标签，标签的过期时间取其中key过期时间的最大值，有永不过期的key时标签也不会过期
+var addTagScript = redis.NewScript(`
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl <= 0 then
+	redis.call('PERSIST', KEYS[1])
+	return 1
+end
+local cur = redis.call('PTTL', KEYS[1])
+if existed == 0 or (cur >= 0 and cur < ttl) then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// AddTags 将key加入标签
+func AddTags(ctx context.Context, client redis.Scripter, key string, tags []string, ttl time.Duration) error {
+	for _, tag := range tags {
+		if err := addTagScript.Run(ctx, client, []string{TagKeyPrefix + tag}, key, ttl.Milliseconds()).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// popTagScript 原子地取出标签下的所有key并删除标签，避免读取与删除之间加入标签的key没有失效
+var popTagScript = redis.NewScript(`
+local keys = redis.call('SMEMBERS', KEYS[1])
+redis.call('DEL', KEYS[1])
+return keys
+`)
+
+// PopTags 获取带有这些标签的所有key，并删除标签，每个标签的读取与删除是原子的
+func PopTags(ctx context.Context, client redis.Scripter, tags ...string) ([]string, error) {
+	ret := make([]string, 0)
+	for _, tag := range tags {
+		keys, err := popTagScript.Run(ctx, client, []string{TagKeyPrefix + tag}).StringSlice()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, keys...)
+	}
+	return ret, nil
+}
+
+// ScanPrefix 扫描以prefix开头的所有key，每批key会回调一次fn
+func ScanPrefix(ctx context.Context, client redis.Cmdable, prefix string, fn func(keys []string) error) error {
+	match := escapePattern(prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, match, 1000).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// escapePattern 转义redis匹配模式中的特殊字符
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	cache2 "github.com/cago-frame/cago/database/cache/cache"
+)
+
+// KeyBuilder 根据参数生成缓存key
+type KeyBuilder func(args ...interface{}) string
+
+// KeyFormat 使用 fmt.Sprintf 格式化生成缓存key
+//
+//	cache.KeyFormat("user:%d")
+func KeyFormat(format string) KeyBuilder {
+	return func(args ...interface{}) string {
+		return fmt.Sprintf(format, args...)
+	}
+}
+
+type typedOptions struct {
+	keyBuilder KeyBuilder
+	opts       []cache2.Option
+}
+
+type TypedOption func(*typedOptions)
+
+// WithKeyBuilder 设置 Typed.Key 使用的key生成方法
+func WithKeyBuilder(builder KeyBuilder) TypedOption {
+	return func(o *typedOptions) {
+		o.keyBuilder = builder
+	}
+}
+
+// WithOptions 设置默认的缓存选项，每次调用时传入的选项会追加在后面
+func WithOptions(opts ...cache2.Option) TypedOption {
+	return func(o *typedOptions) {
+		o.opts = append(o.opts, opts...)
+	}
+}
+
+// Typed 带类型的缓存，可以包装任意的 cache.Cache
+// 当传入的缓存为nil时，会在调用时使用 Default()，所以可以在组件启动前创建
+//
+//	var userCache = cache.NewTyped[*User](nil, cache.WithKeyBuilder(cache.KeyFormat("user:%d")),
+//		cache.WithOptions(cache.Expiration(time.Hour)))
+//	user, err := userCache.GetOrSet(ctx, userCache.Key(id), func() (*User, error) {
+//		return repo.Find(ctx, id)
+//	})
+type Typed[T any] struct {
+	cache   cache2.Cache
+	options *typedOptions
+}
+
+func NewTyped[T any](cache cache2.Cache, opts ...TypedOption) *Typed[T] {
+	options := &typedOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+	return &Typed[T]{
+		cache:   cache,
+		options: options,
+	}
+}
+
+func (t *Typed[T]) store() cache2.Cache {
+	if t.cache == nil {
+		return Default()
+	}
+	return t.cache
+}
+
+func (t *Typed[T]) opts(opts []cache2.Option) []cache2.Option {
+	if len(t.options.opts) == 0 {
+		return opts
+	}
+	return append(append(make([]cache2.Option, 0, len(t.options.opts)+len(opts)), t.options.opts...), opts...)
+}
+
+// Key 生成缓存key，未设置 WithKeyBuilder 时使用":"连接参数
+func (t *Typed[T]) Key(args ...interface{}) string {
+	if t.options.keyBuilder != nil {
+		return t.options.keyBuilder(args...)
+	}
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = fmt.Sprint(v)
+	}
+	return strings.Join(keys, ":")
+}
+
+// Get 获取缓存，不存在时返回 ErrNil，可以使用 IsNil 判断
+func (t *Typed[T]) Get(ctx context.Context, key string, opts ...cache2.Option) (T, error) {
+	var val T
+	if err := t.store().Get(ctx, key, t.opts(opts)...).Scan(&val); err != nil {
+		var zero T
+		return zero, err
+	}
+	return val, nil
+}
+
+// GetOrSet 获取缓存，不存在时调用set设置缓存
+func (t *Typed[T]) GetOrSet(ctx context.Context, key string, set func() (T, error), opts ...cache2.Option) (T, error) {
+	var val T
+	if err := t.store().GetOrSet(ctx, key, func() (interface{}, error) {
+		return set()
+	}, t.opts(opts)...).Scan(&val); err != nil {
+		var zero T
+		return zero, err
+	}
+	return val, nil
+}
+
+func (t *Typed[T]) Set(ctx context.Context, key string, val T, opts ...cache2.Option) error {
+	return t.store().Set(ctx, key, val, t.opts(opts)...).Err()
+}
+
+func (t *Typed[T]) Has(ctx context.Context, key string) (bool, error) {
+	return t.store().Has(ctx, key)
+}
+
+func (t *Typed[T]) Del(ctx context.Context, key string) error {
+	return t.store().Del(ctx, key)
+}
+
+// MGet 批量获取缓存，只返回存在且依赖有效的key
+func (t *Typed[T]) MGet(ctx context.Context, keys []string, opts ...cache2.Option) (map[string]T, error) {
+	ret := make(map[string]T, len(keys))
+	for i, v := range t.store().MGet(ctx, keys, t.opts(opts)...) {
+		var val T
+		if err := v.Scan(&val); err != nil {
+			if IsNil(err) || errors.Is(err, cache2.ErrDependNotValid) {
+				continue
+			}
+			return nil, err
+		}
+		ret[keys[i]] = val
+	}
+	return ret, nil
+}
+
+func (t *Typed[T]) MSet(ctx context.Context, values map[string]T, opts ...cache2.Option) error {
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		m[k] = v
+	}
+	return t.store().MSet(ctx, m, t.opts(opts)...)
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+
+	cache2 "github.com/cago-frame/cago/database/cache/cache"
+	"github.com/cago-frame/cago/pkg/utils/wrap"
+)
+
+// wrapResult 用于中间件获取命中情况
+type wrapResult struct {
+	hits   int
+	misses int
+}
+
+type wrapCache struct {
+	cache2.Cache
+	wrap *wrap.Wrap
+}
+
+// newWrapCache 包装缓存，中间件的参数为 key(或keys、prefix、tags) 与 *wrapResult
+func newWrapCache(cache cache2.Cache, w *wrap.Wrap) cache2.Cache {
+	return &wrapCache{
+		Cache: cache,
+		wrap:  w,
+	}
+}
+
+func (w *wrapCache) GetOrSet(ctx context.Context, key string, set func() (interface{}, error), opts ...cache2.Option) (ret cache2.Value) {
+	result := &wrapResult{}
+	err := w.wrap.Run(ctx, "GetOrSet", []interface{}{key, result}, func(ctx *wrap.Context) {
+		// 命中情况由 Loader 记录，后台刷新不会计入
+		stat := &cache2.LoadStat{}
+		ret = w.Cache.GetOrSet(cache2.WithLoadStat(ctx, stat), key, set, opts...)
+		result.hits += int(stat.Hits())
+		result.misses += int(stat.Misses())
+		ctx.Abort(ret.Err())
+	})
+	if ret == nil {
+		return cache2.NewValue(ctx, "", cache2.NewOptions(opts...), err)
+	}
+	return ret
+}
+
+func (w *wrapCache) Set(ctx context.Context, key string, val interface{}, opts ...cache2.Option) (ret cache2.Value) {
+	err := w.wrap.Run(ctx, "Set", []interface{}{key, &wrapResult{}}, func(ctx *wrap.Context) {
+		ret = w.Cache.Set(ctx, key, val, opts...)
+		ctx.Abort(ret.Err())
+	})
+	if ret == nil {
+		return cache2.NewValue(ctx, "", cache2.NewOptions(opts...), err)
+	}
+	return ret
+}
+
+func (w *wrapCache) Get(ctx context.Context, key string, opts ...cache2.Option) (ret cache2.Value) {
+	result := &wrapResult{}
+	err := w.wrap.Run(ctx, "Get", []interface{}{key, result}, func(ctx *wrap.Context) {
+		ret = w.Cache.Get(ctx, key, opts...)
+		if err := ret.Err(); err == nil {
+			result.hits++
+		} else if IsNil(err) {
+			result.misses++
+			// 未命中不算错误
+			return
+		}
+		ctx.Abort(ret.Err())
+	})
+	if ret == nil {
+		return cache2.NewValue(ctx, "", cache2.NewOptions(opts...), err)
+	}
+	return ret
+}
+
+func (w *wrapCache) Has(ctx context.Context, key string) (ok bool, err error) {
+	result := &wrapResult{}
+	err = w.wrap.Run(ctx, "Has", []interface{}{key, result}, func(ctx *wrap.Context) {
+		ok, err = w.Cache.Has(ctx, key)
+		if err == nil {
+			if ok {
+				result.hits++
+			} else {
+				result.misses++
+			}
+		}
+		ctx.Abort(err)
+	})
+	return
+}
+
+func (w *wrapCache) Del(ctx context.Context, key string) error {
+	return w.wrap.Run(ctx, "Del", []interface{}{key, &wrapResult{}}, func(ctx *wrap.Context) {
+		ctx.Abort(w.Cache.Del(ctx, key))
+	})
+}
+
+func (w *wrapCache) MGet(ctx context.Context, keys []string, opts ...cache2.Option) (ret []cache2.Value) {
+	result := &wrapResult{}
+	err := w.wrap.Run(ctx, "MGet", []interface{}{keys, result}, func(ctx *wrap.Context) {
+		ret = w.Cache.MGet(ctx, keys, opts...)
+		var err error
+		for _, v := range ret {
+			switch e := v.Err(); {
+			case e == nil:
+				result.hits++
+			case IsNil(e):
+				result.misses++
+			default:
+				err = e
+			}
+		}
+		ctx.Abort(err)
+	})
+	if ret == nil {
+		ret = make([]cache2.Value, len(keys))
+		for i := range ret {
+			ret[i] = cache2.NewValue(ctx, "", cache2.NewOptions(opts...), err)
+		}
+	}
+	return ret
+}
+
+func (w *wrapCache) MSet(ctx context.Context, values map[string]interface{}, opts ...cache2.Option) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	return w.wrap.Run(ctx, "MSet", []interface{}{keys, &wrapResult{}}, func(ctx *wrap.Context) {
+		ctx.Abort(w.Cache.MSet(ctx, values, opts...))
+	})
+}
+
+func (w *wrapCache) MDel(ctx context.Context, keys ...string) error {
+	return w.wrap.Run(ctx, "MDel", []interface{}{keys, &wrapResult{}}, func(ctx *wrap.Context) {
+		ctx.Abort(w.Cache.MDel(ctx, keys...))
+	})
+}
+
+func (w *wrapCache) DelByPrefix(ctx context.Context, prefix string) error {
+	return w.wrap.Run(ctx, "DelByPrefix", []interface{}{prefix, &wrapResult{}}, func(ctx *wrap.Context) {
+		ctx.Abort(w.Cache.DelByPrefix(ctx, prefix))
+	})
+}
+
+func (w *wrapCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	return w.wrap.Run(ctx, "InvalidateTags", []interface{}{tags, &wrapResult{}}, func(ctx *wrap.Context) {
+		ctx.Abort(w.Cache.InvalidateTags(ctx, tags...))
+	})
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cache2 "github.com/cago-frame/cago/database/cache/cache"
+	"github.com/cago-frame/cago/database/cache/memory"
+	"github.com/cago-frame/cago/pkg/opentelemetry/metric"
+	"github.com/cago-frame/cago/pkg/utils/wrap"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newWrapCache(t *testing.T) {
+	w := wrap.New()
+	var (
+		calls  = make(map[string]int)
+		hits   int
+		misses int
+		errs   int
+	)
+	w.Wrap(func(ctx *wrap.Context) {
+		ctx.Next()
+		calls[ctx.Name()]++
+		result := ctx.Args(1).(*wrapResult)
+		hits += result.hits
+		misses += result.misses
+		if ctx.IsAbort() != nil {
+			errs++
+		}
+		assert.Equal(t, "user", argPrefix(ctx.Args(0)))
+	})
+	m, _ := memory.NewMemoryCache()
+	c := newWrapCache(m, w)
+	ctx := context.Background()
+
+	assert.True(t, IsNil(c.Get(ctx, "user:1").Err()))
+	assert.NoError(t, c.Set(ctx, "user:1", 1).Err())
+	result, err := c.Get(ctx, "user:1").Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result)
+	assert.NoError(t, c.GetOrSet(ctx, "user:2", func() (interface{}, error) {
+		return 2, nil
+	}).Err())
+	assert.NoError(t, c.GetOrSet(ctx, "user:2", func() (interface{}, error) {
+		return 2, nil
+	}).Err())
+	assert.Error(t, c.GetOrSet(ctx, "user:3", func() (interface{}, error) {
+		return nil, errors.New("load error")
+	}).Err())
+	values := c.MGet(ctx, []string{"user:1", "user:2", "user:3"})
+	assert.Len(t, values, 3)
+	assert.NoError(t, c.Del(ctx, "user:1"))
+
+	assert.Equal(t, map[string]int{"Get": 2, "Set": 1, "GetOrSet": 3, "MGet": 1, "Del": 1}, calls)
+	// Get: 1命中1未命中 GetOrSet: 1命中2未命中 MGet: 2命中1未命中
+	assert.Equal(t, 4, hits)
+	assert.Equal(t, 4, misses)
+	assert.Equal(t, 1, errs)
+}
+
+func Test_wrapCache_GetOrSetStale(t *testing.T) {
+	w := wrap.New()
+	var hits, misses atomic.Int64
+	w.Wrap(func(ctx *wrap.Context) {
+		ctx.Next()
+		result := ctx.Args(1).(*wrapResult)
+		hits.Add(int64(result.hits))
+		misses.Add(int64(result.misses))
+	})
+	m, _ := memory.NewMemoryCache()
+	c := newWrapCache(m, w)
+	ctx := context.Background()
+	var loads atomic.Int64
+	set := func() (interface{}, error) {
+		loads.Add(1)
+		return 1, nil
+	}
+	opts := []cache2.Option{cache2.Expiration(time.Millisecond * 50), cache2.WithStale(time.Minute)}
+	assert.NoError(t, c.GetOrSet(ctx, "user:1", set, opts...).Err())
+	assert.Equal(t, int64(1), misses.Load())
+
+	// 过期后返回旧数据并在后台刷新，都算作命中
+	time.Sleep(time.Millisecond * 60)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, c.GetOrSet(ctx, "user:1", set, opts...).Err())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(10), hits.Load())
+	assert.Equal(t, int64(1), misses.Load())
+	assert.Eventually(t, func() bool {
+		return loads.Load() >= 2
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestKeyPrefix(t *testing.T) {
+	assert.Equal(t, "user", keyPrefix("user:1:info"))
+	assert.Equal(t, "user", keyPrefix("user"))
+	assert.Equal(t, "", argPrefix([]string{}))
+}
+
+func Test_newWrap(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, metric.Metrics(ctx, nil))
+	w, err := newWrap()
+	assert.NoError(t, err)
+	m, _ := memory.NewMemoryCache()
+	c := newWrapCache(m, w)
+	assert.NoError(t, c.Set(ctx, "user:1", 1).Err())
+	assert.NoError(t, c.Get(ctx, "user:1").Err())
+	assert.NoError(t, c.MDel(ctx, "user:1"))
+	assert.NoError(t, c.InvalidateTags(ctx, "user"))
+}
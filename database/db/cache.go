@@ -0,0 +1,592 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	driver2 "database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cago-frame/cago/database/cache"
+	cache2 "github.com/cago-frame/cago/database/cache/cache"
+	"github.com/cago-frame/cago/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const cacheSettingKey = "cago:db:cache"
+
+// CacheableModel 实现了该接口的模型，按主键或唯一键查询时会自动使用缓存
+type CacheableModel interface {
+	// CacheExpiration 缓存过期时间，为0时使用插件的默认过期时间
+	CacheExpiration() time.Duration
+}
+
+type cacheSetting struct {
+	skip       bool
+	expiration time.Duration
+}
+
+// UseCache 本次查询使用缓存，expiration 为0时使用插件的默认过期时间
+//
+//	db.Ctx(ctx).Scopes(db.UseCache(time.Minute)).First(&user, id)
+func UseCache(expiration time.Duration) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Set(cacheSettingKey, &cacheSetting{expiration: expiration})
+	}
+}
+
+// SkipCache 本次查询不使用缓存，用于实现了 CacheableModel 的模型
+func SkipCache() func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Set(cacheSettingKey, &cacheSetting{skip: true})
+	}
+}
+
+type CacheOptions struct {
+	store      cache2.Cache
+	prefix     string
+	expiration time.Duration
+}
+
+type CacheOption func(*CacheOptions)
+
+// WithCacheStore 设置缓存，默认使用 cache.Default()
+func WithCacheStore(store cache2.Cache) CacheOption {
+	return func(options *CacheOptions) {
+		options.store = store
+	}
+}
+
+// WithCacheKeyPrefix 设置缓存key的前缀，默认为 gorm:cache:
+// 多个数据库中有相同的表时需要设置不同的前缀
+func WithCacheKeyPrefix(prefix string) CacheOption {
+	return func(options *CacheOptions) {
+		options.prefix = prefix
+	}
+}
+
+// WithCacheExpiration 设置默认的缓存过期时间，默认为10分钟
+func WithCacheExpiration(expiration time.Duration) CacheOption {
+	return func(options *CacheOptions) {
+		options.expiration = expiration
+	}
+}
+
+// CachePlugin gorm查询缓存插件
+// 只缓存按单个主键或唯一键等值查询的 First/Take/Last/Find，查询结果为一条完整的记录时才会写入缓存
+// 主键缓存记录本身，唯一键缓存对应的主键；Update/Delete 后会删除对应主键的缓存
+// 写入的缓存都带有所在表的标签，无法确定主键时通过 InvalidateTags 删除整张表的缓存
+// 事务中的查询不会使用缓存，事务中的 Update/Delete 在事务提交之后才删除缓存
+type CachePlugin struct {
+	options *CacheOptions
+	// uniques 表的唯一键字段
+	uniques sync.Map
+}
+
+func NewCachePlugin(opts ...CacheOption) *CachePlugin {
+	options := &CacheOptions{
+		prefix:     "gorm:cache:",
+		expiration: 10 * time.Minute,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return &CachePlugin{options: options}
+}
+
+func (p *CachePlugin) Name() string {
+	return "cago:cache"
+}
+
+func (p *CachePlugin) Initialize(db *gorm.DB) error {
+	query := db.Callback().Query().Get("gorm:query")
+	if query == nil {
+		return errors.New("gorm:query callback not found")
+	}
+	if err := db.Callback().Query().Replace("gorm:query", p.query(query)); err != nil {
+		return err
+	}
+	// 包装连接以便在事务提交之后删除缓存，预编译模式下包装预编译使用的连接
+	if pool, ok := db.ConnPool.(*gorm.PreparedStmtDB); ok {
+		pool.ConnPool = &cacheConnPool{ConnPool: pool.ConnPool}
+	} else {
+		db.ConnPool = &cacheConnPool{ConnPool: db.ConnPool}
+		db.Statement.ConnPool = db.ConnPool
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("cago:cache:update", p.invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("cago:cache:delete", p.invalidate)
+}
+
+func (p *CachePlugin) store() cache2.Cache {
+	if p.options.store != nil {
+		return p.options.store
+	}
+	return cache.Default()
+}
+
+// tableTag 表的缓存标签，同一张表的缓存都带有该标签
+func (p *CachePlugin) tableTag(stmt *gorm.Statement) string {
+	return p.options.prefix + stmt.Schema.Table
+}
+
+func (p *CachePlugin) key(stmt *gorm.Statement, field *schema.Field, value string) string {
+	return p.tableTag(stmt) + ":" + field.DBName + ":" + value
+}
+
+// expiration 判断查询是否需要使用缓存，返回缓存的过期时间
+func (p *CachePlugin) expiration(tx *gorm.DB) (time.Duration, bool) {
+	stmt := tx.Statement
+	if stmt.Schema == nil || p.store() == nil || inTransaction(tx) {
+		return 0, false
+	}
+	var expiration time.Duration
+	if v, ok := tx.Get(cacheSettingKey); ok {
+		setting := v.(*cacheSetting)
+		if setting.skip {
+			return 0, false
+		}
+		expiration = setting.expiration
+	} else if m, ok := reflect.New(stmt.Schema.ModelType).Interface().(CacheableModel); ok {
+		expiration = m.CacheExpiration()
+	} else {
+		return 0, false
+	}
+	if expiration <= 0 {
+		expiration = p.options.expiration
+	}
+	return expiration, true
+}
+
+func inTransaction(tx *gorm.DB) bool {
+	_, ok := tx.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// lookup 获取查询条件中的主键或唯一键，只支持单个等值条件并查询完整记录的情况
+func (p *CachePlugin) lookup(stmt *gorm.Statement) (*schema.Field, string, bool) {
+	if stmt.Schema.PrioritizedPrimaryField == nil || stmt.SQL.Len() > 0 || stmt.Unscoped || stmt.Distinct || len(stmt.Selects) > 0 || len(stmt.Omits) > 0 ||
+		len(stmt.Joins) > 0 || (stmt.Table != "" && stmt.Table != stmt.Schema.Table) {
+		return nil, "", false
+	}
+	for _, name := range []string{"GROUP BY", "FROM", "FOR"} {
+		if _, ok := stmt.Clauses[name]; ok {
+			return nil, "", false
+		}
+	}
+	if c, ok := stmt.Clauses["LIMIT"]; ok {
+		if limit, ok := c.Expression.(clause.Limit); ok && limit.Offset > 0 {
+			return nil, "", false
+		}
+	}
+	// 只缓存与模型相同类型的结果
+	reflectValue := stmt.ReflectValue
+	if reflectValue.Kind() == reflect.Slice {
+		elem := reflectValue.Type().Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem != stmt.Schema.ModelType {
+			return nil, "", false
+		}
+	} else if reflectValue.Kind() != reflect.Struct || reflectValue.Type() != stmt.Schema.ModelType {
+		return nil, "", false
+	}
+	conds, ok := p.conditions(stmt)
+	if !ok {
+		return nil, "", false
+	}
+	// 结果中的主键不为空时 gorm 会将其作为查询条件
+	if reflectValue.Kind() == reflect.Struct {
+		if v, isZero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, reflectValue); !isZero {
+			if len(conds) > 0 {
+				return nil, "", false
+			}
+			conds = append(conds, condition{field: stmt.Schema.PrioritizedPrimaryField, values: []interface{}{v}})
+		}
+	}
+	if len(conds) != 1 || len(conds[0].values) != 1 || conds[0].field == nil {
+		return nil, "", false
+	}
+	field := conds[0].field
+	if field != stmt.Schema.PrioritizedPrimaryField && !p.isUnique(stmt.Schema, field) {
+		return nil, "", false
+	}
+	return field, cacheValue(conds[0].values[0]), true
+}
+
+func (p *CachePlugin) isUnique(s *schema.Schema, field *schema.Field) bool {
+	if v, ok := p.uniques.Load(s); ok {
+		_, ok := v.(map[string]struct{})[field.DBName]
+		return ok
+	}
+	uniques := make(map[string]struct{})
+	for _, f := range s.Fields {
+		if f.Unique {
+			uniques[f.DBName] = struct{}{}
+		}
+	}
+	for _, index := range s.ParseIndexes() {
+		if index.Class == "UNIQUE" && len(index.Fields) == 1 {
+			uniques[index.Fields[0].DBName] = struct{}{}
+		}
+	}
+	p.uniques.Store(s, uniques)
+	_, ok := uniques[field.DBName]
+	return ok
+}
+
+func (p *CachePlugin) query(query func(*gorm.DB)) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.DryRun {
+			query(tx)
+			return
+		}
+		expiration, ok := p.expiration(tx)
+		if !ok {
+			query(tx)
+			return
+		}
+		field, value, ok := p.lookup(tx.Statement)
+		if !ok {
+			query(tx)
+			return
+		}
+		if p.load(tx, field, value) {
+			tx.RowsAffected = 1
+			return
+		}
+		query(tx)
+		if tx.Error == nil && tx.RowsAffected == 1 {
+			p.save(tx, field, value, expiration)
+		}
+	}
+}
+
+// load 从缓存中读取记录并写入查询结果
+func (p *CachePlugin) load(tx *gorm.DB, field *schema.Field, value string) bool {
+	stmt := tx.Statement
+	ctx := stmt.Context
+	store := p.store()
+	pk := stmt.Schema.PrioritizedPrimaryField
+	primaryKey := value
+	if field != pk {
+		if err := store.Get(ctx, p.key(stmt, field, value)).Scan(&primaryKey); err != nil {
+			p.logError(ctx, err)
+			return false
+		}
+	}
+	row := reflect.New(stmt.Schema.ModelType)
+	if err := store.Get(ctx, p.key(stmt, pk, primaryKey)).Scan(row.Interface()); err != nil {
+		p.logError(ctx, err)
+		return false
+	}
+	// 唯一键可能已经被修改了
+	if v, _ := field.ValueOf(ctx, row.Elem()); cacheValue(v) != value {
+		return false
+	}
+	reflectValue := stmt.ReflectValue
+	switch reflectValue.Kind() {
+	case reflect.Slice:
+		elem := row
+		if reflectValue.Type().Elem().Kind() != reflect.Ptr {
+			elem = row.Elem()
+		}
+		reflectValue.Set(reflect.Append(reflectValue.Slice(0, 0), elem))
+	default:
+		reflectValue.Set(row.Elem())
+	}
+	return true
+}
+
+// save 将查询到的记录写入缓存
+func (p *CachePlugin) save(tx *gorm.DB, field *schema.Field, value string, expiration time.Duration) {
+	stmt := tx.Statement
+	ctx := stmt.Context
+	store := p.store()
+	row := stmt.ReflectValue
+	if row.Kind() == reflect.Slice {
+		if row.Len() != 1 {
+			return
+		}
+		row = reflect.Indirect(row.Index(0))
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	v, isZero := pk.ValueOf(ctx, row)
+	if isZero {
+		return
+	}
+	primaryKey := cacheValue(v)
+	tag := cache2.WithTags(p.tableTag(stmt))
+	// 使用gob序列化，避免 json:"-" 的字段丢失
+	if err := store.Set(ctx, p.key(stmt, pk, primaryKey), row.Addr().Interface(),
+		cache2.Expiration(expiration), cache2.WithCodec(cache2.Gob), tag).Err(); err != nil {
+		p.logError(ctx, err)
+		return
+	}
+	if field != pk {
+		if err := store.Set(ctx, p.key(stmt, field, value), primaryKey,
+			cache2.Expiration(expiration), tag).Err(); err != nil {
+			p.logError(ctx, err)
+		}
+	}
+}
+
+// invalidate 删除更新或删除的记录的缓存
+// 事务中的更新在提交之后再删除，避免其它查询在提交之前把旧的数据重新写入缓存，回滚时不删除
+func (p *CachePlugin) invalidate(tx *gorm.DB) {
+	stmt := tx.Statement
+	if tx.Error != nil || tx.DryRun || tx.RowsAffected == 0 || stmt.Schema == nil || p.store() == nil {
+		return
+	}
+	del := p.invalidation(stmt)
+	if cacheTx, ok := cacheTxOf(stmt.ConnPool); ok {
+		cacheTx.afterCommit(del)
+		return
+	}
+	del(stmt.Context)
+}
+
+// invalidation 生成删除缓存的函数
+func (p *CachePlugin) invalidation(stmt *gorm.Statement) func(ctx context.Context) {
+	pk := stmt.Schema.PrioritizedPrimaryField
+	var keys []string
+	if conds, ok := p.conditions(stmt); ok && pk != nil {
+		for _, cond := range conds {
+			if cond.field != pk {
+				continue
+			}
+			keys = make([]string, 0, len(cond.values))
+			for _, v := range cond.values {
+				keys = append(keys, p.key(stmt, pk, cacheValue(v)))
+			}
+			break
+		}
+	}
+	tag := p.tableTag(stmt)
+	return func(ctx context.Context) {
+		var err error
+		if keys != nil {
+			err = p.store().MDel(ctx, keys...)
+		} else {
+			// 无法确定影响的记录时删除整张表的缓存，只删除带有表标签的key，不需要扫描整个keyspace
+			err = p.store().InvalidateTags(ctx, tag)
+		}
+		p.logError(ctx, err)
+	}
+}
+
+// cacheConnPool 包装数据库连接，开启的事务提交之后再删除事务中更新的记录的缓存
+type cacheConnPool struct {
+	gorm.ConnPool
+}
+
+func (c *cacheConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var (
+		tx  gorm.ConnPool
+		err error
+	)
+	switch beginner := c.ConnPool.(type) {
+	case gorm.TxBeginner:
+		var sqlTx *sql.Tx
+		sqlTx, err = beginner.BeginTx(ctx, opts)
+		tx = sqlTx
+	case gorm.ConnPoolBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cacheTx{ConnPool: tx, ctx: context.WithoutCancel(ctx)}, nil
+}
+
+func (c *cacheConnPool) GetDBConn() (*sql.DB, error) {
+	return sqlDB(c.ConnPool)
+}
+
+// cacheTx 事务提交之后执行缓存的删除
+type cacheTx struct {
+	gorm.ConnPool
+	ctx        context.Context
+	mu         sync.Mutex
+	invalidate []func(ctx context.Context)
+}
+
+// cacheTxOf 获取事务中的 cacheTx，不是插件开启的事务时返回false
+func cacheTxOf(pool gorm.ConnPool) (*cacheTx, bool) {
+	if tx, ok := pool.(*gorm.PreparedStmtTX); ok {
+		pool = tx.Tx
+	}
+	tx, ok := pool.(*cacheTx)
+	return tx, ok
+}
+
+func (t *cacheTx) afterCommit(f func(ctx context.Context)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.invalidate = append(t.invalidate, f)
+}
+
+func (t *cacheTx) Commit() error {
+	if err := t.ConnPool.(gorm.TxCommitter).Commit(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	invalidate := t.invalidate
+	t.invalidate = nil
+	t.mu.Unlock()
+	for _, f := range invalidate {
+		f(t.ctx)
+	}
+	return nil
+}
+
+func (t *cacheTx) Rollback() error {
+	t.mu.Lock()
+	t.invalidate = nil
+	t.mu.Unlock()
+	return t.ConnPool.(gorm.TxCommitter).Rollback()
+}
+
+func (t *cacheTx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if tx, ok := t.ConnPool.(gorm.Tx); ok {
+		return tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
+
+func (t *cacheTx) GetDBConn() (*sql.DB, error) {
+	return sqlDB(t.ConnPool)
+}
+
+func sqlDB(pool gorm.ConnPool) (*sql.DB, error) {
+	return (&gorm.DB{Config: &gorm.Config{ConnPool: pool}}).DB()
+}
+
+type condition struct {
+	field  *schema.Field
+	values []interface{}
+}
+
+// exprColumn 匹配 "column = ?" 形式的条件
+var exprColumn = regexp.MustCompile("^\\s*(?:[`\"]?\\w+[`\"]?\\.)?[`\"]?(\\w+)[`\"]?\\s*=\\s*\\?\\s*$")
+
+// conditions 获取 where 中的等值条件，条件之间都为 AND 关系，存在 OR 时返回false
+func (p *CachePlugin) conditions(stmt *gorm.Statement) ([]condition, bool) {
+	c, ok := stmt.Clauses["WHERE"]
+	if !ok {
+		return nil, true
+	}
+	where, ok := c.Expression.(clause.Where)
+	if !ok {
+		return nil, false
+	}
+	return p.flatten(stmt, where.Exprs)
+}
+
+func (p *CachePlugin) flatten(stmt *gorm.Statement, exprs []clause.Expression) ([]condition, bool) {
+	ret := make([]condition, 0, len(exprs))
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.AndConditions:
+			conds, ok := p.flatten(stmt, e.Exprs)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, conds...)
+		case clause.Eq:
+			ret = append(ret, p.condition(stmt, e.Column, []interface{}{e.Value}))
+		case clause.IN:
+			ret = append(ret, p.condition(stmt, e.Column, e.Values))
+		case clause.Expr:
+			if m := exprColumn.FindStringSubmatch(e.SQL); m != nil && len(e.Vars) == 1 {
+				ret = append(ret, p.condition(stmt, m[1], e.Vars))
+			} else {
+				ret = append(ret, condition{})
+			}
+		case clause.OrConditions:
+			return nil, false
+		default:
+			ret = append(ret, condition{})
+		}
+	}
+	return ret, true
+}
+
+// condition 条件的值不是普通的值(例如子查询)时无法确定对应的记录，返回空的条件
+func (p *CachePlugin) condition(stmt *gorm.Statement, column interface{}, values []interface{}) condition {
+	for _, v := range values {
+		switch v.(type) {
+		case *gorm.DB, clause.Expression, nil:
+			return condition{}
+		}
+		if kind := reflect.TypeOf(v).Kind(); kind == reflect.Slice && reflect.TypeOf(v) != reflect.TypeOf([]byte{}) ||
+			kind == reflect.Array || kind == reflect.Map {
+			return condition{}
+		}
+	}
+	return condition{field: p.field(stmt, column), values: values}
+}
+
+// field 获取条件中的列对应的字段，不是当前表的列时返回nil
+func (p *CachePlugin) field(stmt *gorm.Statement, column interface{}) *schema.Field {
+	var name string
+	switch c := column.(type) {
+	case string:
+		name = c
+	case clause.Column:
+		if c.Raw || (c.Table != "" && c.Table != clause.CurrentTable && c.Table != stmt.Schema.Table) {
+			return nil
+		}
+		if c.Name == clause.PrimaryKey {
+			return stmt.Schema.PrioritizedPrimaryField
+		}
+		name = c.Name
+	default:
+		return nil
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		if table := strings.Trim(name[:i], "`\""); table != stmt.Schema.Table {
+			return nil
+		}
+		name = name[i+1:]
+	}
+	return stmt.Schema.LookUpField(strings.Trim(name, "`\""))
+}
+
+func (p *CachePlugin) logError(ctx context.Context, err error) {
+	if err != nil && !cache.IsNil(err) {
+		logger.Ctx(ctx).Warn("gorm cache error", zap.Error(err))
+	}
+}
+
+// cacheValue 将条件的值转换为缓存key中使用的字符串
+func cacheValue(v interface{}) string {
+	if valuer, ok := v.(driver2.Valuer); ok {
+		if value, err := valuer.Value(); err == nil {
+			v = value
+		}
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.IsValid() {
+		v = rv.Interface()
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
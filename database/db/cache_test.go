@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cago-frame/cago/database/cache/memory"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type CacheUser struct {
+	ID       int64  `gorm:"primaryKey"`
+	Username string `gorm:"column:username;uniqueIndex"`
+	Password string `gorm:"column:password" json:"-"`
+	Status   int    `gorm:"column:status"`
+}
+
+func (CacheUser) CacheExpiration() time.Duration {
+	return time.Minute
+}
+
+type CacheArticle struct {
+	ID    int64  `gorm:"primaryKey"`
+	Title string `gorm:"column:title"`
+}
+
+func newCacheDB(t *testing.T) (*gorm.DB, *memory.Cache) {
+	orm, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := orm.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	store, err := memory.NewMemoryCache()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	require.NoError(t, orm.Use(NewCachePlugin(WithCacheStore(store))))
+	require.NoError(t, orm.AutoMigrate(&CacheUser{}, &CacheArticle{}))
+	require.NoError(t, orm.Create(&CacheUser{ID: 1, Username: "admin", Password: "secret", Status: 1}).Error)
+	require.NoError(t, orm.Create(&CacheArticle{ID: 1, Title: "hello"}).Error)
+	return orm, store
+}
+
+func TestCachePlugin(t *testing.T) {
+	ctx := context.Background()
+	orm, store := newCacheDB(t)
+	orm = orm.WithContext(ctx)
+
+	user := &CacheUser{}
+	require.NoError(t, orm.First(user, 1).Error)
+	assert.Equal(t, "secret", user.Password)
+	// 绕过gorm的回调修改数据，缓存中的数据不变
+	require.NoError(t, orm.Exec("UPDATE cache_users SET status = 2 WHERE id = 1").Error)
+	user = &CacheUser{}
+	require.NoError(t, orm.First(user, 1).Error)
+	assert.Equal(t, 1, user.Status)
+	assert.Equal(t, "secret", user.Password)
+	users := make([]*CacheUser, 0)
+	require.NoError(t, orm.Where("id = ?", 1).Find(&users).Error)
+	require.Len(t, users, 1)
+	assert.Equal(t, 1, users[0].Status)
+	// 不满足缓存条件的查询
+	users = make([]*CacheUser, 0)
+	require.NoError(t, orm.Where("id = ? AND status = ?", 1, 2).Find(&users).Error)
+	assert.Len(t, users, 1)
+	// 跳过缓存
+	user = &CacheUser{}
+	require.NoError(t, orm.Scopes(SkipCache()).First(user, 1).Error)
+	assert.Equal(t, 2, user.Status)
+
+	// 唯一键
+	user = &CacheUser{}
+	require.NoError(t, orm.Where("username = ?", "admin").First(user).Error)
+	assert.Equal(t, int64(1), user.ID)
+	ok, err := store.Has(ctx, "gorm:cache:cache_users:username:admin")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 更新后失效
+	require.NoError(t, orm.Model(user).Update("status", 3).Error)
+	user = &CacheUser{}
+	require.NoError(t, orm.First(user, 1).Error)
+	assert.Equal(t, 3, user.Status)
+	// 修改唯一键后，旧的唯一键不会查询到数据
+	require.NoError(t, orm.Model(user).Update("username", "root").Error)
+	err = orm.Where("username = ?", "admin").First(&CacheUser{}).Error
+	assert.True(t, RecordNotFound(err))
+	user = &CacheUser{}
+	require.NoError(t, orm.Where(&CacheUser{Username: "root"}).First(user).Error)
+	assert.Equal(t, int64(1), user.ID)
+
+	// 按条件更新时通过表标签删除整张表的缓存，其它表的缓存不受影响
+	require.NoError(t, orm.Scopes(UseCache(time.Minute)).First(&CacheArticle{}, 1).Error)
+	ok, err = store.Has(ctx, "gorm:cache:cache_articles:id:1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, orm.Model(&CacheUser{}).Where("status = ?", 3).Update("status", 4).Error)
+	for _, key := range []string{"gorm:cache:cache_users:id:1", "gorm:cache:cache_users:username:root"} {
+		ok, err = store.Has(ctx, key)
+		require.NoError(t, err)
+		assert.False(t, ok, key)
+	}
+	ok, err = store.Has(ctx, "gorm:cache:cache_articles:id:1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 删除后失效
+	require.NoError(t, orm.First(&CacheUser{}, 1).Error)
+	require.NoError(t, orm.Delete(&CacheUser{}, 1).Error)
+	err = orm.First(&CacheUser{}, 1).Error
+	assert.True(t, RecordNotFound(err))
+
+	// 事务中不使用缓存
+	require.NoError(t, orm.Create(&CacheUser{ID: 2, Username: "user", Status: 1}).Error)
+	require.NoError(t, orm.Transaction(func(tx *gorm.DB) error {
+		return tx.First(&CacheUser{}, 2).Error
+	}))
+	ok, err = store.Has(ctx, "gorm:cache:cache_users:id:2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestCachePlugin_Transaction(t *testing.T) {
+	ctx := context.Background()
+	orm, store := newCacheDB(t)
+	orm = orm.WithContext(ctx)
+	key := "gorm:cache:cache_users:id:1"
+
+	// 事务提交之后才删除缓存
+	require.NoError(t, orm.First(&CacheUser{}, 1).Error)
+	require.NoError(t, orm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&CacheUser{ID: 1}).Update("status", 2).Error; err != nil {
+			return err
+		}
+		ok, err := store.Has(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		// 嵌套事务
+		return tx.Transaction(func(tx *gorm.DB) error {
+			return tx.Model(&CacheUser{}).Where("status = ?", 2).Update("status", 3).Error
+		})
+	}))
+	ok, err := store.Has(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	user := &CacheUser{}
+	require.NoError(t, orm.First(user, 1).Error)
+	assert.Equal(t, 3, user.Status)
+
+	// 回滚时不删除缓存
+	err = orm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&CacheUser{}, 1).Error; err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	assert.EqualError(t, err, "rollback")
+	ok, err = store.Has(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 手动开启的事务与预编译模式
+	tx := orm.Session(&gorm.Session{PrepareStmt: true}).Begin()
+	require.NoError(t, tx.Model(&CacheUser{ID: 1}).Update("status", 4).Error)
+	ok, err = store.Has(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, tx.Commit().Error)
+	ok, err = store.Has(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = orm.DB()
+	assert.NoError(t, err)
+}
+
+func TestUseCache(t *testing.T) {
+	ctx := context.Background()
+	orm, store := newCacheDB(t)
+	orm = orm.WithContext(ctx)
+
+	// 没有实现 CacheableModel 的模型默认不缓存
+	require.NoError(t, orm.First(&CacheArticle{}, 1).Error)
+	ok, err := store.Has(ctx, "gorm:cache:cache_articles:id:1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	article := &CacheArticle{}
+	require.NoError(t, orm.Scopes(UseCache(time.Minute)).First(article, 1).Error)
+	ok, err = store.Has(ctx, "gorm:cache:cache_articles:id:1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 主键在结果中
+	require.NoError(t, orm.Exec("UPDATE cache_articles SET title = 'world' WHERE id = 1").Error)
+	article = &CacheArticle{ID: 1}
+	require.NoError(t, orm.Scopes(UseCache(0)).First(article).Error)
+	assert.Equal(t, "hello", article.Title)
+
+	require.NoError(t, orm.Save(&CacheArticle{ID: 1, Title: "cago"}).Error)
+	article = &CacheArticle{}
+	require.NoError(t, orm.Scopes(UseCache(0)).Take(article, "id = ?", 1).Error)
+	assert.Equal(t, "cago", article.Title)
+}
@@ -43,6 +43,9 @@ type Config struct {
 	//ReaderDsn []string `yaml:"readerDsn,omitempty"` // 读取数据源
 	// gorm配置
 	PrepareStmt bool `yaml:"prepareStmt,omitempty"` // 是否开启预编译
+	// 开启查询缓存插件，缓存主键与唯一键查询的结果，使用 cache.Default()
+	// 需要使用 UseCache 或者模型实现 CacheableModel 才会生效
+	Cache bool `yaml:"cache,omitempty"`
 }
 
 type GroupConfig map[string]*Config
@@ -108,12 +111,23 @@ func (d *DB) newDB(cfg *Config, debug bool) (*gorm.DB, error) {
 			return nil, err
 		}
 	}
+	if cfg.Cache {
+		if err := orm.Use(NewCachePlugin()); err != nil {
+			return nil, err
+		}
+	}
 	if cfg.Debug {
 		orm = orm.Debug()
 	}
 	return orm, nil
 }
 
+// Open 根据配置创建一个数据库实例，不会设置为默认数据库
+// 适用于测试或者需要临时连接其他数据库的场景
+func Open(cfg *Config) (*gorm.DB, error) {
+	return (&DB{}).newDB(cfg, false)
+}
+
 func (d *DB) Start(ctx context.Context, config *configs.Config) error {
 	cfg := &Config{}
 	// 数据库group配置
@@ -9,24 +9,18 @@ import (
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
 )
 
-const (
-	ExampleTopic = "example" // 示例消息队列topic
-)
+// ExampleTopic 示例消息队列topic
+var ExampleTopic = broker.NewTopic[*message.ExampleMsg]("example",
+	broker.WithDescription("示例消息"))
 
 // PublishExample 发布示例消息
 func PublishExample(ctx context.Context, msg *message.ExampleMsg) error {
-	return broker.Default().Publish(ctx, ExampleTopic, &broker2.Message{
-		Body: msg.Marshal(),
-	})
+	return ExampleTopic.Publish(ctx, msg)
 }
 
 // SubscribeExample 订阅示例消息
 func SubscribeExample(ctx context.Context, fn func(ctx context.Context, msg *message.ExampleMsg) error) error {
-	_, err := broker.Default().Subscribe(ctx, ExampleTopic, func(ctx context.Context, event broker2.Event) error {
-		msg := &message.ExampleMsg{}
-		if err := msg.Unmarshal(event.Message().Body); err != nil {
-			return err
-		}
+	_, err := ExampleTopic.Subscribe(ctx, func(ctx context.Context, msg *message.ExampleMsg, event broker2.Event) error {
 		return fn(ctx, msg)
 	}, broker2.Retry())
 	return err
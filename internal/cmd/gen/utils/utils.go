@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 	"unicode"
@@ -273,6 +274,41 @@ func ParseTag(tag string, key string) string {
 	return value
 }
 
+// ParseTags 按照出现的顺序解析结构体标签的所有键值，格式与 reflect.StructTag 一致
+func ParseTags(tag string) [][2]string {
+	var ret [][2]string
+	s := tag
+	for s != "" {
+		s = strings.TrimLeft(s, " ")
+		i := 0
+		for i < len(s) && s[i] > ' ' && s[i] != ':' && s[i] != '"' && s[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(s) || s[i] != ':' || s[i+1] != '"' {
+			break
+		}
+		name := s[:i]
+		s = s[i+1:]
+		i = 1
+		for i < len(s) && s[i] != '"' {
+			if s[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		value, err := strconv.Unquote(s[:i+1])
+		if err != nil {
+			break
+		}
+		s = s[i+1:]
+		ret = append(ret, [2]string{name, value})
+	}
+	return ret
+}
+
 func FileNameToCamel(filename string) string {
 	return UpperFirstChar(ToCamel(strings.TrimSuffix(path.Base(filename), ".go")))
 }
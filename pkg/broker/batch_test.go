@@ -0,0 +1,148 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// batchBroker 原生支持批量消费的syncBroker
+type batchBroker struct {
+	*syncBroker
+	batchHandlers map[string]broker2.BatchHandler
+}
+
+func (b *batchBroker) SubscribeBatch(ctx context.Context, topic string, h broker2.BatchHandler,
+	opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	b.batchHandlers[topic] = h
+	return nil, nil
+}
+
+func TestPublishBatch(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	raw := newSyncBroker()
+	b, err := New(WithBroker(raw), WithTopicPrefix("app"), WithMeter(provider.Meter("test")),
+		WithPublishInterceptor(func(ctx context.Context, topic string, data *broker2.Message,
+			next PublishInvoker, opts ...broker2.PublishOption) error {
+			if string(data.Body) == "audit" {
+				topic = "audit"
+			}
+			data.Header["tenant"] = "t1"
+			return next(ctx, topic, data, opts...)
+		}))
+	require.NoError(t, err)
+
+	msgs := []*broker2.Message{{Body: []byte("1")}, {Body: []byte("2")}, {Body: []byte("audit")}}
+	require.NoError(t, broker2.PublishBatch(ctx, b, "order", msgs))
+	require.Len(t, raw.published["app.order"], 2)
+	require.Len(t, raw.published["app.audit"], 1)
+	for _, msg := range append(raw.published["app.order"], raw.published["app.audit"]...) {
+		assert.NotEmpty(t, broker2.MessageID(msg))
+		assert.Equal(t, "t1", msg.Header["tenant"])
+	}
+	// 不修改调用方的消息
+	for _, msg := range msgs {
+		assert.Nil(t, msg.Header)
+	}
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(ctx, &rm))
+	assert.Equal(t, int64(3), sumOf(t, rm, "broker_published_total", ""))
+}
+
+// publishBatchBroker 原生支持批量发布的syncBroker，记录每一批的发布选项
+type publishBatchBroker struct {
+	*syncBroker
+	batches []publishedBatch
+}
+
+type publishedBatch struct {
+	topic   string
+	size    int
+	options broker2.PublishOptions
+}
+
+func (b *publishBatchBroker) PublishBatch(ctx context.Context, topic string, data []*broker2.Message,
+	opts ...broker2.PublishOption) error {
+	b.batches = append(b.batches, publishedBatch{topic: topic, size: len(data), options: broker2.NewPublishOptions(opts...)})
+	return nil
+}
+
+func TestPublishBatch_Options(t *testing.T) {
+	ctx := context.Background()
+	raw := &publishBatchBroker{syncBroker: newSyncBroker()}
+	deliverAt := time.Now().Add(time.Hour)
+	b, err := New(WithBroker(raw),
+		WithPublishInterceptor(func(ctx context.Context, topic string, data *broker2.Message,
+			next PublishInvoker, opts ...broker2.PublishOption) error {
+			// 修改了发布选项的消息单独发布
+			if string(data.Body) == "delay" {
+				opts = append(opts, broker2.WithDeliverAt(deliverAt))
+			}
+			return next(ctx, topic, data, opts...)
+		}))
+	require.NoError(t, err)
+
+	msgs := []*broker2.Message{{Body: []byte("1")}, {Body: []byte("delay")}, {Body: []byte("2")}, {Body: []byte("3")}}
+	require.NoError(t, broker2.PublishBatch(ctx, b, "order", msgs, broker2.WithPublishContext(ctx)))
+	require.Len(t, raw.batches, 3)
+	assert.Equal(t, 1, raw.batches[0].size)
+	assert.True(t, raw.batches[0].options.DeliverAt.IsZero())
+	assert.Equal(t, 1, raw.batches[1].size)
+	assert.Equal(t, deliverAt, raw.batches[1].options.DeliverAt)
+	assert.Equal(t, 2, raw.batches[2].size)
+	assert.True(t, raw.batches[2].options.DeliverAt.IsZero())
+}
+
+func TestSubscribeBatch(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	raw := &batchBroker{syncBroker: newSyncBroker(), batchHandlers: make(map[string]broker2.BatchHandler)}
+	b, err := New(WithBroker(raw), WithTopicPrefix("app"), WithDefaultGroup("group"),
+		WithMeter(provider.Meter("test")))
+	require.NoError(t, err)
+
+	_, err = broker2.SubscribeBatch(ctx, b, "order", func(ctx context.Context, events []broker2.Event) error {
+		return nil
+	}, broker2.WithRetryPolicy(broker2.RetryPolicy{}))
+	assert.ErrorIs(t, err, ErrBatchUnsupportedOption)
+
+	var size int
+	_, err = broker2.SubscribeBatch(ctx, b, "order", func(ctx context.Context, events []broker2.Event) error {
+		size = len(events)
+		// 显式确认的消息不再按照选项推断
+		return events[0].Ack()
+	})
+	require.NoError(t, err)
+	_, err = broker2.SubscribeBatch(ctx, b, "failed", func(ctx context.Context, events []broker2.Event) error {
+		return errors.New("failed")
+	}, broker2.Group("failed"), broker2.Retry())
+	require.NoError(t, err)
+
+	events := []broker2.Event{
+		&testEvent{topic: "app.order", msg: &broker2.Message{}},
+		&testEvent{topic: "app.order", msg: &broker2.Message{}},
+		&testEvent{topic: "app.order", msg: &broker2.Message{}},
+	}
+	require.NoError(t, raw.batchHandlers["app.order"](ctx, events))
+	assert.Equal(t, 3, size)
+	assert.True(t, events[0].(*testEvent).acked)
+	assert.Error(t, raw.batchHandlers["app.failed"](ctx, events[:2]))
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(ctx, &rm))
+	assert.Equal(t, int64(3), sumOf(t, rm, "broker_consumed_total", "group"))
+	assert.Equal(t, int64(3), sumOf(t, rm, "broker_acked_total", "group"))
+	assert.Equal(t, int64(2), sumOf(t, rm, "broker_failed_total", "failed"))
+	assert.Equal(t, int64(2), sumOf(t, rm, "broker_requeued_total", "failed"))
+}
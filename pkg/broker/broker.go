@@ -17,6 +17,7 @@ import (
 	"go.uber.org/zap"
 
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/broker/scheduler"
 )
 
 type Type string
@@ -25,12 +26,22 @@ const (
 	NSQ      Type = "nsq"
 	EventBus Type = "event_bus"
 	Kafka    Type = "kafka"
+	// RedisStream 使用 Redis Streams，需要 import _ "github.com/cago-frame/cago/pkg/broker/redis_stream"
+	RedisStream Type = "redis_stream"
+	// SQL 使用数据库表，需要 import _ "github.com/cago-frame/cago/pkg/broker/sql"
+	SQL Type = "sql"
 )
 
 // Config broker 基础配置。具体 broker 的配置（如 broker.nsq、broker.kafka）
 // 由各 broker 子包在自己的 init() factory 里从 *configs.Config 中 Scan。
 type Config struct {
 	Type Type `yaml:"type"`
+	// Scheduler 延迟消息调度器，broker不支持原生延迟发布时使用
+	Scheduler scheduler.Config `yaml:"scheduler"`
+	// DrainTimeout 停止时等待订阅者处理完消息的最长时间，默认为5秒，需要小于应用停止时等待的10秒
+	DrainTimeout time.Duration `yaml:"drainTimeout"`
+	// ReplyTopic 当前实例接收回复的topic，为空时随机生成，见 WithReplyTopic
+	ReplyTopic string `yaml:"replyTopic"`
 }
 
 // NewWithConfig 根据配置构建 broker。要求用户已经通过
@@ -56,6 +67,20 @@ func NewWithConfig(ctx context.Context, config *configs.Config, opts ...Option)
 		return nil, err
 	}
 	opts = append(opts, WithBroker(ret))
+	if cfg.DrainTimeout > 0 {
+		opts = append(opts, WithDrainTimeout(cfg.DrainTimeout))
+	}
+	if cfg.ReplyTopic != "" {
+		opts = append(opts, WithReplyTopic(cfg.ReplyTopic))
+	}
+	if cfg.Scheduler.Store != "" {
+		s, err := scheduler.NewWithConfig(cfg.Scheduler)
+		if err != nil {
+			_ = ret.Close()
+			return nil, err
+		}
+		opts = append(opts, WithScheduler(s))
+	}
 	return New(opts...)
 }
 
@@ -70,7 +95,7 @@ func New(opts ...Option) (broker2.Broker, error) {
 	wrapHandler.Wrap(func(ctx *wrap2.Context) {
 		sctx := ctx.Context
 		switch ctx.Name() {
-		case "Subscribe":
+		case "Subscribe", "SubscribeBatch":
 			topic := ctx.Args(0).(string)
 			options := ctx.Args(2).(broker2.SubscribeOptions)
 			sctx = logger.WithContextLogger(sctx, logger.Ctx(sctx).With(
@@ -111,6 +136,26 @@ func New(opts ...Option) (broker2.Broker, error) {
 				}
 				otel.GetTextMapPropagator().Inject(sctx, propagation.MapCarrier(data.Header))
 				ctx = ctx.WithContext(sctx)
+			case "PublishBatch":
+				topic := ctx.Args(0).(string)
+				data := ctx.Args(1).([]*broker2.Message)
+				sctx, span := options.tracer.Start(sctx, "Broker."+ctx.Name(),
+					trace.WithAttributes(
+						attribute.String("messaging.system", ret.String()),
+						attribute.String("messaging.destination", topic),
+						attribute.String("messaging.destination_kind", "queue"),
+						attribute.Int("messaging.batch.message_count", len(data)),
+					),
+					trace.WithSpanKind(trace.SpanKindProducer),
+				)
+				defer span.End()
+				for _, v := range data {
+					if v.Header == nil {
+						v.Header = make(map[string]string)
+					}
+					otel.GetTextMapPropagator().Inject(sctx, propagation.MapCarrier(v.Header))
+				}
+				ctx = ctx.WithContext(sctx)
 			case "Subscribe":
 				event := ctx.Args(1).(broker2.Event)
 				soptions := ctx.Args(2).(broker2.SubscribeOptions)
@@ -130,9 +175,53 @@ func New(opts ...Option) (broker2.Broker, error) {
 					trace2.LoggerLabel(sctx)...,
 				))
 				ctx = ctx.WithContext(sctx)
+			case "SubscribeBatch":
+				// 一批消息来自不同的链路，使用 link 关联每条消息的发布链路
+				topic := ctx.Args(0).(string)
+				events := ctx.Args(1).([]broker2.Event)
+				soptions := ctx.Args(2).(broker2.SubscribeOptions)
+				links := make([]trace.Link, 0, len(events))
+				for _, event := range events {
+					ectx := otel.GetTextMapPropagator().Extract(sctx, propagation.MapCarrier(event.Message().Header))
+					if sc := trace.SpanContextFromContext(ectx); sc.IsValid() {
+						links = append(links, trace.Link{SpanContext: sc})
+					}
+				}
+				sctx, span := options.tracer.Start(sctx, "Broker."+ctx.Name(),
+					trace.WithAttributes(
+						attribute.String("messaging.system", ret.String()),
+						attribute.String("messaging.operation", "process"),
+						attribute.String("messaging.destination", topic),
+						attribute.String("messaging.destination_kind", "queue"),
+						attribute.String("messaging.group", soptions.Group),
+						attribute.Int("messaging.batch.message_count", len(events)),
+					),
+					trace.WithLinks(links...),
+					trace.WithSpanKind(trace.SpanKindConsumer),
+				)
+				defer span.End()
+				sctx = logger.WithContextLogger(sctx, logger.Ctx(sctx).With(
+					trace2.LoggerLabel(sctx)...,
+				))
+				ctx = ctx.WithContext(sctx)
 			}
 			ctx.Next()
 		})
 	}
+	if options.meter != nil {
+		m, err := newMetrics(options.meter, ret.String())
+		if err != nil {
+			return nil, err
+		}
+		options.metrics = m
+		wrapHandler.Wrap(m.handler)
+	}
+	if options.scheduler != nil {
+		// 调度器直接发布到原始的broker，不经过包装：保存时topic已经包含前缀，拦截器、链路追踪与 CloudEvents 已经执行过，
+		// 发布的指标也已经记录，再经过包装会重复处理
+		if err := options.scheduler.Start(ret); err != nil {
+			return nil, err
+		}
+	}
 	return newWrap(ret, wrapHandler, options), nil
 }
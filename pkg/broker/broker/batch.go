@@ -0,0 +1,263 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// BatchHandler 批量处理消息，返回的错误对整批消息生效
+// 没有显式 Ack 或 Requeue 的消息按照 AutoAck 与 Retry 选项处理
+type BatchHandler func(ctx context.Context, events []Event) error
+
+// BatchPublisher 原生支持批量发布的broker实现该接口
+type BatchPublisher interface {
+	// PublishBatch 发布一批消息到同一个topic
+	PublishBatch(ctx context.Context, topic string, data []*Message, opts ...PublishOption) error
+}
+
+// BatchSubscriber 原生支持批量消费的broker实现该接口
+type BatchSubscriber interface {
+	// SubscribeBatch 批量订阅topic消息，凑满 BatchSize 条或者等待超过 BatchWait 后调用 h
+	SubscribeBatch(ctx context.Context, topic string, h BatchHandler, opts ...SubscribeOption) (Subscriber, error)
+}
+
+const (
+	// DefaultBatchSize 默认每批最多的消息数量
+	DefaultBatchSize = 100
+	// DefaultBatchWait 默认凑批的最长等待时间
+	DefaultBatchWait = time.Second
+)
+
+// WithBatch 设置批量消费每批最多的消息数量与凑批的最长等待时间
+func WithBatch(size int, wait time.Duration) SubscribeOption {
+	return func(options *SubscribeOptions) {
+		options.BatchSize = size
+		options.BatchWait = wait
+	}
+}
+
+// PublishBatch 批量发布消息，broker没有实现 BatchPublisher 时逐条发布，遇到错误时停止
+func PublishBatch(ctx context.Context, b Broker, topic string, data []*Message, opts ...PublishOption) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if p, ok := b.(BatchPublisher); ok {
+		return p.PublishBatch(ctx, topic, data, opts...)
+	}
+	for i, msg := range data {
+		if err := b.Publish(ctx, topic, msg, opts...); err != nil {
+			return fmt.Errorf("broker: publish batch message %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// SubscribeBatch 批量订阅消息，broker没有实现 BatchSubscriber 时使用逐条订阅凑批
+// 凑批时以 NotAutoAck 订阅，整批处理完成后再按照 AutoAck 与 Retry 选项确认或者重新入队每一条消息，
+// 同时处理的批次不超过 Concurrent；nsq 需要 max-in-flight 不小于 BatchSize 才能凑满一批
+func SubscribeBatch(ctx context.Context, b Broker, topic string, h BatchHandler, opts ...SubscribeOption) (Subscriber, error) {
+	if s, ok := b.(BatchSubscriber); ok {
+		return s.SubscribeBatch(ctx, topic, h, opts...)
+	}
+	bt := newBatcher(h, NewSubscribeOptions(opts...))
+	opts = append(opts, NotAutoAck())
+	sub, err := b.Subscribe(ctx, topic, bt.handle, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &batchSubscriber{Subscriber: sub, batcher: bt}, nil
+}
+
+// batchSubscriber 凑批的订阅者
+type batchSubscriber struct {
+	Subscriber
+	batcher *batcher
+}
+
+// Drain 不再凑批，已经凑到的消息在后台立即处理，停止订阅期间收到的消息也会立即处理，
+// 部分broker(例如nsq)停止订阅时会等待没有确认的消息，凑批中的消息不能等到凑满才处理；最后等待所有批次完成
+func (s *batchSubscriber) Drain(ctx context.Context) error {
+	s.batcher.close()
+	if err := s.Subscriber.Drain(ctx); err != nil {
+		return err
+	}
+	s.batcher.flushNow()
+	return Wait(ctx, &s.batcher.wg)
+}
+
+// batchRequeueDelay 凑批处理失败后重新入队的延迟
+func batchRequeueDelay(attempted int) time.Duration {
+	return min(time.Duration(max(attempted, 1))*time.Second, time.Minute)
+}
+
+// batch 正在凑的一批消息
+type batch struct {
+	events []Event
+	timer  *time.Timer
+}
+
+// batcher 把逐条投递的消息凑成一批
+type batcher struct {
+	sync.Mutex
+	h       BatchHandler
+	options SubscribeOptions
+	current *batch
+	// closed 不再凑批，收到的消息立即处理
+	closed bool
+	// running 限制同时处理的批次
+	running chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newBatcher(h BatchHandler, options SubscribeOptions) *batcher {
+	return &batcher{
+		h:       h,
+		options: options,
+		running: make(chan struct{}, max(options.Concurrent, 1)),
+	}
+}
+
+// handle 把消息加入当前批次，凑满一批时在当前协程处理，处理的批次过多时会阻塞
+func (b *batcher) handle(_ context.Context, event Event) error {
+	b.Lock()
+	cur := b.current
+	if cur == nil {
+		cur = &batch{events: make([]Event, 0, b.options.BatchSize)}
+		cur.timer = time.AfterFunc(b.options.BatchWait, func() {
+			b.flush(cur)
+		})
+		b.current = cur
+	}
+	cur.events = append(cur.events, &batchEvent{Event: event})
+	full := len(cur.events) >= b.options.BatchSize || b.closed
+	if full {
+		b.detach()
+	}
+	b.Unlock()
+	if full {
+		cur.timer.Stop()
+		b.run(cur.events)
+	}
+	return nil
+}
+
+// flush 等待超时后处理没有凑满的批次
+func (b *batcher) flush(cur *batch) {
+	b.Lock()
+	if b.current != cur {
+		b.Unlock()
+		return
+	}
+	b.detach()
+	b.Unlock()
+	b.run(cur.events)
+}
+
+// flushNow 不再等待，立即处理当前的批次
+func (b *batcher) flushNow() {
+	b.Lock()
+	cur := b.current
+	if cur != nil {
+		b.detach()
+	}
+	b.Unlock()
+	if cur != nil {
+		cur.timer.Stop()
+		b.run(cur.events)
+	}
+}
+
+// close 不再凑批，并在后台立即处理当前的批次
+func (b *batcher) close() {
+	b.Lock()
+	b.closed = true
+	cur := b.current
+	if cur != nil {
+		b.detach()
+	}
+	b.Unlock()
+	if cur != nil {
+		cur.timer.Stop()
+		go b.run(cur.events)
+	}
+}
+
+// detach 取出当前批次，需要持有锁，在取出时计数，等待批次完成时不会遗漏已经取出还没有开始处理的批次
+func (b *batcher) detach() {
+	b.current = nil
+	b.wg.Add(1)
+}
+
+// run 处理取出的批次，需要先调用 detach
+func (b *batcher) run(events []Event) {
+	defer b.wg.Done()
+	b.running <- struct{}{}
+	defer func() {
+		<-b.running
+	}()
+	ctx := b.options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err := b.call(ctx, events)
+	if err != nil {
+		logger.Ctx(ctx).Error("broker batch handle error", zap.String("topic", events[0].Topic()),
+			zap.String("group", b.options.Group), zap.Int("batch", len(events)), zap.Error(err))
+	}
+	for _, v := range events {
+		event := v.(*batchEvent)
+		if event.acted.Load() {
+			continue
+		}
+		var actErr error
+		switch {
+		case err == nil && b.options.AutoAck:
+			actErr = event.Ack()
+		case err != nil && b.options.Retry:
+			actErr = event.Requeue(batchRequeueDelay(event.Attempted()))
+		case err != nil && b.options.AutoAck:
+			actErr = event.Ack()
+		}
+		if actErr != nil {
+			logger.Ctx(ctx).Error("broker batch ack error", zap.String("topic", event.Topic()),
+				zap.String("group", b.options.Group), zap.Error(actErr))
+		}
+	}
+}
+
+func (b *batcher) call(ctx context.Context, events []Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("broker: batch handler panic: %v", r)
+		}
+	}()
+	return b.h(ctx, events)
+}
+
+// batchEvent 记录批次中的消息是否已经显式 Ack 或 Requeue
+type batchEvent struct {
+	Event
+	acted atomic.Bool
+}
+
+func (e *batchEvent) Ack() error {
+	if err := e.Event.Ack(); err != nil {
+		return err
+	}
+	e.acted.Store(true)
+	return nil
+}
+
+func (e *batchEvent) Requeue(delay time.Duration) error {
+	if err := e.Event.Requeue(delay); err != nil {
+		return err
+	}
+	e.acted.Store(true)
+	return nil
+}
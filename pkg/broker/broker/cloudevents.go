@@ -0,0 +1,314 @@
+package broker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+)
+
+// ErrNotCloudEvent 消息不是 CloudEvents 格式，或者缺少必需的属性
+var ErrNotCloudEvent = errors.New("broker: message is not a cloud event")
+
+// CloudEvents 1.0 二进制模式的消息头，与 Kafka 协议绑定一致
+const (
+	HeaderCloudEventsSpecVersion = "ce_specversion"
+	HeaderCloudEventsID          = "ce_id"
+	HeaderCloudEventsSource      = "ce_source"
+	HeaderCloudEventsType        = "ce_type"
+	HeaderCloudEventsSubject     = "ce_subject"
+	HeaderCloudEventsTime        = "ce_time"
+	HeaderCloudEventsTraceParent = "ce_traceparent"
+	// HeaderCloudEventsContentType 二进制模式下为 datacontenttype，结构化模式下为 CloudEventsJSON
+	HeaderCloudEventsContentType = "content-type"
+
+	// CloudEventsSpecVersion 支持的 CloudEvents 版本
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsJSON 结构化模式的消息类型
+	CloudEventsJSON = "application/cloudevents+json"
+
+	// headerTraceParent w3c 链路追踪使用的消息头
+	headerTraceParent = "traceparent"
+)
+
+// CloudEventsMode CloudEvents 的传输模式
+type CloudEventsMode int
+
+const (
+	// CloudEventsBinary 二进制模式，属性放在消息头中，消息体不变
+	CloudEventsBinary CloudEventsMode = iota
+	// CloudEventsStructured 结构化模式，属性与数据一起编码为 json 消息体
+	CloudEventsStructured
+)
+
+// CloudEventsOptions 发布时设置的 CloudEvents 属性
+type CloudEventsOptions struct {
+	Mode CloudEventsMode
+	// Source 事件的来源，必填，例如 "/order-service"
+	Source string
+	// Type 事件的类型，必填，例如 "com.example.order.created"
+	Type    string
+	Subject string
+	// DataContentType 数据的类型，为空时根据 HeaderContentType 推断
+	DataContentType string
+}
+
+// CloudEvent 消息的 CloudEvents 属性
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time,omitempty"`
+	DataContentType string    `json:"datacontenttype,omitempty"`
+	TraceParent     string    `json:"traceparent,omitempty"`
+}
+
+// structuredEvent 结构化模式的消息体
+type structuredEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	TraceParent     string          `json:"traceparent,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// WithCloudEvents 发布时按照 CloudEvents 1.0 设置消息，需要使用 broker.New 包装后的broker
+// id 使用消息ID，time 为发布时间，traceparent 来自链路追踪注入的消息头
+func WithCloudEvents(opts CloudEventsOptions) PublishOption {
+	return func(options *PublishOptions) {
+		options.CloudEvents = &opts
+	}
+}
+
+// ReceiveCloudEvents 消费时把结构化模式的消息转换为二进制模式，需要使用 broker.New 包装后的broker
+// 处理函数收到的消息体为事件的数据，属性可以通过 CloudEventOf 获取
+func ReceiveCloudEvents() SubscribeOption {
+	return func(options *SubscribeOptions) {
+		options.CloudEvents = true
+	}
+}
+
+// CloudEventOf 获取事件的 CloudEvents 属性，支持二进制与结构化模式
+func CloudEventOf(event Event) (*CloudEvent, error) {
+	return ParseCloudEvent(event.Message())
+}
+
+// ParseCloudEvent 获取消息的 CloudEvents 属性，支持二进制与结构化模式
+func ParseCloudEvent(msg *Message) (*CloudEvent, error) {
+	if isStructured(msg) {
+		se, err := parseStructured(msg)
+		if err != nil {
+			return nil, err
+		}
+		return se.cloudEvent()
+	}
+	ce := &CloudEvent{
+		SpecVersion:     msg.Header[HeaderCloudEventsSpecVersion],
+		ID:              msg.Header[HeaderCloudEventsID],
+		Source:          msg.Header[HeaderCloudEventsSource],
+		Type:            msg.Header[HeaderCloudEventsType],
+		Subject:         msg.Header[HeaderCloudEventsSubject],
+		DataContentType: msg.Header[HeaderCloudEventsContentType],
+		TraceParent:     msg.Header[HeaderCloudEventsTraceParent],
+	}
+	if t := msg.Header[HeaderCloudEventsTime]; t != "" {
+		var err error
+		if ce.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return nil, fmt.Errorf("%w: invalid time %q", ErrNotCloudEvent, t)
+		}
+	}
+	if err := ce.validate(); err != nil {
+		return nil, err
+	}
+	return ce, nil
+}
+
+// EncodeCloudEvent 按照选项返回 CloudEvents 格式的消息，不会修改 msg
+func EncodeCloudEvent(msg *Message, opts *CloudEventsOptions, now time.Time) (*Message, error) {
+	header := make(map[string]string, len(msg.Header)+8)
+	maps.Copy(header, msg.Header)
+	ret := &Message{Header: header, Body: msg.Body}
+	if err := encodeCloudEvent(ret, opts, now); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// encodeCloudEvent 把消息设置为 CloudEvents 格式，会修改 msg
+func encodeCloudEvent(msg *Message, opts *CloudEventsOptions, now time.Time) error {
+	ce := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              msg.Header[HeaderMessageID],
+		Source:          opts.Source,
+		Type:            opts.Type,
+		Subject:         opts.Subject,
+		Time:            now,
+		DataContentType: opts.DataContentType,
+		TraceParent:     msg.Header[headerTraceParent],
+	}
+	if ce.ID == "" {
+		ce.ID = fmt.Sprintf("%d", now.UnixNano())
+	}
+	if ce.DataContentType == "" {
+		ce.DataContentType = mediaType(msg.Header[HeaderContentType])
+	}
+	if err := ce.validate(); err != nil {
+		return err
+	}
+	if opts.Mode == CloudEventsStructured {
+		return encodeStructured(msg, ce)
+	}
+	msg.Header[HeaderCloudEventsSpecVersion] = ce.SpecVersion
+	msg.Header[HeaderCloudEventsID] = ce.ID
+	msg.Header[HeaderCloudEventsSource] = ce.Source
+	msg.Header[HeaderCloudEventsType] = ce.Type
+	msg.Header[HeaderCloudEventsTime] = ce.Time.Format(time.RFC3339Nano)
+	setHeader(msg.Header, HeaderCloudEventsSubject, ce.Subject)
+	setHeader(msg.Header, HeaderCloudEventsContentType, ce.DataContentType)
+	setHeader(msg.Header, HeaderCloudEventsTraceParent, ce.TraceParent)
+	return nil
+}
+
+// DecodeCloudEvent 把结构化模式的消息转换为二进制模式，会修改 msg
+// 没有 traceparent 消息头时使用事件的 traceparent，以便继续链路追踪
+func DecodeCloudEvent(msg *Message) error {
+	if msg.Header == nil {
+		msg.Header = make(map[string]string)
+	}
+	if isStructured(msg) {
+		se, err := parseStructured(msg)
+		if err != nil {
+			return err
+		}
+		ce, err := se.cloudEvent()
+		if err != nil {
+			return err
+		}
+		body := []byte(se.Data)
+		if se.DataBase64 != "" {
+			if body, err = base64.StdEncoding.DecodeString(se.DataBase64); err != nil {
+				return fmt.Errorf("%w: invalid data_base64", ErrNotCloudEvent)
+			}
+		}
+		delete(msg.Header, HeaderCloudEventsContentType)
+		if err := encodeCloudEvent(msg, &CloudEventsOptions{
+			Source:          ce.Source,
+			Type:            ce.Type,
+			Subject:         ce.Subject,
+			DataContentType: ce.DataContentType,
+		}, ce.Time); err != nil {
+			return err
+		}
+		msg.Header[HeaderCloudEventsID] = ce.ID
+		setHeader(msg.Header, HeaderCloudEventsTraceParent, ce.TraceParent)
+		msg.Body = body
+	}
+	if tp := msg.Header[HeaderCloudEventsTraceParent]; tp != "" && msg.Header[headerTraceParent] == "" {
+		msg.Header[headerTraceParent] = tp
+	}
+	return nil
+}
+
+func encodeStructured(msg *Message, ce *CloudEvent) error {
+	se := &structuredEvent{
+		SpecVersion:     ce.SpecVersion,
+		ID:              ce.ID,
+		Source:          ce.Source,
+		Type:            ce.Type,
+		Subject:         ce.Subject,
+		Time:            ce.Time.Format(time.RFC3339Nano),
+		DataContentType: ce.DataContentType,
+		TraceParent:     ce.TraceParent,
+	}
+	if len(msg.Body) > 0 {
+		if isJSON(ce.DataContentType) && json.Valid(msg.Body) {
+			se.Data = msg.Body
+		} else {
+			se.DataBase64 = base64.StdEncoding.EncodeToString(msg.Body)
+		}
+	}
+	body, err := json.Marshal(se)
+	if err != nil {
+		return err
+	}
+	msg.Header[HeaderCloudEventsContentType] = CloudEventsJSON
+	msg.Body = body
+	return nil
+}
+
+func isStructured(msg *Message) bool {
+	return strings.HasPrefix(msg.Header[HeaderCloudEventsContentType], CloudEventsJSON)
+}
+
+func parseStructured(msg *Message) (*structuredEvent, error) {
+	se := &structuredEvent{}
+	if err := json.Unmarshal(msg.Body, se); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotCloudEvent, err)
+	}
+	return se, nil
+}
+
+func (se *structuredEvent) cloudEvent() (*CloudEvent, error) {
+	ce := &CloudEvent{
+		SpecVersion:     se.SpecVersion,
+		ID:              se.ID,
+		Source:          se.Source,
+		Type:            se.Type,
+		Subject:         se.Subject,
+		DataContentType: se.DataContentType,
+		TraceParent:     se.TraceParent,
+	}
+	if se.Time != "" {
+		var err error
+		if ce.Time, err = time.Parse(time.RFC3339Nano, se.Time); err != nil {
+			return nil, fmt.Errorf("%w: invalid time %q", ErrNotCloudEvent, se.Time)
+		}
+	}
+	if err := ce.validate(); err != nil {
+		return nil, err
+	}
+	return ce, nil
+}
+
+// validate 检查必需的属性
+func (ce *CloudEvent) validate() error {
+	if ce.SpecVersion != CloudEventsSpecVersion {
+		return fmt.Errorf("%w: unsupported specversion %q", ErrNotCloudEvent, ce.SpecVersion)
+	}
+	if ce.ID == "" || ce.Source == "" || ce.Type == "" {
+		return fmt.Errorf("%w: id, source and type are required", ErrNotCloudEvent)
+	}
+	return nil
+}
+
+// mediaType 把 Codec 的名称转换为 datacontenttype
+func mediaType(codec string) string {
+	switch codec {
+	case JSONCodec.Name():
+		return "application/json"
+	case ProtobufCodec.Name():
+		return "application/protobuf"
+	}
+	return ""
+}
+
+func isJSON(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, "application/json") ||
+		strings.HasSuffix(strings.SplitN(contentType, ";", 2)[0], "+json")
+}
+
+func setHeader(header map[string]string, key, value string) {
+	if value != "" {
+		header[key] = value
+	}
+}
@@ -0,0 +1,62 @@
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cago-frame/cago/pkg/utils/protoutils"
+)
+
+// 类型化topic使用的消息头
+const (
+	// HeaderContentType 消息体的编码，值为 Codec.Name()
+	HeaderContentType = "x-cago-content-type"
+	// HeaderSchemaVersion 消息结构的版本，从1开始
+	HeaderSchemaVersion = "x-cago-schema-version"
+)
+
+// Codec 消息体编解码
+type Codec interface {
+	// Name 编码名称，会写入 HeaderContentType 消息头
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSONCodec 使用 encoding/json 编解码
+	JSONCodec Codec = jsonCodec{}
+	// ProtobufCodec 值必须实现 proto.Message
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	data, err := protoutils.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("broker: protobuf codec: %w", err)
+	}
+	return data, nil
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	if err := protoutils.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("broker: protobuf codec: %w", err)
+	}
+	return nil
+}
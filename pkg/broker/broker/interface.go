@@ -2,6 +2,8 @@ package broker
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"time"
 )
 
@@ -49,4 +51,55 @@ type Subscriber interface {
 	Topic() string
 	// Unsubscribe 取消订阅
 	Unsubscribe() error
+	// Drain 停止拉取新的消息，等待正在处理的消息完成并确认后取消订阅
+	// ctx 结束时不再等待，直接取消订阅并返回 ctx 的错误
+	Drain(ctx context.Context) error
+}
+
+// Wait 等待 wg 完成，ctx 先结束时返回 ctx 的错误
+func Wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DelayPublisher 原生支持延迟发布的broker实现该接口
+// 没有实现或者不支持时，broker.New 包装后的broker会交给调度器投递
+type DelayPublisher interface {
+	// SupportDelay 是否可以原生延迟 d 后投递
+	SupportDelay(d time.Duration) bool
+}
+
+// ErrRequeueUnsupported 消息队列不支持单条消息重新入队时 Event.Requeue 返回的错误
+var ErrRequeueUnsupported = errors.New("broker: requeue is unsupported")
+
+// HeaderMessageID 消息ID，broker.New 包装后的broker发布时会在消息的副本上生成，调用方设置了时不会覆盖
+const HeaderMessageID = "x-cago-message-id"
+
+// 请求与回复使用的消息头
+const (
+	// HeaderReplyTo 接收回复的topic(不包含前缀)
+	HeaderReplyTo = "x-cago-reply-to"
+	// HeaderCorrelationID 关联请求与回复
+	HeaderCorrelationID = "x-cago-correlation-id"
+)
+
+// MessageID 获取消息ID，没有时返回空字符串
+func MessageID(msg *Message) string {
+	return msg.Header[HeaderMessageID]
+}
+
+// Deduplicator 记录消费组处理过的消息ID
+type Deduplicator interface {
+	// Do 消息没有处理过时调用 fn，fn 成功后记录消息ID；处理过时不调用 fn 并返回 duplicate 为 true
+	// fn 的 ctx 可能携带了事务，使用 db.Ctx(ctx) 时数据的修改与消息ID的记录在同一个事务中
+	Do(ctx context.Context, group, id string, fn func(ctx context.Context) error) (duplicate bool, err error)
 }
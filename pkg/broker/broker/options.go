@@ -1,6 +1,13 @@
 package broker
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDelayUnsupported broker 不支持延迟发布，可以使用 broker.WithScheduler 设置调度器
+var ErrDelayUnsupported = errors.New("broker: delayed publish is not supported")
 
 type Option func(*Options)
 
@@ -13,6 +20,10 @@ type Options struct {
 
 type PublishOptions struct {
 	Context context.Context
+	// DeliverAt 消息的投递时间，为零值时立即投递
+	DeliverAt time.Time
+	// CloudEvents 按照 CloudEvents 1.0 设置消息，需要使用 broker.New 包装后的broker
+	CloudEvents *CloudEventsOptions
 	// Values 用于承载 broker 专属数据。key 应使用未导出类型的零值
 	// 以避免跨包冲突；用户不应直接读写此 map，而应通过 broker 子包
 	// 提供的 typed helper（如 kafka.WithKey）。
@@ -20,11 +31,22 @@ type PublishOptions struct {
 }
 
 type SubscribeOptions struct {
-	Context    context.Context
-	AutoAck    bool
-	Group      string
+	Context context.Context
+	AutoAck bool
+	Group   string
+	// Retry 处理失败时使用消息队列本身的机制重新投递
 	Retry      bool
 	Concurrent int
+	// RetryPolicy 处理失败时按策略重试，并在超过次数后发送到死信队列，需要使用 broker.New 包装后的broker
+	RetryPolicy *RetryPolicy
+	// Deduplicator 跳过消费组已经处理过的消息，需要使用 broker.New 包装后的broker
+	Deduplicator Deduplicator
+	// CloudEvents 把结构化模式的 CloudEvents 消息转换为二进制模式，需要使用 broker.New 包装后的broker
+	CloudEvents bool
+	// BatchSize 批量消费每批最多的消息数量
+	BatchSize int
+	// BatchWait 批量消费凑批的最长等待时间，从一批的第一条消息开始计算
+	BatchWait time.Duration
 }
 
 func NewOptions(opts ...Option) Options {
@@ -50,10 +72,18 @@ func NewSubscribeOptions(opts ...SubscribeOption) SubscribeOptions {
 		Group:      "",
 		Retry:      false,
 		Concurrent: 1,
+		BatchSize:  DefaultBatchSize,
+		BatchWait:  DefaultBatchWait,
 	}
 	for _, o := range opts {
 		o(&opt)
 	}
+	if opt.BatchSize <= 0 {
+		opt.BatchSize = DefaultBatchSize
+	}
+	if opt.BatchWait <= 0 {
+		opt.BatchWait = DefaultBatchWait
+	}
 	return opt
 }
 
@@ -77,12 +107,50 @@ func Retry() SubscribeOption {
 	}
 }
 
+// WithRetryPolicy 设置重试策略，处理失败后按退避间隔延迟重新入队，超过最大次数后发送到死信队列
+// 不支持重新入队的消息队列(例如kafka)在消费协程中等待后重试
+func WithRetryPolicy(policy RetryPolicy) SubscribeOption {
+	return func(options *SubscribeOptions) {
+		policy = policy.WithDefaults()
+		options.RetryPolicy = &policy
+	}
+}
+
+// WithDeduplicator 按消息ID去重，消费组处理成功过的消息不会再次处理
+func WithDeduplicator(d Deduplicator) SubscribeOption {
+	return func(options *SubscribeOptions) {
+		options.Deduplicator = d
+	}
+}
+
 func WithPublishContext(ctx context.Context) PublishOption {
 	return func(options *PublishOptions) {
 		options.Context = ctx
 	}
 }
 
+// WithDelay 延迟 d 后投递消息
+func WithDelay(d time.Duration) PublishOption {
+	return func(options *PublishOptions) {
+		options.DeliverAt = time.Now().Add(d)
+	}
+}
+
+// WithDeliverAt 在指定的时间投递消息
+func WithDeliverAt(t time.Time) PublishOption {
+	return func(options *PublishOptions) {
+		options.DeliverAt = t
+	}
+}
+
+// Delay 距离投递时间的间隔，小于等于0时立即投递
+func (o PublishOptions) Delay() time.Duration {
+	if o.DeliverAt.IsZero() {
+		return 0
+	}
+	return time.Until(o.DeliverAt)
+}
+
 func WithSubscribeContext(ctx context.Context) SubscribeOption {
 	return func(options *SubscribeOptions) {
 		options.Context = ctx
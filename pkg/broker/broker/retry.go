@@ -0,0 +1,90 @@
+package broker
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// 重试与死信队列使用的消息头
+const (
+	// HeaderAttempt 当前第几次处理，从1开始
+	HeaderAttempt = "x-cago-attempt"
+	// HeaderDeadLetterTopic 进入死信队列前的原始topic(不包含前缀)
+	HeaderDeadLetterTopic = "x-cago-dlq-topic"
+	// HeaderDeadLetterGroup 处理失败的消费组
+	HeaderDeadLetterGroup = "x-cago-dlq-group"
+	// HeaderDeadLetterError 最后一次处理的错误信息
+	HeaderDeadLetterError = "x-cago-dlq-error"
+	// HeaderDeadLetterTime 进入死信队列的时间，RFC3339格式
+	HeaderDeadLetterTime = "x-cago-dlq-time"
+)
+
+// RetryPolicy 重试策略，处理失败时按指数退避重试，超过最大次数后发送到死信队列
+type RetryPolicy struct {
+	// MaxAttempts 最大处理次数(包含第一次)，默认为3
+	MaxAttempts int
+	// InitialInterval 第一次重试的间隔，默认为100ms
+	InitialInterval time.Duration
+	// MaxInterval 最大重试间隔，默认为10s
+	MaxInterval time.Duration
+	// Multiplier 间隔的增长倍数，默认为2
+	Multiplier float64
+	// Jitter 随机抖动的比例，取值为0~1，为0时使用默认值0.2，小于0时不抖动
+	Jitter float64
+	// DeadLetterTopic 死信队列的topic，默认为 <topic>.dlq
+	DeadLetterTopic string
+}
+
+// WithDefaults 返回填充了默认值的重试策略
+func (p RetryPolicy) WithDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = 100 * time.Millisecond
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = 10 * time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	switch {
+	case p.Jitter == 0:
+		p.Jitter = 0.2
+	case p.Jitter < 0:
+		p.Jitter = 0
+	case p.Jitter > 1:
+		p.Jitter = 1
+	}
+	return p
+}
+
+// Backoff 第 attempt 次处理失败后，到下一次重试的间隔
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(max(attempt, 1)-1))
+	if d > float64(p.MaxInterval) {
+		d = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+// DeadLetterTopic 获取topic对应的死信队列
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// Attempt 获取消息当前的处理次数，优先使用消息头中的次数
+func Attempt(event Event) int {
+	if v, ok := event.Message().Header[HeaderAttempt]; ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return max(event.Attempted(), 1)
+}
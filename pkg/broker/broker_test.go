@@ -7,7 +7,9 @@ import (
 	"github.com/cago-frame/cago/configs"
 	"github.com/cago-frame/cago/configs/memory"
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/gogo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewWithConfig_UnknownType(t *testing.T) {
@@ -44,3 +46,36 @@ func TestNewWithConfig_RegisteredType(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, b)
 }
+
+func TestBrokerWith_Drain(t *testing.T) {
+	raw := &drainBroker{syncBroker: newSyncBroker(), subscribers: make(map[string]*drainSubscriber)}
+	RegisterBroker("test-drain", func(ctx context.Context, cfg *configs.Config) (broker2.Broker, error) {
+		return raw, nil
+	})
+	cfg, err := configs.NewConfig("test", configs.WithSource(
+		memory.NewSource(map[string]interface{}{
+			"broker": map[string]interface{}{
+				"type": "test-drain",
+			},
+		}),
+	))
+	require.NoError(t, err)
+	prev := Default()
+	t.Cleanup(func() {
+		SetBroker(prev)
+	})
+
+	// 函数式组件在ctx取消后排空订阅者
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, BrokerWith()(ctx, cfg))
+	_, err = Default().Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		return nil
+	})
+	require.NoError(t, err)
+	cancel()
+	gogo.Wait()
+	require.Len(t, raw.subscribers, 1)
+	for _, sub := range raw.subscribers {
+		assert.True(t, sub.drained)
+	}
+}
@@ -0,0 +1,138 @@
+package broker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCloudEvents(t *testing.T) {
+	ctx := context.Background()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	raw := newSyncBroker()
+	b, err := New(WithBroker(raw), WithTracer(tracer))
+	require.NoError(t, err)
+
+	var (
+		received *broker2.Message
+		ce       *broker2.CloudEvent
+		traceID  trace.TraceID
+	)
+	_, err = b.Subscribe(ctx, "order", func(ctx context.Context, event broker2.Event) error {
+		received = event.Message()
+		ce, err = broker2.CloudEventOf(event)
+		traceID = trace.SpanContextFromContext(ctx).TraceID()
+		return err
+	}, broker2.ReceiveCloudEvents())
+	require.NoError(t, err)
+
+	// 二进制模式
+	options := broker2.CloudEventsOptions{Source: "/order", Type: "order.created", DataContentType: "application/json"}
+	msg := &broker2.Message{Body: []byte(`{"id":1}`)}
+	require.NoError(t, b.Publish(ctx, "order", msg, broker2.WithCloudEvents(options)))
+	assert.Nil(t, msg.Header)
+	published := raw.published["order"][0]
+	assert.Equal(t, `{"id":1}`, string(received.Body))
+	assert.Equal(t, "1.0", published.Header[broker2.HeaderCloudEventsSpecVersion])
+	assert.Equal(t, broker2.MessageID(published), ce.ID)
+	assert.Equal(t, "/order", ce.Source)
+	assert.Equal(t, "order.created", ce.Type)
+	assert.Equal(t, "application/json", ce.DataContentType)
+	assert.Equal(t, published.Header["traceparent"], ce.TraceParent)
+	assert.False(t, ce.Time.IsZero())
+
+	// 结构化模式，消费时转换为二进制模式，并继续链路追踪
+	options.Mode = broker2.CloudEventsStructured
+	origin := &broker2.Message{Header: map[string]string{broker2.HeaderMessageID: "1"}, Body: []byte(`{"id":2}`)}
+	encoded, err := broker2.EncodeCloudEvent(origin, &options, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{broker2.HeaderMessageID: "1"}, origin.Header)
+	assert.Equal(t, `{"id":2}`, string(origin.Body))
+	assert.Equal(t, broker2.CloudEventsJSON, encoded.Header["content-type"])
+	envelope := map[string]any{}
+	require.NoError(t, json.Unmarshal(encoded.Body, &envelope))
+	assert.Equal(t, "1", envelope["id"])
+	assert.Equal(t, map[string]any{"id": float64(2)}, envelope["data"])
+
+	msg = &broker2.Message{Body: []byte(`{"id":2}`)}
+	require.NoError(t, b.Publish(ctx, "order", msg, broker2.WithCloudEvents(options)))
+	assert.Equal(t, `{"id":2}`, string(received.Body))
+	assert.Equal(t, "application/json", received.Header["content-type"])
+	assert.Equal(t, "/order", ce.Source)
+	assert.Equal(t, broker2.MessageID(raw.published["order"][1]), ce.ID)
+
+	// 其它平台发布的结构化消息
+	traceparent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	body, err := json.Marshal(map[string]string{
+		"specversion": "1.0", "id": "ext-1", "source": "/external", "type": "external.event",
+		"time": "2026-01-02T03:04:05Z", "datacontenttype": "text/plain", "traceparent": traceparent,
+		"data_base64": base64.StdEncoding.EncodeToString([]byte("hello")),
+	})
+	require.NoError(t, err)
+	require.NoError(t, raw.Publish(ctx, "order", &broker2.Message{
+		Header: map[string]string{"content-type": broker2.CloudEventsJSON},
+		Body:   body,
+	}))
+	assert.Equal(t, "hello", string(received.Body))
+	assert.Equal(t, "ext-1", ce.ID)
+	assert.Equal(t, "text/plain", ce.DataContentType)
+	assert.Equal(t, 2026, ce.Time.Year())
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", traceID.String())
+
+	// 缺少必需的属性
+	_, err = broker2.ParseCloudEvent(&broker2.Message{Header: map[string]string{"ce_specversion": "1.0"}})
+	assert.ErrorIs(t, err, broker2.ErrNotCloudEvent)
+	err = b.Publish(ctx, "order", &broker2.Message{}, broker2.WithCloudEvents(broker2.CloudEventsOptions{}))
+	assert.ErrorIs(t, err, broker2.ErrNotCloudEvent)
+
+	// 无法转换的消息确认后丢弃，不交给处理函数，也不会重新投递
+	received = nil
+	invalid := &testEvent{topic: "order", msg: &broker2.Message{
+		Header: map[string]string{"content-type": broker2.CloudEventsJSON},
+		Body:   []byte("invalid"),
+	}}
+	require.NoError(t, raw.handlers["order"](ctx, invalid))
+	assert.True(t, invalid.acked)
+	assert.Nil(t, received)
+}
+
+func TestCloudEvents_Batch(t *testing.T) {
+	ctx := context.Background()
+	raw := &batchBroker{syncBroker: newSyncBroker(), batchHandlers: make(map[string]broker2.BatchHandler)}
+	b, err := New(WithBroker(raw))
+	require.NoError(t, err)
+	var received []string
+	_, err = broker2.SubscribeBatch(ctx, b, "order", func(ctx context.Context, events []broker2.Event) error {
+		for _, event := range events {
+			received = append(received, string(event.Message().Body))
+		}
+		return nil
+	}, broker2.ReceiveCloudEvents())
+	require.NoError(t, err)
+
+	options := &broker2.CloudEventsOptions{Source: "/order", Type: "order.created", Mode: broker2.CloudEventsStructured}
+	valid, err := broker2.EncodeCloudEvent(&broker2.Message{Body: []byte("1")}, options, time.Now())
+	require.NoError(t, err)
+	invalid := &broker2.Message{Header: map[string]string{"content-type": broker2.CloudEventsJSON}, Body: []byte("invalid")}
+	// 转换失败的消息确认后丢弃，不会让整批消息失败
+	bad := &testEvent{topic: "order", msg: invalid}
+	require.NoError(t, raw.batchHandlers["order"](ctx, []broker2.Event{&testEvent{topic: "order", msg: valid}, bad}))
+	assert.Equal(t, []string{"1"}, received)
+	assert.True(t, bad.acked)
+
+	received = nil
+	require.NoError(t, raw.batchHandlers["order"](ctx, []broker2.Event{&testEvent{topic: "order", msg: invalid}}))
+	assert.Nil(t, received)
+}
@@ -0,0 +1,83 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cago-frame/cago/database/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BrokerProcessedMessage 消费组处理过的消息
+type BrokerProcessedMessage struct {
+	Group     string `gorm:"column:consumer_group;type:varchar(255);primaryKey"`
+	MessageID string `gorm:"column:message_id;type:varchar(64);primaryKey"`
+	// ExpireAt 过期时间(秒)，过期的记录会被定期清理
+	ExpireAt   int64 `gorm:"column:expire_at;not null;index"`
+	Createtime int64 `gorm:"column:createtime"`
+}
+
+// errDuplicate 回滚事务使用
+var errDuplicate = errors.New("dedup: duplicate message")
+
+// DBStore 使用 db.Default() 中的数据表记录处理过的消息ID，会自动创建表结构
+// 记录与处理在同一个事务中，处理时使用 db.Ctx(ctx) 获取数据库实例
+type DBStore struct {
+	options *Options
+	mu      sync.Mutex
+	// cleanAt 上次清理过期记录的时间
+	cleanAt time.Time
+}
+
+func NewDBStore(opts ...Option) (*DBStore, error) {
+	orm := db.Default()
+	if orm == nil {
+		return nil, errors.New("dedup: db component is not started")
+	}
+	if err := orm.Migrator().AutoMigrate(&BrokerProcessedMessage{}); err != nil {
+		return nil, err
+	}
+	return &DBStore{options: newOptions(opts...)}, nil
+}
+
+func (s *DBStore) Do(ctx context.Context, group, id string, fn func(ctx context.Context) error) (bool, error) {
+	s.clean(ctx)
+	now := time.Now()
+	err := db.Ctx(ctx).Transaction(func(tx *gorm.DB) error {
+		// 相同的消息并发处理时，后插入的会等待先插入的事务结束
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&BrokerProcessedMessage{
+			Group:      group,
+			MessageID:  id,
+			ExpireAt:   now.Add(s.options.ttl).Unix(),
+			Createtime: now.Unix(),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDuplicate
+		}
+		return fn(db.WithContextDB(ctx, tx))
+	})
+	if errors.Is(err, errDuplicate) {
+		return true, nil
+	}
+	return false, err
+}
+
+// clean 每个TTL的十分之一清理一次过期的记录
+func (s *DBStore) clean(ctx context.Context) {
+	s.mu.Lock()
+	now := time.Now()
+	if now.Sub(s.cleanAt) < s.options.ttl/10 {
+		s.mu.Unlock()
+		return
+	}
+	s.cleanAt = now
+	s.mu.Unlock()
+	_ = db.Default().WithContext(ctx).Where("expire_at < ?", now.Unix()).
+		Delete(&BrokerProcessedMessage{}).Error
+}
@@ -0,0 +1,125 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cago-frame/cago/database/db"
+	_ "github.com/cago-frame/cago/database/db/sqlite"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Order struct {
+	ID     int64 `gorm:"primaryKey"`
+	Status int   `gorm:"column:status"`
+}
+
+func newDB(t *testing.T) {
+	orm, err := db.Open(&db.Config{
+		Driver: db.SQLite,
+		Dsn:    fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()),
+	})
+	require.NoError(t, err)
+	sqlDB, err := orm.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	db.SetDefault(orm)
+}
+
+func testDeduplicator(t *testing.T, d broker2.Deduplicator) {
+	ctx := context.Background()
+	calls := 0
+	fn := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+	duplicate, err := d.Do(ctx, "group", "1", fn)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	duplicate, err = d.Do(ctx, "group", "1", fn)
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.Equal(t, 1, calls)
+
+	// 不同的消费组分别记录
+	duplicate, err = d.Do(ctx, "group2", "1", fn)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	assert.Equal(t, 2, calls)
+
+	// 处理失败时不记录
+	_, err = d.Do(ctx, "group", "2", func(ctx context.Context) error {
+		return errors.New("failed")
+	})
+	assert.Error(t, err)
+	duplicate, err = d.Do(ctx, "group", "2", fn)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRedisStore(t *testing.T) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer func() {
+		_ = client.Close()
+	}()
+	d := NewRedisStore(client, WithTTL(time.Hour))
+	testDeduplicator(t, d)
+	assert.True(t, m.Exists("broker:dedup:group:1"))
+
+	// 处理中的消息
+	ctx := context.Background()
+	_, err := d.Do(ctx, "group", "3", func(ctx context.Context) error {
+		_, err := d.Do(ctx, "group", "3", func(ctx context.Context) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrInProgress)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// 过期后重新处理
+	m.FastForward(2 * time.Hour)
+	duplicate, err := d.Do(ctx, "group", "1", func(ctx context.Context) error {
+		return nil
+	})
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+}
+
+func TestDBStore(t *testing.T) {
+	newDB(t)
+	require.NoError(t, db.Default().AutoMigrate(&Order{}))
+	d, err := NewDBStore()
+	require.NoError(t, err)
+	testDeduplicator(t, d)
+
+	// 处理与记录在同一个事务中
+	ctx := context.Background()
+	require.NoError(t, db.Default().Create(&Order{ID: 1, Status: 1}).Error)
+	_, err = d.Do(ctx, "group", "3", func(ctx context.Context) error {
+		if err := db.Ctx(ctx).Model(&Order{}).Where("id = ?", 1).Update("status", 2).Error; err != nil {
+			return err
+		}
+		return errors.New("failed")
+	})
+	assert.Error(t, err)
+	order := &Order{}
+	require.NoError(t, db.Default().First(order, 1).Error)
+	assert.Equal(t, 1, order.Status)
+	var count int64
+	require.NoError(t, db.Default().Model(&BrokerProcessedMessage{}).
+		Where("consumer_group = ? AND message_id = ?", "group", "3").Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
@@ -0,0 +1,45 @@
+package dedup
+
+import "time"
+
+type Option func(*Options)
+
+type Options struct {
+	ttl       time.Duration
+	lease     time.Duration
+	keyPrefix string
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		ttl:       24 * time.Hour,
+		lease:     time.Minute,
+		keyPrefix: "broker:dedup",
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return options
+}
+
+// WithTTL 处理过的消息ID保存的时间，默认为24小时，需要大于消息可能重复投递的时间窗口
+func WithTTL(d time.Duration) Option {
+	return func(options *Options) {
+		options.ttl = d
+	}
+}
+
+// WithLease 使用redis时，消息处理中的标记保存的时间，默认为1分钟
+// 处理中的消息再次投递时会返回 ErrInProgress，由消息队列重新投递
+func WithLease(d time.Duration) Option {
+	return func(options *Options) {
+		options.lease = d
+	}
+}
+
+// WithKeyPrefix 使用redis时key的前缀，默认为 broker:dedup
+func WithKeyPrefix(prefix string) Option {
+	return func(options *Options) {
+		options.keyPrefix = prefix
+	}
+}
@@ -0,0 +1,60 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInProgress 相同的消息正在被处理
+var ErrInProgress = errors.New("dedup: message is being processed")
+
+const (
+	processing = "processing"
+	done       = "done"
+)
+
+// RedisStore 使用redis记录处理过的消息ID
+// 处理前设置处理中的标记，成功后改为已处理并设置过期时间，失败后删除标记
+// 处理与记录不在同一个事务中，记录失败时消息可能被重复处理
+type RedisStore struct {
+	client  *redis.Client
+	options *Options
+}
+
+func NewRedisStore(client *redis.Client, opts ...Option) *RedisStore {
+	return &RedisStore{
+		client:  client,
+		options: newOptions(opts...),
+	}
+}
+
+func (s *RedisStore) key(group, id string) string {
+	return s.options.keyPrefix + ":" + group + ":" + id
+}
+
+func (s *RedisStore) Do(ctx context.Context, group, id string, fn func(ctx context.Context) error) (bool, error) {
+	key := s.key(group, id)
+	ok, err := s.client.SetNX(ctx, key, processing, s.options.lease).Result()
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		v, err := s.client.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return false, err
+		}
+		if v == done {
+			return true, nil
+		}
+		return false, ErrInProgress
+	}
+	if err := fn(ctx); err != nil {
+		if delErr := s.client.Del(ctx, key).Err(); delErr != nil {
+			return false, errors.Join(err, delErr)
+		}
+		return false, err
+	}
+	return false, s.client.Set(ctx, key, done, s.options.ttl).Err()
+}
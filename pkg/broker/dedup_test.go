@@ -0,0 +1,56 @@
+package broker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/broker/dedup"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDeduplicator(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer func() {
+		_ = client.Close()
+	}()
+	raw := newSyncBroker()
+	b, err := New(WithBroker(raw), WithDefaultGroup("app"))
+	require.NoError(t, err)
+
+	calls := 0
+	_, err = b.Subscribe(ctx, "order", func(ctx context.Context, event broker2.Event) error {
+		calls++
+		return nil
+	}, broker2.WithDeduplicator(dedup.NewRedisStore(client)))
+	require.NoError(t, err)
+
+	msg := &broker2.Message{Body: []byte("1")}
+	require.NoError(t, b.Publish(ctx, "order", msg))
+	published := raw.published["order"][0]
+	id := broker2.MessageID(published)
+	assert.NotEmpty(t, id)
+	assert.Empty(t, broker2.MessageID(msg))
+	assert.Equal(t, 1, calls)
+	assert.True(t, m.Exists("broker:dedup:app:"+id))
+
+	// 重复投递
+	require.NoError(t, raw.Publish(ctx, "order", published))
+	assert.Equal(t, 1, calls)
+	// 重复发布同一条消息时生成新的ID
+	require.NoError(t, b.Publish(ctx, "order", msg))
+	assert.Equal(t, 2, calls)
+	// 调用方设置的ID不会覆盖
+	msg = &broker2.Message{Header: map[string]string{broker2.HeaderMessageID: id}, Body: []byte("1")}
+	require.NoError(t, b.Publish(ctx, "order", msg))
+	assert.Equal(t, 2, calls)
+	// 没有消息ID时不去重
+	require.NoError(t, raw.Publish(ctx, "order", &broker2.Message{Body: []byte("1")}))
+	require.NoError(t, raw.Publish(ctx, "order", &broker2.Message{Body: []byte("1")}))
+	assert.Equal(t, 4, calls)
+}
@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/broker/scheduler"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delayBroker 原生支持延迟发布
+type delayBroker struct {
+	*syncBroker
+	delays []time.Duration
+}
+
+func (b *delayBroker) Publish(ctx context.Context, topic string, data *broker2.Message, opts ...broker2.PublishOption) error {
+	b.delays = append(b.delays, broker2.NewPublishOptions(opts...).Delay())
+	return b.syncBroker.Publish(ctx, topic, data, opts...)
+}
+
+func (b *delayBroker) SupportDelay(d time.Duration) bool {
+	return d <= 20*time.Millisecond
+}
+
+func TestWithScheduler(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer func() {
+		_ = client.Close()
+	}()
+	// 只手动投递
+	s := scheduler.New(scheduler.NewRedisStore(client, ""), scheduler.WithPollInterval(time.Hour))
+	raw := &delayBroker{syncBroker: newSyncBroker()}
+	b, err := New(WithBroker(raw), WithTopicPrefix("app"), WithScheduler(s))
+	require.NoError(t, err)
+	defer func() {
+		_ = b.Close()
+	}()
+
+	// 原生支持的延迟直接发布
+	require.NoError(t, b.Publish(ctx, "order", &broker2.Message{Body: []byte("1")},
+		broker2.WithDelay(10*time.Millisecond)))
+	require.Len(t, raw.published["app.order"], 1)
+	assert.Greater(t, raw.delays[0], time.Duration(0))
+
+	// 超过原生支持的时间使用调度器
+	require.NoError(t, b.Publish(ctx, "order", &broker2.Message{Body: []byte("2")},
+		broker2.WithDeliverAt(time.Now().Add(50*time.Millisecond))))
+	require.Len(t, raw.published["app.order"], 1)
+	n, err := s.Deliver(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	time.Sleep(60 * time.Millisecond)
+	n, err = s.Deliver(ctx, raw)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, raw.published["app.order"], 2)
+	assert.Equal(t, []byte("2"), raw.published["app.order"][1].Body)
+	assert.Equal(t, time.Duration(0), raw.delays[1])
+}
@@ -0,0 +1,129 @@
+package broker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type drainSubscriber struct {
+	topic   string
+	err     error
+	drained bool
+}
+
+func (s *drainSubscriber) Topic() string { return s.topic }
+
+func (s *drainSubscriber) Unsubscribe() error { return nil }
+
+func (s *drainSubscriber) Drain(ctx context.Context) error {
+	s.drained = true
+	return s.err
+}
+
+// drainBroker 订阅时返回可以排空的订阅者
+type drainBroker struct {
+	*syncBroker
+	subscribers map[string]*drainSubscriber
+}
+
+func (b *drainBroker) Subscribe(ctx context.Context, topic string, h broker2.Handler,
+	opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	sub := &drainSubscriber{topic: topic}
+	if topic == "failed" {
+		sub.err = context.DeadlineExceeded
+	}
+	b.subscribers[topic] = sub
+	return sub, nil
+}
+
+func TestDrain(t *testing.T) {
+	ctx := context.Background()
+	raw := &drainBroker{syncBroker: newSyncBroker(), subscribers: make(map[string]*drainSubscriber)}
+	b, err := New(WithBroker(raw), WithDrainTimeout(0))
+	require.NoError(t, err)
+
+	handler := func(ctx context.Context, event broker2.Event) error { return nil }
+	_, err = b.Subscribe(ctx, "order", handler)
+	require.NoError(t, err)
+	_, err = b.Subscribe(ctx, "failed", handler)
+	require.NoError(t, err)
+	sub, err := b.Subscribe(ctx, "removed", handler)
+	require.NoError(t, err)
+	require.NoError(t, sub.Unsubscribe())
+
+	// 关闭时排空没有取消的订阅者，并返回排空失败的订阅者
+	err = b.Close()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, raw.subscribers["order"].drained)
+	assert.True(t, raw.subscribers["failed"].drained)
+	assert.False(t, raw.subscribers["removed"].drained)
+}
+
+// ackEvent 确认时通知
+type ackEvent struct {
+	testEvent
+	acked chan struct{}
+}
+
+func (e *ackEvent) Ack() error {
+	close(e.acked)
+	return nil
+}
+
+// inflightSubscriber 与nsq一样，停止订阅时还会收到消息，并等待消息确认后才返回
+type inflightSubscriber struct {
+	drainSubscriber
+	h     broker2.Handler
+	event *ackEvent
+}
+
+func (s *inflightSubscriber) Drain(ctx context.Context) error {
+	if err := s.h(ctx, s.event); err != nil {
+		return err
+	}
+	select {
+	case <-s.event.acked:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type inflightBroker struct {
+	*syncBroker
+	sub *inflightSubscriber
+}
+
+func (b *inflightBroker) Subscribe(ctx context.Context, topic string, h broker2.Handler,
+	opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	b.sub = &inflightSubscriber{drainSubscriber: drainSubscriber{topic: topic}, h: h,
+		event: &ackEvent{testEvent: testEvent{topic: topic, msg: &broker2.Message{}}, acked: make(chan struct{})}}
+	return b.sub, nil
+}
+
+func TestDrain_Batch(t *testing.T) {
+	ctx := context.Background()
+	raw := &inflightBroker{syncBroker: newSyncBroker()}
+	b, err := New(WithBroker(raw), WithDrainTimeout(time.Second))
+	require.NoError(t, err)
+
+	var consumed atomic.Int64
+	_, err = broker2.SubscribeBatch(ctx, b, "order", func(ctx context.Context, events []broker2.Event) error {
+		consumed.Add(int64(len(events)))
+		return nil
+	}, broker2.WithBatch(10, time.Hour))
+	require.NoError(t, err)
+	first := &ackEvent{testEvent: testEvent{topic: "order", msg: &broker2.Message{}}, acked: make(chan struct{})}
+	require.NoError(t, raw.sub.h(ctx, first))
+
+	// 排空时不再等待凑满一批，停止订阅期间收到的消息也会立即处理
+	require.NoError(t, b.Close())
+	assert.Equal(t, int64(2), consumed.Load())
+	<-first.acked
+}
@@ -2,36 +2,222 @@ package event_bus
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"time"
 
-	evbus "github.com/asaskevich/EventBus"
 	"github.com/cago-frame/cago/pkg/broker/broker"
 )
 
-type eventBusBroker struct {
-	bus evbus.Bus
+// ErrClosed broker 已经关闭
+var ErrClosed = errors.New("event_bus: broker closed")
+
+// EventBus 进程内的消息代理，行为与 nsq 保持一致，适合用于测试与单体应用
+// 同一个消费组(Group)的订阅者共同消费，每条消息只会投递给其中一个；不同的消费组都会收到消息
+// Group 为空时每个订阅者都是一个独立的消费组
+// 消息只保存在内存中，消费组的最后一个订阅者取消订阅后，未处理的消息会被丢弃
+type EventBus struct {
+	options *Options
+	mu      sync.Mutex
+	closed  bool
+	// groups topic下的消费组
+	groups map[string]map[string]*group
+	// pending 未处理完成的消息数量(包括等待重新投递的)
+	pending int
+	// handled 每个topic已经处理的消息数量
+	handled map[string]int
+	subs    map[*subscriber]struct{}
 }
 
-func NewEvBusBroker() broker.Broker {
-	ret := &eventBusBroker{
-		bus: evbus.New(),
+func NewEvBusBroker(opts ...Option) *EventBus {
+	return &EventBus{
+		options: newOptions(opts...),
+		groups:  make(map[string]map[string]*group),
+		handled: make(map[string]int),
+		subs:    make(map[*subscriber]struct{}),
 	}
-	return ret
 }
 
-func (e *eventBusBroker) Publish(ctx context.Context, topic string, data *broker.Message, opt ...broker.PublishOption) error {
-	e.bus.Publish(topic, data)
+// Publish 发布消息，延迟发布的消息在投递时才分发给当时订阅了topic的消费组
+func (e *EventBus) Publish(ctx context.Context, topic string, data *broker.Message, opt ...broker.PublishOption) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return ErrClosed
+	}
+	data = copyMessage(data)
+	if d := broker.NewPublishOptions(opt...).Delay(); d > 0 {
+		e.pending++
+		time.AfterFunc(d, func() {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.pending--
+			if !e.closed {
+				e.dispatch(topic, data)
+			}
+		})
+		return nil
+	}
+	e.dispatch(topic, data)
 	return nil
 }
 
-func (e *eventBusBroker) Subscribe(ctx context.Context, topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+// SupportDelay 使用定时器实现延迟发布
+func (e *EventBus) SupportDelay(d time.Duration) bool {
+	return true
+}
+
+// dispatch 分发消息到topic的每个消费组，需要持有锁
+func (e *EventBus) dispatch(topic string, data *broker.Message) {
+	for _, g := range e.groups[topic] {
+		e.pending++
+		g.push(&event{
+			bus:       e,
+			group:     g,
+			topic:     topic,
+			data:      copyMessage(data),
+			attempted: 1,
+		})
+	}
+}
+
+func copyMessage(data *broker.Message) *broker.Message {
+	ret := &broker.Message{Body: data.Body}
+	if data.Header != nil {
+		ret.Header = make(map[string]string, len(data.Header))
+		for k, v := range data.Header {
+			ret.Header[k] = v
+		}
+	}
+	return ret
+}
+
+func (e *EventBus) Subscribe(ctx context.Context, topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
 	options := broker.NewSubscribeOptions(opts...)
 	return newSubscriber(e, topic, h, options)
 }
 
-func (e *eventBusBroker) Close() error {
+// join 将订阅者加入消费组
+func (e *EventBus) join(sub *subscriber) (*group, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, ErrClosed
+	}
+	groups, ok := e.groups[sub.topic]
+	if !ok {
+		groups = make(map[string]*group)
+		e.groups[sub.topic] = groups
+	}
+	name := sub.options.Group
+	if name == "" {
+		name = sub.id
+	}
+	g, ok := groups[name]
+	if !ok {
+		g = newGroup(sub.topic, name)
+		groups[name] = g
+	}
+	g.subscribers++
+	e.subs[sub] = struct{}{}
+	return g, nil
+}
+
+// leave 订阅者离开消费组，最后一个订阅者离开时丢弃未处理的消息
+func (e *EventBus) leave(sub *subscriber) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.subs, sub)
+	g := sub.group
+	g.subscribers--
+	if g.subscribers > 0 {
+		return
+	}
+	delete(e.groups[g.topic], g.name)
+	if len(e.groups[g.topic]) == 0 {
+		delete(e.groups, g.topic)
+	}
+	e.pending -= g.close()
+}
+
+// requeue 重新投递消息，消费组已经不存在时丢弃
+func (e *EventBus) requeue(ev *event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.group.closed() {
+		e.pending--
+		return
+	}
+	ev.group.push(ev)
+}
+
+// finish 消息处理完成
+func (e *EventBus) finish() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pending--
+}
+
+func (e *EventBus) handledOne(topic string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handled[topic]++
+}
+
+// Drain 等待所有消息处理完成，包括等待重新投递的消息，用于测试
+func (e *EventBus) Drain(ctx context.Context) error {
+	return e.wait(ctx, func() bool {
+		return e.pending == 0
+	})
+}
+
+// Await 等待topic累计处理了n条消息(包括重新投递的)，用于测试
+func (e *EventBus) Await(ctx context.Context, topic string, n int) error {
+	return e.wait(ctx, func() bool {
+		return e.handled[topic] >= n
+	})
+}
+
+// Handled 获取topic累计处理的消息数量
+func (e *EventBus) Handled(topic string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.handled[topic]
+}
+
+func (e *EventBus) wait(ctx context.Context, cond func() bool) error {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for {
+		e.mu.Lock()
+		ok := cond()
+		e.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close 关闭后不能再发布消息，会取消所有的订阅并等待正在处理的消息完成
+func (e *EventBus) Close() error {
+	e.mu.Lock()
+	e.closed = true
+	subs := make([]*subscriber, 0, len(e.subs))
+	for sub := range e.subs {
+		subs = append(subs, sub)
+	}
+	e.mu.Unlock()
+	for _, sub := range subs {
+		_ = sub.Unsubscribe()
+	}
 	return nil
 }
 
-func (e *eventBusBroker) String() string {
+func (e *EventBus) String() string {
 	return "event_bus"
 }
@@ -0,0 +1,295 @@
+package event_bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBroker(t *testing.T, opts ...Option) *EventBus {
+	b := NewEvBusBroker(opts...)
+	t.Cleanup(func() {
+		_ = b.Close()
+	})
+	return b
+}
+
+func drain(t *testing.T, b *EventBus) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, b.Drain(ctx))
+}
+
+func TestEventBusFactoryRegistered(t *testing.T) {
+	assert.NotNil(t, broker.GetFactory("event_bus"))
+}
+
+func TestEventBus_Group(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+
+	// 同一个消费组只有一个订阅者收到，不同的消费组都会收到
+	var group1, group2, broadcast atomic.Int32
+	for i := 0; i < 2; i++ {
+		_, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+			group1.Add(1)
+			return nil
+		}, broker2.Group("group1"))
+		require.NoError(t, err)
+		_, err = b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+			group2.Add(1)
+			return nil
+		}, broker2.Group("group2"), broker2.WithConcurrent(4))
+		require.NoError(t, err)
+		// 没有消费组时每个订阅者都会收到
+		_, err = b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+			broadcast.Add(1)
+			return nil
+		})
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("1")}))
+	}
+	drain(t, b)
+	assert.Equal(t, int32(10), group1.Load())
+	assert.Equal(t, int32(10), group2.Load())
+	assert.Equal(t, int32(20), broadcast.Load())
+	assert.Equal(t, 40, b.Handled("topic"))
+}
+
+func TestEventBus_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+
+	var running, peak atomic.Int32
+	_, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, broker2.Group("group"), broker2.WithConcurrent(3))
+	require.NoError(t, err)
+	for i := 0; i < 6; i++ {
+		require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("1")}))
+	}
+	drain(t, b)
+	assert.Equal(t, int32(3), peak.Load())
+}
+
+func TestEventBus_Retry(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, WithRequeueDelay(time.Millisecond))
+
+	attempts := make([]int, 0)
+	mu := sync.Mutex{}
+	_, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, event.Attempted())
+		if event.Attempted() < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	}, broker2.Group("group"), broker2.Retry())
+	require.NoError(t, err)
+	require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("1")}))
+	drain(t, b)
+	assert.Equal(t, []int{1, 2, 3}, attempts)
+}
+
+func TestEventBus_Requeue(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, WithMsgTimeout(50*time.Millisecond))
+
+	var calls atomic.Int32
+	acked := make(chan broker2.Event, 1)
+	_, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		switch calls.Add(1) {
+		case 1:
+			// 手动延迟重新投递
+			return event.Requeue(20 * time.Millisecond)
+		case 2:
+			// 不确认，超时后重新投递
+			assert.Equal(t, 2, event.Attempted())
+			return nil
+		default:
+			assert.Equal(t, 3, event.Attempted())
+			acked <- event
+			return nil
+		}
+	}, broker2.Group("group"), broker2.NotAutoAck())
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Header: map[string]string{"k": "v"}, Body: []byte("1")}))
+	awaitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, b.Await(awaitCtx, "topic", 3))
+	assert.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+
+	// 没有确认的消息不会处理完成
+	shortCtx, shortCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer shortCancel()
+	assert.ErrorIs(t, b.Drain(shortCtx), context.DeadlineExceeded)
+
+	event := <-acked
+	assert.Equal(t, "v", event.Message().Header["k"])
+	require.NoError(t, event.Ack())
+	assert.ErrorIs(t, event.Ack(), ErrAlreadyActed)
+	drain(t, b)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestEventBus_Unsubscribe(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+
+	block := make(chan struct{})
+	sub, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		<-block
+		return nil
+	}, broker2.Group("group"))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("1")}))
+	}
+	close(block)
+	// 取消订阅后丢弃未处理的消息
+	require.NoError(t, sub.Unsubscribe())
+	drain(t, b)
+	assert.LessOrEqual(t, b.Handled("topic"), 3)
+
+	require.NoError(t, b.Close())
+	assert.ErrorIs(t, b.Publish(ctx, "topic", &broker2.Message{}), ErrClosed)
+	_, err = b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestEventBus_Delay(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+
+	var delivered atomic.Int64
+	_, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		delivered.Store(time.Now().UnixNano())
+		return nil
+	}, broker2.Group("group"))
+	require.NoError(t, err)
+	start := time.Now()
+	require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("1")},
+		broker2.WithDelay(50*time.Millisecond)))
+	assert.Equal(t, 0, b.Handled("topic"))
+	drain(t, b)
+	assert.Equal(t, 1, b.Handled("topic"))
+	assert.GreaterOrEqual(t, time.Duration(delivered.Load()-start.UnixNano()), 50*time.Millisecond)
+}
+
+func TestEventBus_Batch(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, WithRequeueDelay(time.Millisecond))
+
+	var (
+		mu      sync.Mutex
+		batches []int
+	)
+	_, err := broker2.SubscribeBatch(ctx, b, "topic", func(ctx context.Context, events []broker2.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, len(events))
+		return nil
+	}, broker2.Group("group"), broker2.WithBatch(5, 50*time.Millisecond))
+	require.NoError(t, err)
+
+	// 凑满一批立即处理，剩余的消息等待超时后处理
+	msgs := make([]*broker2.Message, 0, 12)
+	for i := 0; i < 12; i++ {
+		msgs = append(msgs, &broker2.Message{Body: []byte("1")})
+	}
+	require.NoError(t, broker2.PublishBatch(ctx, b, "topic", msgs))
+	drain(t, b)
+	assert.Equal(t, []int{5, 5, 2}, batches)
+}
+
+func TestEventBus_BatchRetry(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+
+	var calls atomic.Int32
+	attempts := make(chan []int, 2)
+	_, err := broker2.SubscribeBatch(ctx, b, "topic", func(ctx context.Context, events []broker2.Event) error {
+		n := make([]int, 0, len(events))
+		for _, event := range events {
+			n = append(n, event.Attempted())
+		}
+		attempts <- n
+		if calls.Add(1) == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	}, broker2.Group("group"), broker2.Retry(), broker2.WithBatch(2, time.Second))
+	require.NoError(t, err)
+
+	// 整批处理失败后每条消息都重新投递
+	require.NoError(t, broker2.PublishBatch(ctx, b, "topic", []*broker2.Message{
+		{Body: []byte("1")}, {Body: []byte("2")},
+	}))
+	awaitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, b.Await(awaitCtx, "topic", 2))
+	drain(t, b)
+	assert.Equal(t, []int{1, 1}, <-attempts)
+	assert.Equal(t, []int{2, 2}, <-attempts)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestEventBus_Drain(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t)
+
+	started := make(chan struct{}, 3)
+	block := make(chan struct{})
+	var handled atomic.Int32
+	sub, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		started <- struct{}{}
+		<-block
+		handled.Add(1)
+		return nil
+	}, broker2.Group("group"))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("1")}))
+	}
+	<-started
+
+	// 超时后不再等待
+	shortCtx, shortCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer shortCancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Drain(shortCtx)
+	}()
+	assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+	close(block)
+	drain(t, b)
+	// 停止后不再取出新的消息
+	assert.Equal(t, int32(1), handled.Load())
+	assert.Equal(t, 1, b.Handled("topic"))
+}
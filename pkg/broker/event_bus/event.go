@@ -1,14 +1,27 @@
 package event_bus
 
 import (
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/cago-frame/cago/pkg/broker/broker"
 )
 
+// ErrAlreadyActed 消息已经执行过 Ack 或 Requeue
+var ErrAlreadyActed = errors.New("event_bus: message already acked or requeued")
+
 type event struct {
-	topic string
-	data  *broker.Message
+	bus       *EventBus
+	group     *group
+	topic     string
+	data      *broker.Message
+	attempted int
+	mu        sync.Mutex
+	// isAct 是否已经执行过Ack或者Requeue
+	isAct bool
+	// timer 消息处理超时的定时器
+	timer *time.Timer
 }
 
 func (e *event) Topic() string {
@@ -19,7 +32,30 @@ func (e *event) Message() *broker.Message {
 	return e.data
 }
 
+func (e *event) act() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.isAct {
+		return false
+	}
+	e.isAct = true
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	return true
+}
+
+func (e *event) acted() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isAct
+}
+
 func (e *event) Ack() error {
+	if !e.act() {
+		return ErrAlreadyActed
+	}
+	e.bus.finish()
 	return nil
 }
 
@@ -27,10 +63,40 @@ func (e *event) Error() error {
 	return nil
 }
 
+// Requeue 在 delay 后重新投递给同一个消费组
 func (e *event) Requeue(delay time.Duration) error {
+	if !e.act() {
+		return ErrAlreadyActed
+	}
+	ev := &event{
+		bus:       e.bus,
+		group:     e.group,
+		topic:     e.topic,
+		data:      e.data,
+		attempted: e.attempted + 1,
+	}
+	if delay <= 0 {
+		e.bus.requeue(ev)
+	} else {
+		time.AfterFunc(delay, func() {
+			e.bus.requeue(ev)
+		})
+	}
 	return nil
 }
 
 func (e *event) Attempted() int {
-	return -1
+	return e.attempted
+}
+
+// timeout 处理超时后没有 Ack 或 Requeue 时重新投递
+func (e *event) timeout(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.isAct {
+		return
+	}
+	e.timer = time.AfterFunc(d, func() {
+		_ = e.Requeue(0)
+	})
 }
@@ -0,0 +1,35 @@
+package event_bus
+
+import "time"
+
+type Option func(*Options)
+
+type Options struct {
+	msgTimeout   time.Duration
+	requeueDelay time.Duration
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		msgTimeout:   time.Minute,
+		requeueDelay: 100 * time.Millisecond,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return options
+}
+
+// WithMsgTimeout 使用 NotAutoAck 时，消息处理完成后超过该时间没有 Ack 或 Requeue 会重新投递，默认为1分钟
+func WithMsgTimeout(d time.Duration) Option {
+	return func(options *Options) {
+		options.msgTimeout = d
+	}
+}
+
+// WithRequeueDelay 使用 Retry 选项处理失败时重新投递的延迟，会乘以已经投递的次数，默认为100ms
+func WithRequeueDelay(d time.Duration) Option {
+	return func(options *Options) {
+		options.requeueDelay = d
+	}
+}
@@ -0,0 +1,66 @@
+package event_bus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus_Request(t *testing.T) {
+	ctx := context.Background()
+	b, err := broker.New(broker.WithBroker(NewEvBusBroker()),
+		broker.WithTopicPrefix("app"), broker.WithDefaultGroup("app"))
+	require.NoError(t, err)
+	defer b.Close() //nolint:errcheck
+
+	_, err = b.Subscribe(ctx, "echo", func(ctx context.Context, event broker2.Event) error {
+		return broker.ReplyTo(ctx, b, event, &broker2.Message{
+			Body: append([]byte("echo:"), event.Message().Body...),
+		})
+	}, broker2.WithConcurrent(4))
+	require.NoError(t, err)
+
+	// 并发的请求各自收到自己的回复
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			body := fmt.Sprintf("%d", i)
+			reply, err := broker.RequestTo(reqCtx, b, "echo", &broker2.Message{Body: []byte(body)})
+			if assert.NoError(t, err) {
+				assert.Equal(t, "echo:"+body, string(reply.Body))
+				assert.NotEmpty(t, reply.Header[broker.HeaderCorrelationID])
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 没有回复时由 ctx 控制超时
+	reqCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = broker.RequestTo(reqCtx, b, "nobody", &broker2.Message{Body: []byte("1")})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// 不是请求的消息不能回复
+	var replyErr error
+	done := make(chan struct{})
+	_, err = b.Subscribe(ctx, "event", func(ctx context.Context, event broker2.Event) error {
+		replyErr = broker.ReplyTo(ctx, b, event, &broker2.Message{})
+		close(done)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, b.Publish(ctx, "event", &broker2.Message{Body: []byte("1")}))
+	<-done
+	assert.ErrorIs(t, replyErr, broker.ErrNotRequest)
+}
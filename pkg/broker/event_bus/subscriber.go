@@ -2,53 +2,194 @@ package event_bus
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/gogo"
 	"github.com/cago-frame/cago/pkg/logger"
+	"github.com/cago-frame/cago/pkg/utils"
 	"go.uber.org/zap"
 )
 
-type subscriber struct {
-	e      *eventBusBroker
-	topic  string
-	handle func(data *broker.Message)
+// group 消费组，组内的订阅者共同消费一个队列
+type group struct {
+	topic string
+	name  string
+	// subscribers 订阅者数量，由 EventBus 的锁保护
+	subscribers int
+	mu          sync.Mutex
+	queue       []*event
+	isClosed    bool
+	// ready 队列中有消息时通知
+	ready chan struct{}
 }
 
-func newSubscriber(e *eventBusBroker, topic string, handler broker.Handler, options broker.SubscribeOptions) (broker.Subscriber, error) {
-	ret := &subscriber{
-		e:     e,
+func newGroup(topic, name string) *group {
+	return &group{
 		topic: topic,
+		name:  name,
+		ready: make(chan struct{}, 1),
 	}
-	logger := logger.Default().With(
-		zap.String("topic", topic), zap.String("group", options.Group),
-	)
-	ret.handle = func(data *broker.Message) {
-		go func() {
-			var ctx context.Context
-			if options.Context != nil {
-				ctx = options.Context
-			} else {
-				ctx = context.Background()
-			}
-			err := handler(ctx, &event{
-				topic: topic,
-				data:  data,
-			})
-			if err != nil {
-				logger.Error("event bus subscriber handle error", zap.Error(err))
-			}
-		}()
+}
+
+func (g *group) push(ev *event) {
+	g.mu.Lock()
+	g.queue = append(g.queue, ev)
+	g.mu.Unlock()
+	g.notify()
+}
+
+func (g *group) notify() {
+	select {
+	case g.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (g *group) pop() *event {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.queue) == 0 {
+		return nil
+	}
+	ev := g.queue[0]
+	g.queue[0] = nil
+	g.queue = g.queue[1:]
+	if len(g.queue) > 0 {
+		// 唤醒其它的消费者
+		g.notify()
+	}
+	return ev
+}
+
+// close 关闭消费组，返回丢弃的消息数量
+func (g *group) close() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.isClosed = true
+	n := len(g.queue)
+	g.queue = nil
+	return n
+}
+
+func (g *group) closed() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.isClosed
+}
+
+type subscriber struct {
+	e       *EventBus
+	id      string
+	topic   string
+	group   *group
+	handler broker.Handler
+	options broker.SubscribeOptions
+	logger  *zap.Logger
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+	once    sync.Once
+}
+
+func newSubscriber(e *EventBus, topic string, handler broker.Handler, options broker.SubscribeOptions) (broker.Subscriber, error) {
+	ret := &subscriber{
+		e:       e,
+		id:      fmt.Sprintf("subscriber-%s", utils.RandString(16, utils.Mix)),
+		topic:   topic,
+		handler: handler,
+		options: options,
+		logger: logger.Default().With(
+			zap.String("topic", topic), zap.String("group", options.Group),
+		),
 	}
-	if err := e.bus.SubscribeAsync(topic, ret.handle, true); err != nil {
+	g, err := e.join(ret)
+	if err != nil {
 		return nil, err
 	}
+	ret.group = g
+	ctx, cancel := context.WithCancel(context.Background())
+	ret.cancel = cancel
+	for range max(options.Concurrent, 1) {
+		ret.done.Add(1)
+		gogo.Go(func() error {
+			defer ret.done.Done()
+			ret.consume(ctx)
+			return nil
+		})
+	}
 	return ret, nil
 }
 
+func (n *subscriber) consume(ctx context.Context) {
+	for ctx.Err() == nil {
+		if ev := n.group.pop(); ev != nil {
+			n.handle(ev)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.group.ready:
+		}
+	}
+}
+
+func (n *subscriber) handle(ev *event) {
+	ctx := n.options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err := n.call(ctx, ev)
+	n.e.handledOne(n.topic)
+	if err != nil {
+		if !ev.acted() {
+			if n.options.Retry {
+				_ = ev.Requeue(n.e.options.requeueDelay * time.Duration(ev.attempted))
+				n.logger.Error("event bus subscriber handle error", zap.Bool("retry", true), zap.Error(err))
+				return
+			} else if n.options.AutoAck {
+				_ = ev.Ack()
+			} else {
+				ev.timeout(n.e.options.msgTimeout)
+			}
+		}
+		n.logger.Error("event bus subscriber handle error", zap.Error(err))
+	} else if !ev.acted() {
+		if n.options.AutoAck {
+			_ = ev.Ack()
+		} else {
+			ev.timeout(n.e.options.msgTimeout)
+		}
+	}
+}
+
+func (n *subscriber) call(ctx context.Context, ev *event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("event bus subscriber panic: %v", r)
+		}
+	}()
+	return n.handler(ctx, ev)
+}
+
 func (n *subscriber) Topic() string {
 	return n.topic
 }
 
+// Unsubscribe 取消订阅，等待正在处理的消息完成
 func (n *subscriber) Unsubscribe() error {
-	return n.e.bus.Unsubscribe(n.topic, n.handle)
+	return n.Drain(context.Background())
+}
+
+// Drain 停止取出新的消息，等待正在处理的消息完成后取消订阅，队列中的消息留给消费组内其它的订阅者
+func (n *subscriber) Drain(ctx context.Context) error {
+	var err error
+	n.once.Do(func() {
+		n.cancel()
+		err = broker.Wait(ctx, &n.done)
+		n.e.leave(n)
+	})
+	return err
 }
@@ -6,16 +6,83 @@ import (
 	"github.com/cago-frame/cago"
 	"github.com/cago-frame/cago/configs"
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/gogo"
+	"github.com/cago-frame/cago/pkg/logger"
+	"github.com/cago-frame/cago/pkg/opentelemetry/metric"
 	"github.com/cago-frame/cago/pkg/opentelemetry/trace"
+	metric2 "go.opentelemetry.io/otel/metric"
 	trace2 "go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 var broker broker2.Broker
 
 const instrumName = "github.com/cago-frame/cago/pkg/broker"
 
-// Broker 消息队列组件
+// Broker 消息队列组件，应用停止(ctx取消)时在后台排空订阅者并关闭broker
 func Broker(ctx context.Context, config *configs.Config) error {
+	return BrokerWith()(ctx, config)
+}
+
+// BrokerWith 使用额外的选项创建消息队列组件，例如统一注册拦截器
+// 应用停止(ctx取消)时在后台排空订阅者并关闭broker，与其它组件的关闭同时进行，
+// 需要在关闭其它组件(例如数据库)之前排空时使用 Component
+//
+//	cago.New(ctx, cfg).Registry(component.Broker(broker.WithPublishInterceptor(tenant)))
+func BrokerWith(opts ...Option) cago.FuncComponent {
+	return func(ctx context.Context, config *configs.Config) error {
+		if err := newBroker(ctx, config, opts...); err != nil {
+			return err
+		}
+		if ctx.Done() != nil {
+			b := broker
+			// 应用停止时会等待 gogo 启动的协程完成
+			gogo.Go(func() error {
+				<-ctx.Done()
+				closeBroker(b)
+				return nil
+			})
+		}
+		return nil
+	}
+}
+
+// Component 使用额外的选项创建消息队列组件，应用停止时在 CloseHandle 中排空订阅者并关闭broker，
+// 组件按照注册的相反顺序关闭，在之前注册的组件(例如数据库)关闭之前完成排空
+//
+//	cago.New(ctx, cfg).Registry(component.Database()).Registry(component.BrokerComponent())
+func Component(opts ...Option) cago.Component {
+	return &component{opts: opts}
+}
+
+type component struct {
+	opts   []Option
+	broker broker2.Broker
+}
+
+func (c *component) Start(ctx context.Context, config *configs.Config) error {
+	if err := newBroker(ctx, config, c.opts...); err != nil {
+		return err
+	}
+	c.broker = broker
+	return nil
+}
+
+func (c *component) CloseHandle() {
+	if c.broker == nil {
+		return
+	}
+	closeBroker(c.broker)
+}
+
+// closeBroker 排空订阅者后关闭broker，排空的时间由 WithDrainTimeout 限制
+func closeBroker(b broker2.Broker) {
+	if err := b.Close(); err != nil {
+		logger.Default().Error("close broker error", zap.Error(err))
+	}
+}
+
+func newBroker(ctx context.Context, config *configs.Config, opts ...Option) error {
 	options := make([]Option, 0)
 	if tp := trace.Default(); tp != nil {
 		options = append(options, WithTracer(tp.Tracer(
@@ -23,8 +90,15 @@ func Broker(ctx context.Context, config *configs.Config) error {
 			trace2.WithInstrumentationVersion("semver:"+cago.Version()),
 		)))
 	}
+	if mp := metric.Default(); mp != nil {
+		options = append(options, WithMeter(mp.Meter(
+			instrumName,
+			metric2.WithInstrumentationVersion(cago.Version()),
+		)))
+	}
 	options = append(options, WithDefaultGroup(config.AppName),
 		WithTopicPrefix(config.AppName+"."+string(config.Env)))
+	options = append(options, opts...)
 	b, err := NewWithConfig(ctx, config, options...)
 	if err != nil {
 		return err
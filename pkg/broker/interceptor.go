@@ -0,0 +1,61 @@
+package broker
+
+import (
+	"context"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+)
+
+// PublishInvoker 发布消息，topic 不包含前缀
+type PublishInvoker func(ctx context.Context, topic string, data *broker2.Message, opts ...broker2.PublishOption) error
+
+// PublishInterceptor 发布拦截器，在添加topic前缀、日志与链路追踪之前执行
+// 可以修改topic、消息头与发布选项后调用 next，不调用 next 时中断发布
+type PublishInterceptor func(ctx context.Context, topic string, data *broker2.Message,
+	next PublishInvoker, opts ...broker2.PublishOption) error
+
+// SubscribeInfo 订阅的信息
+type SubscribeInfo struct {
+	// Topic 不包含前缀的topic
+	Topic string
+	// Options 订阅选项，Group 已经填充了默认消费组
+	Options broker2.SubscribeOptions
+}
+
+// SubscribeInterceptor 消费拦截器，在日志与链路追踪之后、重试与去重之前执行
+// 可以包装 event 或者 ctx 后调用 next；不调用 next 时中断处理，返回的错误按处理失败对待
+type SubscribeInterceptor func(ctx context.Context, event broker2.Event, info *SubscribeInfo, next broker2.Handler) error
+
+// WithPublishInterceptor 添加发布拦截器，按添加的顺序执行
+func WithPublishInterceptor(interceptors ...PublishInterceptor) Option {
+	return func(options *Options) {
+		options.publishInterceptors = append(options.publishInterceptors, interceptors...)
+	}
+}
+
+// WithSubscribeInterceptor 添加消费拦截器，按添加的顺序执行
+func WithSubscribeInterceptor(interceptors ...SubscribeInterceptor) Option {
+	return func(options *Options) {
+		options.subscribeInterceptors = append(options.subscribeInterceptors, interceptors...)
+	}
+}
+
+func chainPublish(interceptors []PublishInterceptor, invoker PublishInvoker) PublishInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, topic string, data *broker2.Message, opts ...broker2.PublishOption) error {
+			return interceptor(ctx, topic, data, next, opts...)
+		}
+	}
+	return invoker
+}
+
+func chainSubscribe(interceptors []SubscribeInterceptor, info *SubscribeInfo, h broker2.Handler) broker2.Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(ctx context.Context, event broker2.Event) error {
+			return interceptor(ctx, event, info, next)
+		}
+	}
+	return h
+}
@@ -0,0 +1,77 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantKey struct{}
+
+func TestInterceptor(t *testing.T) {
+	ctx := context.Background()
+	raw := newSyncBroker()
+	order := make([]string, 0)
+	errForbidden := errors.New("forbidden")
+	b, err := New(WithBroker(raw), WithTopicPrefix("app"), WithDefaultGroup("group"),
+		WithPublishInterceptor(
+			func(ctx context.Context, topic string, data *broker2.Message,
+				next PublishInvoker, opts ...broker2.PublishOption) error {
+				order = append(order, "publish1")
+				if topic == "admin" {
+					return errForbidden
+				}
+				data.Header["tenant"] = ctx.Value(tenantKey{}).(string)
+				return next(ctx, topic, data, opts...)
+			},
+			func(ctx context.Context, topic string, data *broker2.Message,
+				next PublishInvoker, opts ...broker2.PublishOption) error {
+				order = append(order, "publish2")
+				return next(ctx, topic+".v2", data, opts...)
+			},
+		),
+		WithSubscribeInterceptor(func(ctx context.Context, event broker2.Event,
+			info *SubscribeInfo, next broker2.Handler) error {
+			order = append(order, "subscribe")
+			assert.Equal(t, "order.v2", info.Topic)
+			assert.Equal(t, "group", info.Options.Group)
+			tenant := event.Message().Header["tenant"]
+			if tenant == "" {
+				// 中断处理
+				return nil
+			}
+			return next(context.WithValue(ctx, tenantKey{}, tenant), event)
+		}),
+	)
+	require.NoError(t, err)
+
+	var tenant string
+	_, err = b.Subscribe(ctx, "order.v2", func(ctx context.Context, event broker2.Event) error {
+		order = append(order, "handler")
+		tenant = ctx.Value(tenantKey{}).(string)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Publish(context.WithValue(ctx, tenantKey{}, "t1"), "order",
+		&broker2.Message{Body: []byte("1")}))
+	assert.Equal(t, []string{"publish1", "publish2", "subscribe", "handler"}, order)
+	assert.Equal(t, "t1", tenant)
+	require.Len(t, raw.published["app.order.v2"], 1)
+	assert.Equal(t, "t1", raw.published["app.order.v2"][0].Header["tenant"])
+
+	// 发布拦截器中断发布
+	order = order[:0]
+	assert.ErrorIs(t, b.Publish(ctx, "admin", &broker2.Message{}), errForbidden)
+	assert.Equal(t, []string{"publish1"}, order)
+	assert.Empty(t, raw.published["app.admin"])
+
+	// 消费拦截器中断处理
+	order = order[:0]
+	require.NoError(t, raw.Publish(ctx, "app.order.v2", &broker2.Message{Header: map[string]string{}}))
+	assert.Equal(t, []string{"subscribe"}, order)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/opentelemetry/metric"
 	kgo "github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl"
 	"github.com/segmentio/kafka-go/sasl/plain"
@@ -20,6 +21,8 @@ type kafkaBroker struct {
 	config Config
 	writer *kgo.Writer
 	dialer *kgo.Dialer
+	// lag 启用指标时记录消费延迟
+	lag *lagRecorder
 }
 
 // NewBroker 构造一个 Kafka broker。
@@ -43,24 +46,60 @@ func NewBroker(cfg Config) (broker.Broker, error) {
 		Async:        false,
 		Transport:    transport,
 	}
-	return &kafkaBroker{
+	if cfg.StatsInterval <= 0 {
+		cfg.StatsInterval = 15 * time.Second
+	}
+	ret := &kafkaBroker{
 		config: cfg,
 		writer: w,
 		dialer: dialer,
-	}, nil
+	}
+	if mp := metric.Default(); mp != nil {
+		ret.lag, err = newLagRecorder(mp.Meter("github.com/cago-frame/cago/pkg/broker/kafka"))
+		if err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	return ret, nil
 }
 
 func (b *kafkaBroker) Publish(ctx context.Context, topic string, data *broker.Message, opts ...broker.PublishOption) error {
 	pubOpts := broker.NewPublishOptions(opts...)
+	if pubOpts.Delay() > 0 {
+		// kafka 不支持延迟发布，需要使用 broker.WithScheduler 设置调度器
+		return broker.ErrDelayUnsupported
+	}
 	msg := buildKafkaMessage(topic, data, &pubOpts)
 	return b.writer.WriteMessages(ctx, msg)
 }
 
+// PublishBatch 使用一次 WriteMessages 写入整批消息
+func (b *kafkaBroker) PublishBatch(ctx context.Context, topic string, data []*broker.Message, opts ...broker.PublishOption) error {
+	pubOpts := broker.NewPublishOptions(opts...)
+	if pubOpts.Delay() > 0 {
+		return broker.ErrDelayUnsupported
+	}
+	msgs := make([]kgo.Message, 0, len(data))
+	for _, v := range data {
+		msgs = append(msgs, buildKafkaMessage(topic, v, &pubOpts))
+	}
+	return b.writer.WriteMessages(ctx, msgs...)
+}
+
+// SubscribeBatch 每个 Reader 批量拉取消息，整批处理完成后一起 commit
+func (b *kafkaBroker) SubscribeBatch(_ context.Context, topic string, h broker.BatchHandler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	return newBatchSubscribe(b, topic, h, broker.NewSubscribeOptions(opts...))
+}
+
 func (b *kafkaBroker) Subscribe(_ context.Context, topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
 	return newSubscribe(b, topic, h, broker.NewSubscribeOptions(opts...))
 }
 
 func (b *kafkaBroker) Close() error {
+	if b.lag != nil {
+		_ = b.lag.close()
+	}
 	return b.writer.Close()
 }
 
@@ -32,6 +32,14 @@ func TestBuildKafkaMessage_NoKey(t *testing.T) {
 	assert.Empty(t, msg.Headers)
 }
 
+func TestBroker_Batch(t *testing.T) {
+	var b interface{} = &kafkaBroker{}
+	_, ok := b.(broker2.BatchPublisher)
+	assert.True(t, ok)
+	_, ok = b.(broker2.BatchSubscriber)
+	assert.True(t, ok)
+}
+
 func TestNewBroker_EmptyBrokers(t *testing.T) {
 	_, err := NewBroker(Config{})
 	assert.NotNil(t, err)
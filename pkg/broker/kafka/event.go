@@ -1,15 +1,17 @@
 package kafka
 
 import (
-	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
 )
 
 // ErrRequeueUnsupported Kafka 语义下 Requeue 无优雅映射（无 per-message requeue）。
-// 如需重试，请使用 SubscribeOption 的 Retry 语义，或在业务层走独立的 retry topic。
-var ErrRequeueUnsupported = errors.New("kafka: Requeue is unsupported; use Retry option or a retry topic")
+// 如需重试，请使用 SubscribeOption 的 Retry / WithRetryPolicy 语义，或在业务层走独立的 retry topic。
+var ErrRequeueUnsupported = fmt.Errorf("kafka: Requeue is unsupported; use Retry/WithRetryPolicy option or a retry topic: %w",
+	broker2.ErrRequeueUnsupported)
 
 // event 把一条 kafka-go 消息适配成 broker2.Event。
 type event struct {
@@ -22,9 +24,18 @@ type event struct {
 
 func (e *event) Topic() string             { return e.topic }
 func (e *event) Message() *broker2.Message { return e.msg }
-func (e *event) Attempted() int            { return e.attempted }
 func (e *event) Error() error              { return nil }
 
+// Attempted kafka-go 不暴露单条消息的投递次数，使用 WithRetryPolicy 时从消息头中获取
+func (e *event) Attempted() int {
+	if e.msg != nil {
+		if n, err := strconv.Atoi(e.msg.Header[broker2.HeaderAttempt]); err == nil {
+			return n
+		}
+	}
+	return e.attempted
+}
+
 // Ack 标记这条消息已处理。真正的 offset commit 由 subscriber 循环统一执行。
 func (e *event) Ack() error {
 	e.isAct = true
@@ -35,6 +35,8 @@ func TestEvent_Requeue_Unsupported(t *testing.T) {
 func TestEvent_Attempted(t *testing.T) {
 	e := &event{attempted: 3}
 	assert.Equal(t, 3, e.Attempted())
+	e.msg = &broker2.Message{Header: map[string]string{broker2.HeaderAttempt: "2"}}
+	assert.Equal(t, 2, e.Attempted())
 }
 
 func TestEvent_Error(t *testing.T) {
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type lagKey struct {
+	sub       *subscriber
+	partition string
+}
+
+// lagRecorder 记录订阅者每个分区的消费延迟，通过 broker_kafka_consumer_lag 指标导出
+// kafka-go 的 Reader 在使用消费组时只记录最近一次拉取的分区，需要定时采样才能覆盖所有分区
+type lagRecorder struct {
+	mu           sync.Mutex
+	lags         map[lagKey]int64
+	registration metric.Registration
+}
+
+func newLagRecorder(meter metric.Meter) (*lagRecorder, error) {
+	r := &lagRecorder{lags: make(map[lagKey]int64)}
+	gauge, err := meter.Int64ObservableGauge("broker_kafka_consumer_lag",
+		metric.WithDescription("kafka 消费组每个分区未消费的消息数量"))
+	if err != nil {
+		return nil, err
+	}
+	r.registration, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for k, lag := range r.lags {
+			o.ObserveInt64(gauge, lag, metric.WithAttributes(
+				attribute.String("system", "kafka"),
+				attribute.String("topic", k.sub.topic),
+				attribute.String("group", k.sub.group),
+				attribute.String("partition", k.partition),
+			))
+		}
+		return nil
+	}, gauge)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// sample 采样订阅者所有 Reader 的统计信息
+func (r *lagRecorder) sample(sub *subscriber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, reader := range sub.readers {
+		stats := reader.Stats()
+		if stats.Partition == "" {
+			continue
+		}
+		r.lags[lagKey{sub: sub, partition: stats.Partition}] = stats.Lag
+	}
+}
+
+// remove 取消订阅后删除订阅者的记录
+func (r *lagRecorder) remove(sub *subscriber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.lags {
+		if k.sub == sub {
+			delete(r.lags, k)
+		}
+	}
+}
+
+func (r *lagRecorder) close() error {
+	return r.registration.Unregister()
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestLagRecorder(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	r, err := newLagRecorder(provider.Meter("test"))
+	require.NoError(t, err)
+
+	sub := &subscriber{topic: "orders", group: "app", lag: r}
+	r.lags[lagKey{sub: sub, partition: "0"}] = 10
+	r.lags[lagKey{sub: sub, partition: "1"}] = 3
+	// 没有拉取过消息时不记录
+	r.sample(sub)
+
+	collect := func() map[string]int64 {
+		rm := metricdata.ResourceMetrics{}
+		require.NoError(t, reader.Collect(ctx, &rm))
+		ret := make(map[string]int64)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != "broker_kafka_consumer_lag" {
+					continue
+				}
+				for _, dp := range m.Data.(metricdata.Gauge[int64]).DataPoints {
+					topic, _ := dp.Attributes.Value("topic")
+					group, _ := dp.Attributes.Value("group")
+					partition, _ := dp.Attributes.Value("partition")
+					ret[topic.AsString()+"/"+group.AsString()+"/"+partition.AsString()] = dp.Value
+				}
+			}
+		}
+		return ret
+	}
+	assert.Equal(t, map[string]int64{"orders/app/0": 10, "orders/app/1": 3}, collect())
+
+	r.remove(sub)
+	assert.Empty(t, collect())
+	require.NoError(t, r.close())
+}
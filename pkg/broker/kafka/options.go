@@ -1,6 +1,8 @@
 package kafka
 
 import (
+	"time"
+
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
 )
 
@@ -14,6 +16,8 @@ type Config struct {
 	SASL *SASLConfig `yaml:"sasl"`
 	// TLS TLS 配置，nil 表示明文连接
 	TLS *TLSConfig `yaml:"tls"`
+	// StatsInterval 采样消费延迟的间隔，启用指标时生效，默认 15s
+	StatsInterval time.Duration `yaml:"statsInterval"`
 }
 
 // SASLConfig SASL 认证配置。Mechanism 可选 "PLAIN" / "SCRAM-SHA-256" / "SCRAM-SHA-512"。
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/cago-frame/cago/pkg/broker/broker"
 	"github.com/cago-frame/cago/pkg/gogo"
@@ -14,21 +15,42 @@ import (
 
 type subscriber struct {
 	topic   string
+	group   string
 	readers []*kgo.Reader
-	cancel  context.CancelFunc
-	done    sync.WaitGroup
+	lag     *lagRecorder
+	// stop 停止拉取消息，cancel 同时中断 offset commit
+	stop   context.CancelFunc
+	cancel context.CancelFunc
+	done   sync.WaitGroup
 }
 
 func newSubscribe(b *kafkaBroker, topic string, handler broker.Handler, options broker.SubscribeOptions) (broker.Subscriber, error) {
+	return newReaders(b, topic, options, func(ctx, fetchCtx context.Context, r *kgo.Reader) {
+		runReader(ctx, fetchCtx, r, topic, handler, options)
+	})
+}
+
+func newBatchSubscribe(b *kafkaBroker, topic string, handler broker.BatchHandler, options broker.SubscribeOptions) (broker.Subscriber, error) {
+	return newReaders(b, topic, options, func(ctx, fetchCtx context.Context, r *kgo.Reader) {
+		runBatchReader(ctx, fetchCtx, r, topic, handler, options)
+	})
+}
+
+// newReaders 按并发数创建 Reader，每个 Reader 使用 run 拉取消息
+func newReaders(b *kafkaBroker, topic string, options broker.SubscribeOptions, run func(ctx, fetchCtx context.Context, r *kgo.Reader)) (broker.Subscriber, error) {
 	if options.Group == "" {
 		return nil, errors.New("kafka: Subscribe requires a non-empty Group (consumer group id)")
 	}
 	concurrent := max(options.Concurrent, 1)
 
 	ctx, cancel := context.WithCancel(context.Background())
+	fetchCtx, stop := context.WithCancel(ctx)
 	sub := &subscriber{
 		topic:   topic,
+		group:   options.Group,
 		readers: make([]*kgo.Reader, 0, concurrent),
+		lag:     b.lag,
+		stop:    stop,
 		cancel:  cancel,
 	}
 
@@ -44,20 +66,43 @@ func newSubscribe(b *kafkaBroker, topic string, handler broker.Handler, options
 		sub.done.Add(1)
 		gogo.Go(func() error {
 			defer sub.done.Done()
-			runReader(ctx, r, topic, handler, options)
+			run(ctx, fetchCtx, r)
+			return nil
+		})
+	}
+	if sub.lag != nil {
+		sub.done.Add(1)
+		gogo.Go(func() error {
+			defer sub.done.Done()
+			sub.sampleLag(fetchCtx, b.config.StatsInterval)
 			return nil
 		})
 	}
 	return sub, nil
 }
 
-// runReader 单个 Reader 的拉取循环，直到 ctx 被取消。
-func runReader(ctx context.Context, r *kgo.Reader, topic string, handler broker.Handler, options broker.SubscribeOptions) {
+// sampleLag 定时采样消费延迟，直到 ctx 被取消
+func (s *subscriber) sampleLag(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.lag.sample(s)
+		}
+	}
+}
+
+// runReader 单个 Reader 的拉取循环，直到 fetchCtx 被取消。
+// offset commit 使用 ctx，停止拉取后正在处理的消息仍然可以 commit。
+func runReader(ctx, fetchCtx context.Context, r *kgo.Reader, topic string, handler broker.Handler, options broker.SubscribeOptions) {
 	log := logger.Default().With(zap.String("topic", topic), zap.String("group", options.Group))
 	for {
-		msg, err := r.FetchMessage(ctx)
+		msg, err := r.FetchMessage(fetchCtx)
 		if err != nil {
-			if ctx.Err() != nil {
+			if fetchCtx.Err() != nil {
 				return // 正常关闭
 			}
 			log.Error("kafka fetch message error", zap.Error(err))
@@ -88,6 +133,67 @@ func runReader(ctx context.Context, r *kgo.Reader, topic string, handler broker.
 	}
 }
 
+// runBatchReader 单个 Reader 的批量拉取循环，直到 fetchCtx 被取消。
+// 拉到第一条消息后开始计时，凑满 BatchSize 条或者超过 BatchWait 后交给 handler，整批一起 commit。
+// 停止拉取时已经拉到的消息会作为最后一批处理。
+func runBatchReader(ctx, fetchCtx context.Context, r *kgo.Reader, topic string, handler broker.BatchHandler, options broker.SubscribeOptions) {
+	log := logger.Default().With(zap.String("topic", topic), zap.String("group", options.Group))
+	msgs := make([]kgo.Message, 0, options.BatchSize)
+	for {
+		msgs = msgs[:0]
+		msg, err := r.FetchMessage(fetchCtx)
+		if err != nil {
+			if fetchCtx.Err() != nil {
+				return // 正常关闭
+			}
+			log.Error("kafka fetch message error", zap.Error(err))
+			continue
+		}
+		msgs = append(msgs, msg)
+		waitCtx, cancel := context.WithTimeout(fetchCtx, options.BatchWait)
+		for len(msgs) < options.BatchSize {
+			msg, err := r.FetchMessage(waitCtx)
+			if err != nil {
+				if waitCtx.Err() == nil {
+					log.Error("kafka fetch message error", zap.Error(err))
+				}
+				break
+			}
+			msgs = append(msgs, msg)
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		events := make([]broker.Event, 0, len(msgs))
+		for i := range msgs {
+			events = append(events, &event{topic: topic, msg: convertMessage(&msgs[i])})
+		}
+		callCtx := options.Context
+		if callCtx == nil {
+			callCtx = context.Background()
+		}
+		handleErr := handler(callCtx, events)
+
+		commits := make([]kgo.Message, 0, len(msgs))
+		for i, ev := range events {
+			if decideCommit(handleErr, options, ev.(*event).isAct) {
+				commits = append(commits, msgs[i])
+			}
+		}
+		if len(commits) > 0 {
+			if err := r.CommitMessages(ctx, commits...); err != nil && ctx.Err() == nil {
+				log.Error("kafka commit error", zap.Error(err))
+			}
+		}
+		if len(commits) < len(msgs) && handleErr != nil {
+			log.Warn("kafka skip commit due to retry or manual ack pending",
+				zap.Bool("retry", options.Retry), zap.Int("batch", len(msgs)), zap.Error(handleErr))
+		}
+	}
+}
+
 // decideCommit 根据 handler 返回错误、Ack/Retry 选项、以及是否显式 Ack，
 // 决定是否 commit 这条消息的 offset。
 //
@@ -122,6 +228,20 @@ func convertMessage(m *kgo.Message) *broker.Message {
 func (s *subscriber) Topic() string { return s.topic }
 
 func (s *subscriber) Unsubscribe() error {
+	return s.close(true)
+}
+
+// Drain 停止拉取消息，等待正在处理的消息完成并 commit 后关闭 Reader
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.stop()
+	if err := broker.Wait(ctx, &s.done); err != nil {
+		_ = s.close(false)
+		return err
+	}
+	return s.close(true)
+}
+
+func (s *subscriber) close(wait bool) error {
 	s.cancel()
 	var firstErr error
 	for _, r := range s.readers {
@@ -129,6 +249,11 @@ func (s *subscriber) Unsubscribe() error {
 			firstErr = err
 		}
 	}
-	s.done.Wait()
+	if wait {
+		s.done.Wait()
+	}
+	if s.lag != nil {
+		s.lag.remove(s)
+	}
 	return firstErr
 }
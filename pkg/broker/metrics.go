@@ -0,0 +1,157 @@
+package broker
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	wrap2 "github.com/cago-frame/cago/pkg/utils/wrap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// metrics 消息的发布与消费指标，标签为 system、topic、group
+type metrics struct {
+	system    string
+	published metric.Int64Counter
+	consumed  metric.Int64Counter
+	acked     metric.Int64Counter
+	requeued  metric.Int64Counter
+	failed    metric.Int64Counter
+	duration  metric.Float64Histogram
+}
+
+func newMetrics(meter metric.Meter, system string) (*metrics, error) {
+	m := &metrics{system: system}
+	var err error
+	if m.published, err = meter.Int64Counter(
+		"broker_published_total", metric.WithDescription("发布的消息数量"),
+	); err != nil {
+		return nil, err
+	}
+	if m.consumed, err = meter.Int64Counter(
+		"broker_consumed_total", metric.WithDescription("消费的消息数量"),
+	); err != nil {
+		return nil, err
+	}
+	if m.acked, err = meter.Int64Counter(
+		"broker_acked_total", metric.WithDescription("确认的消息数量"),
+	); err != nil {
+		return nil, err
+	}
+	if m.requeued, err = meter.Int64Counter(
+		"broker_requeued_total", metric.WithDescription("重新入队的消息数量"),
+	); err != nil {
+		return nil, err
+	}
+	if m.failed, err = meter.Int64Counter(
+		"broker_failed_total", metric.WithDescription("发布或者处理失败的消息数量"),
+	); err != nil {
+		return nil, err
+	}
+	if m.duration, err = meter.Float64Histogram(
+		"broker_handle_duration", metric.WithDescription("消息处理耗时"), metric.WithUnit("ms"),
+	); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *metrics) attrs(topic, group string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("system", m.system),
+		attribute.String("topic", topic),
+		attribute.String("group", group),
+	)
+}
+
+// handler 记录发布与消费的指标，批量发布与消费按消息数量计数，处理耗时按批次记录
+// 没有显式 Ack 或 Requeue 时，按照 AutoAck 与 Retry 选项推断消息队列的处理方式
+func (m *metrics) handler(ctx *wrap2.Context) {
+	switch ctx.Name() {
+	case "Publish", "PublishBatch":
+		topic := ctx.Args(0).(string)
+		n := int64(1)
+		if data, ok := ctx.Args(1).([]*broker2.Message); ok {
+			n = int64(len(data))
+		}
+		ctx.Next()
+		if ctx.IsAbort() != nil {
+			m.failed.Add(ctx, n, m.attrs(topic, ""), metric.WithAttributes(
+				attribute.String("operation", "publish"),
+			))
+			return
+		}
+		m.published.Add(ctx, n, m.attrs(topic, ""))
+	case "Subscribe", "SubscribeBatch":
+		topic := ctx.Args(0).(string)
+		options := ctx.Args(2).(broker2.SubscribeOptions)
+		events, ok := ctx.Args(1).([]broker2.Event)
+		if !ok {
+			events = []broker2.Event{ctx.Args(1).(broker2.Event)}
+		}
+		n := int64(len(events))
+		attrs := m.attrs(topic, options.Group)
+		ts := time.Now()
+		ctx.Next()
+		m.consumed.Add(ctx, n, attrs)
+		m.duration.Record(ctx, float64(time.Since(ts).Microseconds())/1000, attrs)
+		err := ctx.IsAbort()
+		if err != nil {
+			m.failed.Add(ctx, n, attrs, metric.WithAttributes(
+				attribute.String("operation", "consume"),
+			))
+		}
+		// 没有显式处理的消息数量
+		pending := int64(0)
+		for _, event := range events {
+			if event, ok := event.(*metricEvent); !ok || !event.acted.Load() {
+				pending++
+			}
+		}
+		if pending == 0 {
+			return
+		}
+		switch {
+		case err == nil && options.AutoAck:
+			m.acked.Add(ctx, pending, attrs)
+		case err != nil && options.Retry:
+			m.requeued.Add(ctx, pending, attrs)
+		case err != nil && options.AutoAck:
+			m.acked.Add(ctx, pending, attrs)
+		}
+	default:
+		ctx.Next()
+	}
+}
+
+// metricEvent 记录显式的 Ack 与 Requeue
+type metricEvent struct {
+	broker2.Event
+	metrics *metrics
+	attrs   metric.MeasurementOption
+	acted   atomic.Bool
+}
+
+func (m *metrics) event(event broker2.Event, topic, group string) *metricEvent {
+	return &metricEvent{Event: event, metrics: m, attrs: m.attrs(topic, group)}
+}
+
+func (e *metricEvent) Ack() error {
+	if err := e.Event.Ack(); err != nil {
+		return err
+	}
+	e.acted.Store(true)
+	e.metrics.acked.Add(context.Background(), 1, e.attrs)
+	return nil
+}
+
+func (e *metricEvent) Requeue(delay time.Duration) error {
+	if err := e.Event.Requeue(delay); err != nil {
+		return err
+	}
+	e.acted.Store(true)
+	e.metrics.requeued.Add(context.Background(), 1, e.attrs)
+	return nil
+}
@@ -0,0 +1,98 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// requeueEvent 支持重新入队的事件
+type requeueEvent struct {
+	testEvent
+}
+
+func (e *requeueEvent) Requeue(delay time.Duration) error {
+	return nil
+}
+
+// sumOf 获取counter指定消费组的值
+func sumOf(t *testing.T, rm metricdata.ResourceMetrics, name, group string) int64 {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			require.True(t, ok)
+			var ret int64
+			for _, dp := range sum.DataPoints {
+				if v, ok := dp.Attributes.Value("group"); ok && v.AsString() == group {
+					ret += dp.Value
+				}
+			}
+			return ret
+		}
+	}
+	return 0
+}
+
+func TestWithMeter(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	raw := newSyncBroker()
+	b, err := New(WithBroker(raw), WithMeter(provider.Meter("test")))
+	require.NoError(t, err)
+
+	_, err = b.Subscribe(ctx, "ok", func(ctx context.Context, event broker2.Event) error {
+		return nil
+	}, broker2.Group("ok"))
+	require.NoError(t, err)
+	_, err = b.Subscribe(ctx, "retry", func(ctx context.Context, event broker2.Event) error {
+		return errors.New("failed")
+	}, broker2.Group("retry"), broker2.Retry())
+	require.NoError(t, err)
+	_, err = b.Subscribe(ctx, "manual", func(ctx context.Context, event broker2.Event) error {
+		return event.Requeue(time.Second)
+	}, broker2.Group("manual"), broker2.NotAutoAck())
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Publish(ctx, "ok", &broker2.Message{Body: []byte("1")}))
+	}
+	assert.Error(t, b.Publish(ctx, "retry", &broker2.Message{Body: []byte("1")}))
+	require.NoError(t, raw.handlers["manual"](ctx, &requeueEvent{testEvent{topic: "manual", msg: &broker2.Message{}}}))
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(ctx, &rm))
+	assert.Equal(t, int64(2), sumOf(t, rm, "broker_consumed_total", "ok"))
+	assert.Equal(t, int64(2), sumOf(t, rm, "broker_acked_total", "ok"))
+	assert.Equal(t, int64(1), sumOf(t, rm, "broker_failed_total", "retry"))
+	assert.Equal(t, int64(1), sumOf(t, rm, "broker_requeued_total", "retry"))
+	assert.Equal(t, int64(0), sumOf(t, rm, "broker_acked_total", "retry"))
+	assert.Equal(t, int64(1), sumOf(t, rm, "broker_requeued_total", "manual"))
+	assert.Equal(t, int64(0), sumOf(t, rm, "broker_acked_total", "manual"))
+	// 发布的消息没有消费组，syncBroker同步调用处理函数，处理失败时发布也失败
+	assert.Equal(t, int64(2), sumOf(t, rm, "broker_published_total", ""))
+
+	var histogram bool
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name == "broker_handle_duration" {
+			h := m.Data.(metricdata.Histogram[float64])
+			for _, dp := range h.DataPoints {
+				system, _ := dp.Attributes.Value(attribute.Key("system"))
+				assert.Equal(t, "sync", system.AsString())
+			}
+			histogram = true
+		}
+	}
+	assert.True(t, histogram)
+}
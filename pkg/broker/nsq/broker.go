@@ -3,6 +3,7 @@ package nsq
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/cago-frame/cago/pkg/broker/broker"
 	"github.com/nsqio/go-nsq"
@@ -11,6 +12,8 @@ import (
 type Config struct {
 	Addr          string
 	NSQLookupAddr []string
+	// MaxDelay 延迟发布的最大时间，需要与 nsqd 的 --max-req-timeout 一致，默认为1小时
+	MaxDelay time.Duration
 }
 
 type nsqBroker struct {
@@ -31,6 +34,9 @@ func NewBroker(config Config, options ...broker.Option) (broker.Broker, error) {
 		return nil, err
 	}
 	producer.SetLoggerLevel(nsq.LogLevelError)
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = time.Hour
+	}
 	return &nsqBroker{
 		config:    &config,
 		nsqConfig: nsqConfig,
@@ -44,9 +50,42 @@ func (b *nsqBroker) Publish(ctx context.Context, topic string, data *broker.Mess
 	if err != nil {
 		return err
 	}
+	options := broker.NewPublishOptions(opt...)
+	if d := options.Delay(); d > 0 {
+		if !b.SupportDelay(d) {
+			return broker.ErrDelayUnsupported
+		}
+		return b.producer.DeferredPublish(topic, d, bt)
+	}
 	return b.producer.Publish(topic, bt)
 }
 
+// PublishBatch 使用 MultiPublish 发布整批消息，延迟发布时逐条发布
+func (b *nsqBroker) PublishBatch(ctx context.Context, topic string, data []*broker.Message, opts ...broker.PublishOption) error {
+	if broker.NewPublishOptions(opts...).Delay() > 0 {
+		for _, v := range data {
+			if err := b.Publish(ctx, topic, v, opts...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	body := make([][]byte, 0, len(data))
+	for _, v := range data {
+		bt, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		body = append(body, bt)
+	}
+	return b.producer.MultiPublish(topic, body)
+}
+
+// SupportDelay 使用 DeferredPublish 实现延迟发布，不能超过 MaxDelay
+func (b *nsqBroker) SupportDelay(d time.Duration) bool {
+	return d <= b.config.MaxDelay
+}
+
 func (b *nsqBroker) Subscribe(ctx context.Context, topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
 	return newSubscribe(b, topic, h, broker.NewSubscribeOptions(opts...))
 }
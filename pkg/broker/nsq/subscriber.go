@@ -104,3 +104,14 @@ func (s *subscribe) Unsubscribe() error {
 	}
 	return s.consumer.DisconnectFromNSQD(s.config.Addr)
 }
+
+// Drain 停止接收消息，nsq 会等待正在处理的消息完成后关闭连接
+func (s *subscribe) Drain(ctx context.Context) error {
+	s.consumer.Stop()
+	select {
+	case <-s.consumer.StopChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
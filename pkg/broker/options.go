@@ -1,7 +1,11 @@
 package broker
 
 import (
+	"time"
+
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/broker/scheduler"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -9,9 +13,17 @@ type Option func(options *Options)
 
 type Options struct {
 	tracer       trace.Tracer
+	meter        metric.Meter
+	metrics      *metrics
 	broker       broker2.Broker
 	defaultGroup string
 	topicPrefix  string
+	scheduler    *scheduler.Scheduler
+	drainTimeout time.Duration
+	replyTopic   string
+
+	publishInterceptors   []PublishInterceptor
+	subscribeInterceptors []SubscribeInterceptor
 }
 
 func WithTracer(t trace.Tracer) Option {
@@ -20,6 +32,13 @@ func WithTracer(t trace.Tracer) Option {
 	}
 }
 
+// WithMeter 记录消息的发布与消费指标
+func WithMeter(m metric.Meter) Option {
+	return func(options *Options) {
+		options.meter = m
+	}
+}
+
 func WithBroker(b broker2.Broker) Option {
 	return func(options *Options) {
 		options.broker = b
@@ -37,3 +56,29 @@ func WithTopicPrefix(prefix string) Option {
 		options.topicPrefix = prefix
 	}
 }
+
+// WithScheduler 设置延迟消息调度器，broker不支持原生延迟发布时，由调度器保存并在到期后发布
+// 调度器随broker一起启动与关闭；保存的是执行完拦截器、链路追踪与 CloudEvents 之后带前缀的消息，
+// 到期后直接发布到原始的broker，不会再经过这些处理，发布消息的指标在保存时记录，到期投递失败只记录日志并在租约过期后重试
+func WithScheduler(s *scheduler.Scheduler) Option {
+	return func(options *Options) {
+		options.scheduler = s
+	}
+}
+
+// WithDrainTimeout 设置关闭broker时等待订阅者处理完消息的最长时间，默认为5秒
+// 应用停止时最多等待组件关闭10秒，需要小于该时间
+func WithDrainTimeout(d time.Duration) Option {
+	return func(options *Options) {
+		options.drainTimeout = d
+	}
+}
+
+// WithReplyTopic 设置当前实例接收回复的topic(不包含前缀)，同时作为消费组，每个实例需要不同
+// 默认在第一次请求时生成随机的 reply.<随机字符串>，实例重启后会变化；
+// 对于会持久化消费组的broker(例如nsq、kafka、sql)建议设置为稳定的名称(例如 reply.<实例名>)，避免每次启动留下新的topic与消费组
+func WithReplyTopic(topic string) Option {
+	return func(options *Options) {
+		options.replyTopic = topic
+	}
+}
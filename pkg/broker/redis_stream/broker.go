@@ -0,0 +1,132 @@
+package redis_stream
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// dataField 主stream中存放消息的字段
+	dataField = "data"
+	// retryField 重试stream中存放消息的字段
+	retryField = "retry"
+)
+
+// retryEntry 重新入队的消息，每个消费组有自己的延迟队列与重试stream，不会影响其它消费组
+type retryEntry struct {
+	// ID 保证延迟队列中的成员唯一
+	ID        string          `json:"id"`
+	Attempted int             `json:"attempted"`
+	Message   *broker.Message `json:"message"`
+}
+
+type redisStreamBroker struct {
+	client      *redis.Client
+	config      Config
+	closeClient bool
+}
+
+// NewBroker 使用 Redis Streams 实现的 broker，关闭时不会关闭传入的redis客户端
+// 订阅需要设置 Group，同一个消费组内的消费者共同消费消息
+func NewBroker(client *redis.Client, cfg Config) broker.Broker {
+	return newBroker(client, cfg, false)
+}
+
+func newBroker(client *redis.Client, cfg Config, closeClient bool) *redisStreamBroker {
+	return &redisStreamBroker{
+		client:      client,
+		config:      cfg.withDefaults(),
+		closeClient: closeClient,
+	}
+}
+
+// Publish 不支持延迟发布，需要使用 broker.WithScheduler 设置调度器
+func (b *redisStreamBroker) Publish(ctx context.Context, topic string, data *broker.Message, opts ...broker.PublishOption) error {
+	if broker.NewPublishOptions(opts...).Delay() > 0 {
+		return broker.ErrDelayUnsupported
+	}
+	args, err := b.xaddArgs(topic, data)
+	if err != nil {
+		return err
+	}
+	return b.client.XAdd(ctx, args).Err()
+}
+
+// PublishBatch 使用 pipeline 发布整批消息
+func (b *redisStreamBroker) PublishBatch(ctx context.Context, topic string, data []*broker.Message, opts ...broker.PublishOption) error {
+	if broker.NewPublishOptions(opts...).Delay() > 0 {
+		return broker.ErrDelayUnsupported
+	}
+	pipe := b.client.Pipeline()
+	for _, v := range data {
+		args, err := b.xaddArgs(topic, v)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, args)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *redisStreamBroker) xaddArgs(topic string, data *broker.Message) (*redis.XAddArgs, error) {
+	bt, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	args := &redis.XAddArgs{
+		Stream: topic,
+		Values: []interface{}{dataField, bt},
+	}
+	if b.config.MaxLen > 0 {
+		args.MaxLen = b.config.MaxLen
+		args.Approx = true
+	}
+	return args, nil
+}
+
+func (b *redisStreamBroker) Subscribe(ctx context.Context, topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	return newSubscriber(ctx, b, topic, h, broker.NewSubscribeOptions(opts...))
+}
+
+func (b *redisStreamBroker) Close() error {
+	if b.closeClient {
+		return b.client.Close()
+	}
+	return nil
+}
+
+func (b *redisStreamBroker) String() string {
+	return "redis_stream"
+}
+
+// retryStream 消费组的重试stream
+func retryStream(topic, group string) string {
+	return topic + ":" + group + ":retry"
+}
+
+// delayedKey 消费组的延迟队列
+func delayedKey(topic, group string) string {
+	return topic + ":" + group + ":delayed"
+}
+
+// moveScript 将到期的延迟消息移动到重试stream
+var moveScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, v in ipairs(items) do
+	redis.call('ZREM', KEYS[1], v)
+	redis.call('XADD', KEYS[2], '*', 'retry', v)
+end
+return #items
+`)
+
+func (b *redisStreamBroker) moveDelayed(ctx context.Context, topic, group string) error {
+	return moveScript.Run(ctx, b.client,
+		[]string{delayedKey(topic, group), retryStream(topic, group)},
+		time.Now().UnixMilli(), b.config.Batch,
+	).Err()
+}
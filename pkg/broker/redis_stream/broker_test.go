@@ -0,0 +1,173 @@
+package redis_stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cago-frame/cago/pkg/broker"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBroker(t *testing.T, cfg Config) (broker2.Broker, *miniredis.Miniredis) {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	if cfg.Block == 0 {
+		cfg.Block = 50 * time.Millisecond
+	}
+	return NewBroker(client, cfg), m
+}
+
+type received struct {
+	sync.Mutex
+	events []broker2.Event
+}
+
+func (r *received) add(e broker2.Event) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *received) len() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.events)
+}
+
+func TestRedisStreamFactoryRegistered(t *testing.T) {
+	assert.NotNil(t, broker.GetFactory("redis_stream"))
+}
+
+func TestBroker_Group(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBroker(t, Config{})
+	_, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		return nil
+	})
+	assert.Error(t, err)
+
+	// 每个消费组都会收到一次消息，组内只有一个消费者收到
+	g1, g2 := &received{}, &received{}
+	sub1, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		g1.add(event)
+		return nil
+	}, broker2.Group("g1"), broker2.WithConcurrent(3))
+	require.NoError(t, err)
+	defer sub1.Unsubscribe() //nolint:errcheck
+	sub2, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		g2.add(event)
+		return nil
+	}, broker2.Group("g2"))
+	require.NoError(t, err)
+	defer sub2.Unsubscribe() //nolint:errcheck
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{
+			Header: map[string]string{"k": "v"},
+			Body:   []byte("hello"),
+		}))
+	}
+	assert.Eventually(t, func() bool {
+		return g1.len() == 5 && g2.len() == 5
+	}, 3*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 5, g1.len())
+	e := g1.events[0]
+	assert.Equal(t, "topic", e.Topic())
+	assert.Equal(t, "v", e.Message().Header["k"])
+	assert.Equal(t, []byte("hello"), e.Message().Body)
+	assert.Equal(t, 1, e.Attempted())
+}
+
+func TestBroker_Requeue(t *testing.T) {
+	ctx := context.Background()
+	b, m := newTestBroker(t, Config{})
+	attempts := make(chan int, 10)
+	sub, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		attempts <- event.Attempted()
+		if event.Attempted() < 3 {
+			return event.Requeue(100 * time.Millisecond)
+		}
+		return nil
+	}, broker2.Group("g1"))
+	require.NoError(t, err)
+	defer sub.Unsubscribe() //nolint:errcheck
+
+	start := time.Now()
+	require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("hello")}))
+	for i := 1; i <= 3; i++ {
+		select {
+		case n := <-attempts:
+			assert.Equal(t, i, n)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	// 延迟队列已经清空
+	assert.Eventually(t, func() bool {
+		return !m.Exists(delayedKey("topic", "g1"))
+	}, time.Second, 10*time.Millisecond)
+
+	// Retry 选项
+	var calls atomic.Int32
+	sub2, err := b.Subscribe(ctx, "retry", func(ctx context.Context, event broker2.Event) error {
+		if calls.Add(1) == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	}, broker2.Group("g1"), broker2.Retry())
+	require.NoError(t, err)
+	defer sub2.Unsubscribe() //nolint:errcheck
+	require.NoError(t, b.Publish(ctx, "retry", &broker2.Message{Body: []byte("hello")}))
+	assert.Eventually(t, func() bool {
+		return calls.Load() == 2
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestBroker_Claim(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBroker(t, Config{MinIdle: 50 * time.Millisecond, ClaimInterval: 50 * time.Millisecond})
+	// 不确认消息，模拟消费者崩溃
+	first := make(chan struct{}, 1)
+	sub, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		first <- struct{}{}
+		return nil
+	}, broker2.Group("g1"), broker2.NotAutoAck())
+	require.NoError(t, err)
+	require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("hello")}))
+	select {
+	case <-first:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+	require.NoError(t, sub.Unsubscribe())
+
+	// 每次认领后都不确认，投递次数继续增加
+	attempted := make(chan int, 1)
+	for _, want := range []int{2, 3, 4} {
+		sub, err = b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+			attempted <- event.Attempted()
+			return nil
+		}, broker2.Group("g1"), broker2.NotAutoAck())
+		require.NoError(t, err)
+		select {
+		case n := <-attempted:
+			assert.Equal(t, want, n)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout")
+		}
+		require.NoError(t, sub.Unsubscribe())
+	}
+}
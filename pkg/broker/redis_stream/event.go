@@ -0,0 +1,92 @@
+package redis_stream
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+type event struct {
+	ctx    context.Context
+	b      *redisStreamBroker
+	topic  string
+	group  string
+	stream string
+	id     string
+	data   *broker.Message
+	// isAct 是否已经执行过Ack或者Requeue
+	isAct     bool
+	attempted int
+}
+
+func (e *event) Topic() string {
+	return e.topic
+}
+
+func (e *event) Message() *broker.Message {
+	return e.data
+}
+
+func (e *event) Ack() error {
+	_, err := e.b.client.TxPipelined(e.ctx, func(pipe redis.Pipeliner) error {
+		e.ack(pipe)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	e.isAct = true
+	return nil
+}
+
+func (e *event) ack(pipe redis.Pipeliner) {
+	pipe.XAck(e.ctx, e.stream, e.group, e.id)
+	if e.stream != e.topic {
+		// 重试stream中的消息只属于当前消费组，确认后直接删除
+		pipe.XDel(e.ctx, e.stream, e.id)
+	}
+}
+
+func (e *event) Error() error {
+	return nil
+}
+
+// Requeue 重新入队，只会重新投递给当前消费组
+func (e *event) Requeue(delay time.Duration) error {
+	entry, err := json.Marshal(&retryEntry{
+		ID:        utils.RandString(16, utils.Mix),
+		Attempted: e.attempted + 1,
+		Message:   e.data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.b.client.TxPipelined(e.ctx, func(pipe redis.Pipeliner) error {
+		if delay > 0 {
+			pipe.ZAdd(e.ctx, delayedKey(e.topic, e.group), redis.Z{
+				Score:  float64(time.Now().Add(delay).UnixMilli()),
+				Member: entry,
+			})
+		} else {
+			pipe.XAdd(e.ctx, &redis.XAddArgs{
+				Stream: retryStream(e.topic, e.group),
+				Values: []interface{}{retryField, entry},
+			})
+		}
+		e.ack(pipe)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	e.isAct = true
+	return nil
+}
+
+func (e *event) Attempted() int {
+	return e.attempted
+}
@@ -0,0 +1,36 @@
+package redis_stream
+
+import "time"
+
+// Config Redis Streams broker 配置。Addr 为空时使用 database/redis 的默认客户端。
+type Config struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"` //nolint:gosec // G117
+	DB       int    `yaml:"db"`
+	// MaxLen stream 的最大长度(近似裁剪)，为0时不裁剪
+	MaxLen int64 `yaml:"maxLen"`
+	// Block 每次拉取消息的最大阻塞时间，默认为1s，同时也是取消订阅的最长等待时间
+	Block time.Duration `yaml:"block"`
+	// Batch 每次拉取的消息数量，默认为10
+	Batch int64 `yaml:"batch"`
+	// MinIdle 消息投递后超过该时间未确认，会被其它消费者重新认领，默认为1分钟
+	MinIdle time.Duration `yaml:"minIdle"`
+	// ClaimInterval 检查未确认消息的间隔，默认为30s
+	ClaimInterval time.Duration `yaml:"claimInterval"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.Block <= 0 {
+		c.Block = time.Second
+	}
+	if c.Batch <= 0 {
+		c.Batch = 10
+	}
+	if c.MinIdle <= 0 {
+		c.MinIdle = time.Minute
+	}
+	if c.ClaimInterval <= 0 {
+		c.ClaimInterval = 30 * time.Second
+	}
+	return c
+}
@@ -0,0 +1,38 @@
+package redis_stream
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cago-frame/cago/configs"
+	redis2 "github.com/cago-frame/cago/database/redis"
+	"github.com/cago-frame/cago/pkg/broker"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	broker.RegisterBroker("redis_stream", func(ctx context.Context, cfg *configs.Config) (broker2.Broker, error) {
+		c := &Config{}
+		if err := cfg.Scan(ctx, "broker.redis_stream", c); err != nil {
+			return nil, err
+		}
+		if c.Addr == "" {
+			client := redis2.Default()
+			if client == nil {
+				return nil, errors.New("redis_stream: broker.redis_stream.addr is empty and redis component is not started")
+			}
+			return newBroker(client, *c, false), nil
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:     c.Addr,
+			Password: c.Password,
+			DB:       c.DB,
+		})
+		if err := client.Ping(ctx).Err(); err != nil {
+			_ = client.Close()
+			return nil, err
+		}
+		return newBroker(client, *c, true), nil
+	})
+}
@@ -0,0 +1,269 @@
+package redis_stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/gogo"
+	"github.com/cago-frame/cago/pkg/logger"
+	"github.com/cago-frame/cago/pkg/utils"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type subscriber struct {
+	b       *redisStreamBroker
+	topic   string
+	retry   string
+	handler broker.Handler
+	options broker.SubscribeOptions
+	logger  *zap.Logger
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+}
+
+func newSubscriber(ctx context.Context, b *redisStreamBroker, topic string, handler broker.Handler, options broker.SubscribeOptions) (broker.Subscriber, error) {
+	if options.Group == "" {
+		return nil, errors.New("redis_stream: Subscribe requires a non-empty Group (consumer group)")
+	}
+	retry := retryStream(topic, options.Group)
+	// 新的消费组只消费之后的消息，重试stream只属于当前消费组，从头开始消费
+	if err := createGroup(ctx, b.client, topic, options.Group, "$"); err != nil {
+		return nil, err
+	}
+	if err := createGroup(ctx, b.client, retry, options.Group, "0"); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscriber{
+		b:       b,
+		topic:   topic,
+		retry:   retry,
+		handler: handler,
+		options: options,
+		logger: logger.Default().With(
+			zap.String("topic", topic), zap.String("group", options.Group),
+		),
+		cancel: cancel,
+	}
+	hostname, _ := os.Hostname()
+	name := hostname + "-" + utils.RandString(8, utils.Mix)
+	for i := range max(options.Concurrent, 1) {
+		consumer := fmt.Sprintf("%s-%d", name, i)
+		sub.done.Add(1)
+		gogo.Go(func() error {
+			defer sub.done.Done()
+			sub.consume(ctx, consumer)
+			return nil
+		})
+	}
+	return sub, nil
+}
+
+func createGroup(ctx context.Context, client *redis.Client, stream, group, start string) error {
+	err := client.XGroupCreateMkStream(ctx, stream, group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// consume 单个消费者的拉取循环，直到 ctx 被取消
+func (s *subscriber) consume(ctx context.Context, consumer string) {
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if err := s.b.moveDelayed(ctx, s.topic, s.options.Group); err != nil && ctx.Err() == nil {
+			s.logger.Error("redis stream move delayed message error", zap.Error(err))
+		}
+		// 认领其它消费者(例如已经崩溃的)超时未确认的消息
+		if time.Since(lastClaim) >= s.b.config.ClaimInterval {
+			s.claim(ctx, consumer)
+			lastClaim = time.Now()
+		}
+		streams, err := s.b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.options.Group,
+			Consumer: consumer,
+			Streams:  []string{s.topic, s.retry, ">", ">"},
+			Count:    s.b.config.Batch,
+			Block:    s.b.config.Block,
+		}).Result()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, redis.Nil) {
+				s.logger.Error("redis stream read error", zap.Error(err))
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				// 停止后没有处理的消息留在待确认列表中，由其它消费者认领
+				if ctx.Err() != nil {
+					return
+				}
+				s.handle(stream.Stream, msg, 1)
+			}
+		}
+	}
+}
+
+func (s *subscriber) claim(ctx context.Context, consumer string) {
+	for _, stream := range []string{s.topic, s.retry} {
+		messages, _, err := s.b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    s.options.Group,
+			Consumer: consumer,
+			MinIdle:  s.b.config.MinIdle,
+			Start:    "0-0",
+			Count:    s.b.config.Batch,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Error("redis stream claim error", zap.Error(err))
+			}
+			return
+		}
+		deliveries := s.deliveries(ctx, stream, messages)
+		for _, msg := range messages {
+			if ctx.Err() != nil {
+				return
+			}
+			s.handle(stream, msg, deliveries[msg.ID])
+		}
+	}
+}
+
+// deliveries 从待确认列表中查询认领的消息已经投递的次数(包括这次认领)
+// 查询失败时按照投递了两次处理
+func (s *subscriber) deliveries(ctx context.Context, stream string, messages []redis.XMessage) map[string]int64 {
+	ret := make(map[string]int64, len(messages))
+	for _, msg := range messages {
+		ret[msg.ID] = 2
+	}
+	if len(messages) == 0 {
+		return ret
+	}
+	cmds, err := s.b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, msg := range messages {
+			pipe.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: stream,
+				Group:  s.options.Group,
+				Start:  msg.ID,
+				End:    msg.ID,
+				Count:  1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("redis stream pending error", zap.Error(err))
+		return ret
+	}
+	for _, cmd := range cmds {
+		for _, pending := range cmd.(*redis.XPendingExtCmd).Val() {
+			ret[pending.ID] = max(pending.RetryCount, 2)
+		}
+	}
+	return ret
+}
+
+// handle 处理一条消息，deliveries 为这条消息在stream中的投递次数，认领的消息大于1
+func (s *subscriber) handle(stream string, msg redis.XMessage, deliveries int64) {
+	ctx := s.options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ev := &event{
+		ctx:       ctx,
+		b:         s.b,
+		topic:     s.topic,
+		group:     s.options.Group,
+		stream:    stream,
+		id:        msg.ID,
+		attempted: 1,
+	}
+	if err := s.decode(ev, msg); err != nil {
+		s.logger.Error("redis stream unmarshal error", zap.String("id", msg.ID), zap.Error(err))
+		if err := ev.Ack(); err != nil {
+			s.logger.Error("redis stream ack error", zap.Error(err))
+		}
+		return
+	}
+	// 认领的消息之前已经投递过，每次认领都会增加投递次数，崩溃的消息最终也能达到最大重试次数
+	ev.attempted += int(deliveries) - 1
+	err := s.handler(ctx, ev)
+	if err != nil {
+		if !ev.isAct {
+			if s.options.Retry {
+				err = errors.Join(err, ev.Requeue(retryDelay(ev.attempted)))
+				s.logger.Error("redis stream subscriber handle error", zap.Bool("retry", true), zap.Error(err))
+				return
+			} else if s.options.AutoAck {
+				err = errors.Join(err, ev.Ack())
+			}
+		}
+		s.logger.Error("redis stream subscriber handle error", zap.Error(err))
+	} else if s.options.AutoAck && !ev.isAct {
+		if err := ev.Ack(); err != nil {
+			s.logger.Error("redis stream ack error", zap.Error(err))
+		}
+	}
+}
+
+func (s *subscriber) decode(ev *event, msg redis.XMessage) error {
+	if ev.stream == s.topic {
+		data, ok := msg.Values[dataField].(string)
+		if !ok {
+			return errors.New("message has no data field")
+		}
+		ev.data = &broker.Message{}
+		return json.Unmarshal([]byte(data), ev.data)
+	}
+	data, ok := msg.Values[retryField].(string)
+	if !ok {
+		return errors.New("message has no retry field")
+	}
+	entry := &retryEntry{}
+	if err := json.Unmarshal([]byte(data), entry); err != nil {
+		return err
+	}
+	if entry.Message == nil {
+		entry.Message = &broker.Message{}
+	}
+	ev.data = entry.Message
+	ev.attempted = entry.Attempted
+	return nil
+}
+
+// retryDelay 使用 Retry 选项时重新入队的延迟
+func retryDelay(attempted int) time.Duration {
+	return min(time.Duration(attempted)*time.Second, time.Minute)
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	s.cancel()
+	s.done.Wait()
+	return nil
+}
+
+// Drain 停止读取消息，等待正在处理的消息完成并确认
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.cancel()
+	return broker.Wait(ctx, &s.done)
+}
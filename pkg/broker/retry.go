@@ -0,0 +1,127 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// retry 按重试策略处理消息，超过最大次数后发送到死信队列
+// topic 为不包含前缀的原始topic
+// 处理次数使用消息队列记录的投递次数，失败后按退避间隔延迟重新入队，不占用消费协程；
+// 消息队列不支持重新入队(例如kafka)时在当前协程等待后重试
+func (t *wrap) retry(ctx context.Context, topic string, event broker2.Event,
+	h broker2.Handler, options broker2.SubscribeOptions) error {
+	policy := options.RetryPolicy
+	msg := event.Message()
+	if msg.Header == nil {
+		msg.Header = make(map[string]string)
+	}
+	attempt := max(event.Attempted(), 1)
+	requeue := true
+	for {
+		msg.Header[HeaderAttempt] = strconv.Itoa(attempt)
+		err := h(ctx, event)
+		if err == nil {
+			return nil
+		}
+		if attempt >= policy.MaxAttempts {
+			return t.deadLetter(ctx, topic, event, err, options)
+		}
+		backoff := policy.Backoff(attempt)
+		if requeue {
+			rqErr := event.Requeue(backoff)
+			if rqErr == nil {
+				logger.Ctx(ctx).Warn("broker handle error, requeue",
+					zap.Int("attempt", attempt), zap.Duration("delay", backoff), zap.Error(err))
+				return nil
+			}
+			if !errors.Is(rqErr, broker2.ErrRequeueUnsupported) {
+				// 由消息队列本身决定是否重新投递
+				logger.Ctx(ctx).Error("broker requeue error",
+					zap.Int("attempt", attempt), zap.NamedError("handle_error", err), zap.Error(rqErr))
+				return err
+			}
+			requeue = false
+		}
+		logger.Ctx(ctx).Warn("broker handle error, retry",
+			zap.Int("attempt", attempt), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			// 停止重试，由消息队列本身决定是否重新投递
+			return err
+		case <-time.After(backoff):
+		}
+		attempt++
+	}
+}
+
+// deadLetter 将消息发送到死信队列，发送成功后确认原消息
+func (t *wrap) deadLetter(ctx context.Context, topic string, event broker2.Event,
+	handleErr error, options broker2.SubscribeOptions) error {
+	msg := event.Message()
+	header := make(map[string]string, len(msg.Header)+4)
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+	header[HeaderDeadLetterTopic] = topic
+	header[HeaderDeadLetterGroup] = options.Group
+	header[HeaderDeadLetterError] = handleErr.Error()
+	header[HeaderDeadLetterTime] = time.Now().Format(time.RFC3339)
+	dlq := options.RetryPolicy.DeadLetterTopic
+	if dlq == "" {
+		dlq = broker2.DeadLetterTopic(topic)
+	}
+	if t.options.topicPrefix != "" {
+		dlq = t.options.topicPrefix + "." + dlq
+	}
+	if err := t.Broker.Publish(ctx, dlq, &broker2.Message{Header: header, Body: msg.Body}); err != nil {
+		logger.Ctx(ctx).Error("broker publish dead letter error",
+			zap.String("dlq", dlq), zap.NamedError("handle_error", handleErr), zap.Error(err))
+		return handleErr
+	}
+	logger.Ctx(ctx).Error("broker handle error, send to dead letter topic",
+		zap.String("dlq", dlq), zap.Error(handleErr))
+	if !options.AutoAck {
+		return event.Ack()
+	}
+	return nil
+}
+
+// 重新导出消息头，方便使用
+const (
+	HeaderAttempt         = broker2.HeaderAttempt
+	HeaderDeadLetterTopic = broker2.HeaderDeadLetterTopic
+	HeaderDeadLetterGroup = broker2.HeaderDeadLetterGroup
+	HeaderDeadLetterError = broker2.HeaderDeadLetterError
+	HeaderDeadLetterTime  = broker2.HeaderDeadLetterTime
+)
+
+// ReplayDeadLetter 订阅死信队列，将消息去掉死信与重试的消息头后重新发布到原始的topic
+// dlq 为死信队列的topic，例如 broker2.DeadLetterTopic("order")，返回的订阅者用于停止重放
+// b 需要与发送死信的broker使用相同的topic前缀
+func ReplayDeadLetter(ctx context.Context, b broker2.Broker, dlq string,
+	opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	return b.Subscribe(ctx, dlq, func(ctx context.Context, event broker2.Event) error {
+		msg := event.Message()
+		topic := msg.Header[HeaderDeadLetterTopic]
+		if topic == "" {
+			return errors.New("dead letter message has no original topic")
+		}
+		header := make(map[string]string, len(msg.Header))
+		for k, v := range msg.Header {
+			switch k {
+			case HeaderAttempt, HeaderDeadLetterTopic, HeaderDeadLetterGroup,
+				HeaderDeadLetterError, HeaderDeadLetterTime:
+			default:
+				header[k] = v
+			}
+		}
+		return b.Publish(ctx, topic, &broker2.Message{Header: header, Body: msg.Body})
+	}, opts...)
+}
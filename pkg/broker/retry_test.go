@@ -0,0 +1,183 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	wrap2 "github.com/cago-frame/cago/pkg/utils/wrap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testEvent struct {
+	broker2.Event
+	topic string
+	msg   *broker2.Message
+	acked bool
+}
+
+func (e *testEvent) Topic() string             { return e.topic }
+func (e *testEvent) Message() *broker2.Message { return e.msg }
+func (e *testEvent) Attempted() int            { return 0 }
+
+func (e *testEvent) Ack() error {
+	e.acked = true
+	return nil
+}
+
+// Requeue 与kafka一样不支持重新入队
+func (e *testEvent) Requeue(delay time.Duration) error {
+	return broker2.ErrRequeueUnsupported
+}
+
+// delayEvent 支持延迟重新入队，记录重新入队的延迟，投递次数由消息队列记录
+type delayEvent struct {
+	testEvent
+	attempted int
+	delay     time.Duration
+}
+
+func (e *delayEvent) Attempted() int { return e.attempted }
+
+func (e *delayEvent) Requeue(delay time.Duration) error {
+	e.delay = delay
+	return nil
+}
+
+// syncBroker 发布时同步调用订阅者
+type syncBroker struct {
+	broker2.Broker
+	handlers  map[string]broker2.Handler
+	published map[string][]*broker2.Message
+}
+
+func newSyncBroker() *syncBroker {
+	return &syncBroker{
+		handlers:  make(map[string]broker2.Handler),
+		published: make(map[string][]*broker2.Message),
+	}
+}
+
+func (b *syncBroker) Publish(ctx context.Context, topic string, data *broker2.Message, opts ...broker2.PublishOption) error {
+	b.published[topic] = append(b.published[topic], data)
+	if h, ok := b.handlers[topic]; ok {
+		return h(ctx, &testEvent{topic: topic, msg: data})
+	}
+	return nil
+}
+
+func (b *syncBroker) Subscribe(ctx context.Context, topic string, h broker2.Handler, opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	b.handlers[topic] = h
+	return nil, nil
+}
+
+func (b *syncBroker) Close() error { return nil }
+
+func (b *syncBroker) String() string { return "sync" }
+
+func TestRetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	raw := newSyncBroker()
+	b := newWrap(raw, wrap2.New(), &Options{topicPrefix: "app", defaultGroup: "group"})
+	policy := broker2.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond}
+
+	// 第三次处理成功
+	attempts := make([]string, 0)
+	_, err := b.Subscribe(ctx, "order", func(ctx context.Context, event broker2.Event) error {
+		attempts = append(attempts, event.Message().Header[HeaderAttempt])
+		assert.Equal(t, len(attempts), broker2.Attempt(event))
+		if len(attempts) < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	}, broker2.WithRetryPolicy(policy))
+	require.NoError(t, err)
+	require.NoError(t, b.Publish(ctx, "order", &broker2.Message{Body: []byte("1")}))
+	assert.Equal(t, []string{"1", "2", "3"}, attempts)
+	assert.Empty(t, raw.published["app.order.dlq"])
+
+	// 超过次数后发送到死信队列
+	calls := 0
+	_, err = b.Subscribe(ctx, "order", func(ctx context.Context, event broker2.Event) error {
+		calls++
+		return errors.New("always failed")
+	}, broker2.WithRetryPolicy(policy), broker2.NotAutoAck())
+	require.NoError(t, err)
+	require.NoError(t, raw.handlers["app.order"](ctx, &testEvent{
+		topic: "app.order", msg: &broker2.Message{Header: map[string]string{"k": "v"}, Body: []byte("2")},
+	}))
+	assert.Equal(t, 3, calls)
+	require.Len(t, raw.published["app.order.dlq"], 1)
+	dlq := raw.published["app.order.dlq"][0]
+	assert.Equal(t, []byte("2"), dlq.Body)
+	assert.Equal(t, "v", dlq.Header["k"])
+	assert.Equal(t, "3", dlq.Header[HeaderAttempt])
+	assert.Equal(t, "order", dlq.Header[HeaderDeadLetterTopic])
+	assert.Equal(t, "group", dlq.Header[HeaderDeadLetterGroup])
+	assert.Equal(t, "always failed", dlq.Header[HeaderDeadLetterError])
+	assert.NotEmpty(t, dlq.Header[HeaderDeadLetterTime])
+
+	// 重放死信队列
+	calls = 0
+	_, err = b.Subscribe(ctx, "order", func(ctx context.Context, event broker2.Event) error {
+		calls++
+		assert.Equal(t, "1", event.Message().Header[HeaderAttempt])
+		assert.Empty(t, event.Message().Header[HeaderDeadLetterError])
+		return nil
+	}, broker2.WithRetryPolicy(policy))
+	require.NoError(t, err)
+	_, err = ReplayDeadLetter(ctx, b, broker2.DeadLetterTopic("order"))
+	require.NoError(t, err)
+	require.NoError(t, raw.Publish(ctx, "app.order.dlq", dlq))
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryPolicy_Requeue(t *testing.T) {
+	ctx := context.Background()
+	raw := newSyncBroker()
+	b := newWrap(raw, wrap2.New(), &Options{topicPrefix: "app", defaultGroup: "group"})
+	policy := broker2.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Minute, MaxInterval: time.Hour, Jitter: -1}
+
+	calls := 0
+	_, err := b.Subscribe(ctx, "order", func(ctx context.Context, event broker2.Event) error {
+		calls++
+		return errors.New("failed")
+	}, broker2.WithRetryPolicy(policy))
+	require.NoError(t, err)
+
+	// 失败后延迟重新入队，不在消费协程中等待
+	event := &delayEvent{testEvent: testEvent{topic: "app.order", msg: &broker2.Message{}}, attempted: 1}
+	require.NoError(t, raw.handlers["app.order"](ctx, event))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, time.Minute, event.delay)
+	assert.Empty(t, raw.published["app.order.dlq"])
+
+	// 使用消息队列记录的投递次数，超过次数后发送到死信队列
+	event = &delayEvent{testEvent: testEvent{topic: "app.order", msg: &broker2.Message{}}, attempted: 3}
+	require.NoError(t, raw.handlers["app.order"](ctx, event))
+	assert.Equal(t, 2, calls)
+	assert.Zero(t, event.delay)
+	require.Len(t, raw.published["app.order.dlq"], 1)
+	assert.Equal(t, "3", raw.published["app.order.dlq"][0].Header[HeaderAttempt])
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := broker2.RetryPolicy{
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+	}.WithDefaults()
+	p.Jitter = 0
+	assert.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 400*time.Millisecond, p.Backoff(3))
+	assert.Equal(t, time.Second, p.Backoff(10))
+	p.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		d := p.Backoff(2)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 300*time.Millisecond)
+	}
+}
@@ -0,0 +1,134 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/logger"
+	"github.com/cago-frame/cago/pkg/utils"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ErrNotRequest 消息不是请求，没有回复的topic或者关联ID
+var ErrNotRequest = errors.New("broker: message is not a request")
+
+// ErrRequesterClosed broker已经排空或者关闭，不会再收到回复
+var ErrRequesterClosed = errors.New("broker: requester closed")
+
+// 重新导出消息头，方便使用
+const (
+	HeaderReplyTo       = broker2.HeaderReplyTo
+	HeaderCorrelationID = broker2.HeaderCorrelationID
+)
+
+// requesters 每个broker实例的请求者
+var requesters sync.Map
+
+// requester 在当前实例独有的topic上接收回复，按关联ID交给等待的请求
+type requester struct {
+	mu      sync.Mutex
+	topic   string
+	sub     broker2.Subscriber
+	pending sync.Map
+	closed  chan struct{}
+}
+
+func requesterOf(ctx context.Context, b broker2.Broker) (*requester, error) {
+	v, _ := requesters.LoadOrStore(b, &requester{closed: make(chan struct{})})
+	r := v.(*requester)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.topic != "" {
+		return r, nil
+	}
+	// 每个实例使用自己的topic与消费组，回复只会投递给发出请求的实例
+	topic := ""
+	if w, ok := b.(*wrap); ok {
+		topic = w.options.replyTopic
+	}
+	if topic == "" {
+		topic = "reply." + utils.RandString(16, utils.Letter)
+	}
+	sub, err := b.Subscribe(ctx, topic, r.handle, broker2.Group(topic))
+	if err != nil {
+		return nil, err
+	}
+	r.topic, r.sub = topic, sub
+	return r, nil
+}
+
+// removeRequester 排空或者关闭broker时移除请求者，等待中的请求返回 ErrRequesterClosed
+// 接收回复的订阅由broker一起排空，之后的请求会重新订阅
+func removeRequester(b broker2.Broker) {
+	if v, ok := requesters.LoadAndDelete(b); ok {
+		close(v.(*requester).closed)
+	}
+}
+
+func (r *requester) handle(ctx context.Context, event broker2.Event) error {
+	id := event.Message().Header[HeaderCorrelationID]
+	ch, ok := r.pending.LoadAndDelete(id)
+	if !ok {
+		// 请求已经超时或者重复的回复
+		logger.Ctx(ctx).Warn("broker drop reply", zap.String("correlation_id", id))
+		return nil
+	}
+	ch.(chan *broker2.Message) <- event.Message()
+	return nil
+}
+
+// Request 使用默认的broker发送请求，并等待回复，超时由 ctx 控制
+func Request(ctx context.Context, topic string, msg *broker2.Message, opts ...broker2.PublishOption) (*broker2.Message, error) {
+	return RequestTo(ctx, Default(), topic, msg, opts...)
+}
+
+// RequestTo 使用指定的broker发送请求，并等待回复，超时由 ctx 控制，不会修改传入的消息
+// 第一次请求时会订阅当前实例接收回复的topic，请求方与回复方需要使用相同的topic前缀
+func RequestTo(ctx context.Context, b broker2.Broker, topic string, msg *broker2.Message,
+	opts ...broker2.PublishOption) (*broker2.Message, error) {
+	r, err := requesterOf(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	id := uuid.NewString()
+	ch := make(chan *broker2.Message, 1)
+	r.pending.Store(id, ch)
+	defer r.pending.Delete(id)
+	header := make(map[string]string, len(msg.Header)+2)
+	maps.Copy(header, msg.Header)
+	header[HeaderReplyTo] = r.topic
+	header[HeaderCorrelationID] = id
+	if err := b.Publish(ctx, topic, &broker2.Message{Header: header, Body: msg.Body}, opts...); err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-r.closed:
+		return nil, ErrRequesterClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Reply 使用默认的broker回复请求
+func Reply(ctx context.Context, event broker2.Event, msg *broker2.Message) error {
+	return ReplyTo(ctx, Default(), event, msg)
+}
+
+// ReplyTo 使用指定的broker回复请求，消息不是请求时返回 ErrNotRequest，不会修改传入的消息
+func ReplyTo(ctx context.Context, b broker2.Broker, event broker2.Event, msg *broker2.Message) error {
+	header := event.Message().Header
+	topic, id := header[HeaderReplyTo], header[HeaderCorrelationID]
+	if topic == "" || id == "" {
+		return ErrNotRequest
+	}
+	replyHeader := make(map[string]string, len(msg.Header)+1)
+	maps.Copy(replyHeader, msg.Header)
+	replyHeader[HeaderCorrelationID] = id
+	return b.Publish(ctx, topic, &broker2.Message{Header: replyHeader, Body: msg.Body})
+}
@@ -0,0 +1,52 @@
+package broker
+
+import (
+	"context"
+	"testing"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rpcBroker 发布时同步调用订阅者，订阅时返回可以排空的订阅者
+type rpcBroker struct {
+	*syncBroker
+	groups map[string]string
+}
+
+func (b *rpcBroker) Subscribe(ctx context.Context, topic string, h broker2.Handler,
+	opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	b.handlers[topic] = h
+	b.groups[topic] = broker2.NewSubscribeOptions(opts...).Group
+	return &drainSubscriber{topic: topic}, nil
+}
+
+func TestRequest(t *testing.T) {
+	ctx := context.Background()
+	raw := &rpcBroker{syncBroker: newSyncBroker(), groups: make(map[string]string)}
+	b, err := New(WithBroker(raw), WithTopicPrefix("app"), WithReplyTopic("reply.pod-1"))
+	require.NoError(t, err)
+	_, err = b.Subscribe(ctx, "echo", func(ctx context.Context, event broker2.Event) error {
+		return ReplyTo(ctx, b, event, &broker2.Message{Body: append([]byte("re: "), event.Message().Body...)})
+	})
+	require.NoError(t, err)
+
+	// 使用配置的topic与消费组接收回复，不修改传入的消息
+	msg := &broker2.Message{Header: map[string]string{"key": "value"}, Body: []byte("hello")}
+	reply, err := RequestTo(ctx, b, "echo", msg)
+	require.NoError(t, err)
+	assert.Equal(t, "re: hello", string(reply.Body))
+	assert.Equal(t, map[string]string{"key": "value"}, msg.Header)
+	assert.Equal(t, "reply.pod-1", raw.groups["app.reply.pod-1"])
+	request := raw.published["app.echo"][0]
+	assert.Equal(t, "reply.pod-1", request.Header[HeaderReplyTo])
+	assert.Equal(t, request.Header[HeaderCorrelationID], reply.Header[HeaderCorrelationID])
+
+	// 关闭后移除请求者
+	_, ok := requesters.Load(b)
+	assert.True(t, ok)
+	require.NoError(t, b.Close())
+	_, ok = requesters.Load(b)
+	assert.False(t, ok)
+}
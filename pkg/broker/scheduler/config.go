@@ -0,0 +1,30 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cago-frame/cago/database/redis"
+)
+
+// NewWithConfig 根据配置创建调度器，redis 使用 database/redis 的默认客户端，db 使用 db.Default()
+func NewWithConfig(cfg Config) (*Scheduler, error) {
+	var store Store
+	switch cfg.Store {
+	case "redis":
+		client := redis.Default()
+		if client == nil {
+			return nil, errors.New("scheduler: redis component is not started")
+		}
+		store = NewRedisStore(client, cfg.Key)
+	case "db":
+		s, err := NewDBStore()
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	default:
+		return nil, fmt.Errorf("scheduler: unknown store %q", cfg.Store)
+	}
+	return New(store, cfg.options()...), nil
+}
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/cago-frame/cago/database/db"
+	"github.com/cago-frame/cago/pkg/broker/broker"
+)
+
+// BrokerScheduledMessage 等待投递的消息表
+type BrokerScheduledMessage struct {
+	ID    int64  `gorm:"primaryKey"`
+	Topic string `gorm:"column:topic;type:varchar(255);not null"`
+	// Header 消息头，json格式
+	Header string `gorm:"column:header;type:text"`
+	Body   []byte `gorm:"column:body"`
+	// DeliverAt 投递时间(毫秒)，取出后会延后到租约到期的时间
+	DeliverAt  int64 `gorm:"column:deliver_at;not null;index"`
+	Createtime int64 `gorm:"column:createtime"`
+}
+
+// DBStore 使用 db.Default() 中的数据表保存消息，会自动创建表结构
+// 保存时使用 db.Ctx(ctx)，在事务中发布时消息随事务一起提交
+type DBStore struct {
+}
+
+func NewDBStore() (*DBStore, error) {
+	orm := db.Default()
+	if orm == nil {
+		return nil, errors.New("scheduler: db component is not started")
+	}
+	if err := orm.Migrator().AutoMigrate(&BrokerScheduledMessage{}); err != nil {
+		return nil, err
+	}
+	return &DBStore{}, nil
+}
+
+func (s *DBStore) Add(ctx context.Context, entry *Entry) error {
+	header, err := json.Marshal(entry.Message.Header)
+	if err != nil {
+		return err
+	}
+	msg := &BrokerScheduledMessage{
+		Topic:      entry.Topic,
+		Header:     string(header),
+		Body:       entry.Message.Body,
+		DeliverAt:  entry.DeliverAt.UnixMilli(),
+		Createtime: time.Now().Unix(),
+	}
+	if err := db.Ctx(ctx).Create(msg).Error; err != nil {
+		return err
+	}
+	entry.ID = strconv.FormatInt(msg.ID, 10)
+	return nil
+}
+
+// Claim 使用投递时间作为乐观锁，同一条消息只会被一个调度器取出，无法解析的消息会被记录日志并删除
+func (s *DBStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Entry, error) {
+	orm := db.Default().WithContext(ctx)
+	messages := make([]*BrokerScheduledMessage, 0)
+	if err := orm.Where("deliver_at <= ?", now.UnixMilli()).
+		Order("deliver_at").Limit(limit).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	ret := make([]*Entry, 0, len(messages))
+	for _, msg := range messages {
+		result := orm.Model(&BrokerScheduledMessage{}).
+			Where("id = ? AND deliver_at = ?", msg.ID, msg.DeliverAt).
+			Update("deliver_at", now.Add(lease).UnixMilli())
+		if result.Error != nil {
+			return ret, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		data := &broker.Message{Body: msg.Body}
+		if msg.Header != "" {
+			if err := json.Unmarshal([]byte(msg.Header), &data.Header); err != nil {
+				dropEntry(ctx, s, strconv.FormatInt(msg.ID, 10), err)
+				continue
+			}
+		}
+		ret = append(ret, &Entry{
+			ID:        strconv.FormatInt(msg.ID, 10),
+			Topic:     msg.Topic,
+			Message:   data,
+			DeliverAt: time.UnixMilli(msg.DeliverAt),
+		})
+	}
+	return ret, nil
+}
+
+func (s *DBStore) Remove(ctx context.Context, entry *Entry) error {
+	id, err := strconv.ParseInt(entry.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+	return db.Default().WithContext(ctx).Delete(&BrokerScheduledMessage{}, id).Error
+}
@@ -0,0 +1,72 @@
+package scheduler
+
+import "time"
+
+type Option func(*Options)
+
+type Options struct {
+	pollInterval time.Duration
+	batch        int
+	lease        time.Duration
+}
+
+func newOptions(opts ...Option) *Options {
+	options := &Options{
+		pollInterval: time.Second,
+		batch:        100,
+		lease:        30 * time.Second,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return options
+}
+
+// WithPollInterval 轮询到期消息的间隔，默认为1s
+func WithPollInterval(d time.Duration) Option {
+	return func(options *Options) {
+		options.pollInterval = d
+	}
+}
+
+// WithBatch 每次取出的消息数量，默认为100
+func WithBatch(n int) Option {
+	return func(options *Options) {
+		options.batch = n
+	}
+}
+
+// WithLease 取出的消息在该时间内没有投递成功会被重新取出，默认为30s
+func WithLease(d time.Duration) Option {
+	return func(options *Options) {
+		options.lease = d
+	}
+}
+
+// Config 调度器配置
+type Config struct {
+	// Store 存储类型，可选 redis、db，为空时不使用调度器
+	Store string `yaml:"store"`
+	// Key 使用redis存储时的key，默认为 broker:scheduled
+	Key string `yaml:"key"`
+	// PollInterval 轮询到期消息的间隔，默认为1s
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// Batch 每次取出的消息数量，默认为100
+	Batch int `yaml:"batch"`
+	// Lease 取出的消息在该时间内没有投递成功会被重新取出，默认为30s
+	Lease time.Duration `yaml:"lease"`
+}
+
+func (c Config) options() []Option {
+	opts := make([]Option, 0)
+	if c.PollInterval > 0 {
+		opts = append(opts, WithPollInterval(c.PollInterval))
+	}
+	if c.Batch > 0 {
+		opts = append(opts, WithBatch(c.Batch))
+	}
+	if c.Lease > 0 {
+		opts = append(opts, WithLease(c.Lease))
+	}
+	return opts
+}
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore 使用redis有序集合保存消息，score为投递时间(毫秒)，消息内容保存在 <key>:data 中
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisStore key 为空时使用 broker:scheduled
+func NewRedisStore(client *redis.Client, key string) *RedisStore {
+	if key == "" {
+		key = "broker:scheduled"
+	}
+	return &RedisStore{client: client, key: key}
+}
+
+func (s *RedisStore) dataKey() string {
+	return s.key + ":data"
+}
+
+func (s *RedisStore) Add(ctx context.Context, entry *Entry) error {
+	bt, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.dataKey(), entry.ID, bt)
+		pipe.ZAdd(ctx, s.key, redis.Z{Score: float64(entry.DeliverAt.UnixMilli()), Member: entry.ID})
+		return nil
+	})
+	return err
+}
+
+// claimScript 取出到期的消息，并将score延后到租约到期的时间，返回 id、消息内容 交替排列的列表
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+local ret = {}
+for _, id in ipairs(ids) do
+	local v = redis.call('HGET', KEYS[2], id)
+	if v then
+		redis.call('ZADD', KEYS[1], ARGV[3], id)
+		table.insert(ret, id)
+		table.insert(ret, v)
+	else
+		redis.call('ZREM', KEYS[1], id)
+	end
+end
+return ret
+`)
+
+// Claim 无法解析的消息会被记录日志并删除，不影响同一批的其它消息
+func (s *RedisStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Entry, error) {
+	values, err := claimScript.Run(ctx, s.client, []string{s.key, s.dataKey()},
+		now.UnixMilli(), limit, now.Add(lease).UnixMilli()).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Entry, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		entry := &Entry{}
+		if err := json.Unmarshal([]byte(values[i+1]), entry); err != nil {
+			dropEntry(ctx, s, values[i], err)
+			continue
+		}
+		ret = append(ret, entry)
+	}
+	return ret, nil
+}
+
+func (s *RedisStore) Remove(ctx context.Context, entry *Entry) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, s.key, entry.ID)
+		pipe.HDel(ctx, s.dataKey(), entry.ID)
+		return nil
+	})
+	return err
+}
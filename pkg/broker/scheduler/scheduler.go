@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/gogo"
+	"github.com/cago-frame/cago/pkg/logger"
+	"github.com/cago-frame/cago/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// Entry 等待投递的消息
+type Entry struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	Message   *broker.Message `json:"message"`
+	DeliverAt time.Time       `json:"deliver_at"`
+}
+
+// Store 保存等待投递的消息
+type Store interface {
+	// Add 保存消息
+	Add(ctx context.Context, entry *Entry) error
+	// Claim 取出到期的消息，取出的消息在 lease 时间内不会被再次取出
+	// 投递失败或者进程退出时，消息会在 lease 后被重新取出
+	Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Entry, error)
+	// Remove 投递成功后删除消息
+	Remove(ctx context.Context, entry *Entry) error
+}
+
+// Scheduler 存储转发的延迟消息调度器，用于不支持原生延迟发布的broker
+// 消息先保存在 Store 中，到期后再发布到broker，投递语义为至少一次
+type Scheduler struct {
+	store   Store
+	options *Options
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+}
+
+func New(store Store, opts ...Option) *Scheduler {
+	return &Scheduler{
+		store:   store,
+		options: newOptions(opts...),
+	}
+}
+
+// Schedule 保存消息，在 at 时发布到topic
+func (s *Scheduler) Schedule(ctx context.Context, topic string, data *broker.Message, at time.Time) error {
+	return s.store.Add(ctx, &Entry{
+		ID:        utils.RandString(16, utils.Mix),
+		Topic:     topic,
+		Message:   data,
+		DeliverAt: at,
+	})
+}
+
+// Start 开始轮询到期的消息并发布到b，重复调用会返回错误
+// 消息原样发布到b，b一般是没有包装的原始broker，保存时需要已经处理好topic前缀与消息头
+func (s *Scheduler) Start(b broker.Broker) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return errors.New("scheduler: already started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done.Add(1)
+	gogo.Go(func() error {
+		defer s.done.Done()
+		ticker := time.NewTicker(s.options.pollInterval)
+		defer ticker.Stop()
+		for {
+			for {
+				n, err := s.Deliver(ctx, b)
+				if err != nil {
+					logger.Default().Error("scheduler deliver error", zap.Error(err))
+				}
+				// 取满一批时继续取，否则等待下一次轮询
+				if err != nil || n < s.options.batch {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+	return nil
+}
+
+// Deliver 取出一批到期的消息并发布到b，返回取出的消息数量
+func (s *Scheduler) Deliver(ctx context.Context, b broker.Broker) (int, error) {
+	entries, err := s.store.Claim(ctx, time.Now(), s.options.batch, s.options.lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err := b.Publish(ctx, entry.Topic, entry.Message); err != nil {
+			// 等待租约过期后重新投递
+			logger.Default().Error("scheduler publish error",
+				zap.String("topic", entry.Topic), zap.String("id", entry.ID), zap.Error(err))
+			continue
+		}
+		if err := s.store.Remove(ctx, entry); err != nil {
+			logger.Default().Error("scheduler remove entry error",
+				zap.String("topic", entry.Topic), zap.String("id", entry.ID), zap.Error(err))
+		}
+	}
+	return len(entries), nil
+}
+
+// dropEntry 删除无法解析的消息，避免每次租约到期后都被重新取出
+func dropEntry(ctx context.Context, store Store, id string, err error) {
+	logger.Default().Error("scheduler drop undecodable entry", zap.String("id", id), zap.Error(err))
+	if err := store.Remove(ctx, &Entry{ID: id}); err != nil {
+		logger.Default().Error("scheduler remove entry error", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// Close 停止轮询，未到期的消息保留在 Store 中
+func (s *Scheduler) Close() error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		s.done.Wait()
+	}
+	return nil
+}
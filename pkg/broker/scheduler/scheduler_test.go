@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cago-frame/cago/database/db"
+	_ "github.com/cago-frame/cago/database/db/sqlite"
+	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordBroker 记录发布的消息
+type recordBroker struct {
+	broker.Broker
+	mu        sync.Mutex
+	err       error
+	published []*Entry
+}
+
+func (b *recordBroker) Publish(ctx context.Context, topic string, data *broker.Message, opts ...broker.PublishOption) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.published = append(b.published, &Entry{Topic: topic, Message: data})
+	return nil
+}
+
+func (b *recordBroker) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.published)
+}
+
+func newRedisStore(t *testing.T) Store {
+	m := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return NewRedisStore(client, "")
+}
+
+func newDBStore(t *testing.T) Store {
+	orm, err := db.Open(&db.Config{
+		Driver: db.SQLite,
+		Dsn:    fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()),
+	})
+	require.NoError(t, err)
+	sqlDB, err := orm.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	db.SetDefault(orm)
+	store, err := NewDBStore()
+	require.NoError(t, err)
+	return store
+}
+
+func TestStore(t *testing.T) {
+	for name, newStore := range map[string]func(t *testing.T) Store{
+		"redis": newRedisStore,
+		"db":    newDBStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			now := time.Now()
+			require.NoError(t, store.Add(ctx, &Entry{
+				ID: "1", Topic: "topic", DeliverAt: now.Add(-time.Second),
+				Message: &broker.Message{Header: map[string]string{"k": "v"}, Body: []byte("1")},
+			}))
+			require.NoError(t, store.Add(ctx, &Entry{
+				ID: "2", Topic: "topic", DeliverAt: now.Add(time.Minute),
+				Message: &broker.Message{Body: []byte("2")},
+			}))
+
+			entries, err := store.Claim(ctx, now, 10, time.Second)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, "topic", entries[0].Topic)
+			assert.Equal(t, []byte("1"), entries[0].Message.Body)
+			assert.Equal(t, "v", entries[0].Message.Header["k"])
+			// 租约期间不会再次取出
+			entries, err = store.Claim(ctx, now, 10, time.Second)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+			// 租约到期后重新取出
+			entries, err = store.Claim(ctx, now.Add(2*time.Second), 10, time.Second)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			require.NoError(t, store.Remove(ctx, entries[0]))
+			entries, err = store.Claim(ctx, now.Add(4*time.Second), 10, time.Second)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			entries, err = store.Claim(ctx, now.Add(2*time.Minute), 10, time.Second)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, []byte("2"), entries[0].Message.Body)
+		})
+	}
+}
+
+func TestStore_Corrupt(t *testing.T) {
+	tests := []struct {
+		name     string
+		newStore func(t *testing.T) Store
+		// corrupt 直接在存储中写入一条已经到期且无法解析的消息
+		corrupt func(t *testing.T, store Store)
+	}{
+		{"redis", newRedisStore, func(t *testing.T, store Store) {
+			s := store.(*RedisStore)
+			ctx := context.Background()
+			require.NoError(t, s.client.HSet(ctx, s.dataKey(), "bad", "{").Err())
+			require.NoError(t, s.client.ZAdd(ctx, s.key, redis.Z{Member: "bad"}).Err())
+		}},
+		{"db", newDBStore, func(t *testing.T, store Store) {
+			require.NoError(t, db.Default().Create(&BrokerScheduledMessage{
+				Topic: "topic", Header: "{", Body: []byte("bad"),
+			}).Error)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := tt.newStore(t)
+			now := time.Now()
+			tt.corrupt(t, store)
+			require.NoError(t, store.Add(ctx, &Entry{
+				ID: "1", Topic: "topic", DeliverAt: now.Add(-time.Second),
+				Message: &broker.Message{Body: []byte("1")},
+			}))
+
+			// 损坏的消息不影响同一批的其它消息
+			entries, err := store.Claim(ctx, now, 10, time.Second)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, []byte("1"), entries[0].Message.Body)
+			require.NoError(t, store.Remove(ctx, entries[0]))
+			// 损坏的消息已经被删除，租约到期后也不会再取出
+			entries, err = store.Claim(ctx, now.Add(time.Minute), 10, time.Second)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	store := newRedisStore(t)
+	s := New(store, WithPollInterval(10*time.Millisecond), WithLease(50*time.Millisecond))
+	b := &recordBroker{err: errors.New("unavailable")}
+	require.NoError(t, s.Start(b))
+	assert.Error(t, s.Start(b))
+	defer func() {
+		_ = s.Close()
+	}()
+
+	start := time.Now()
+	require.NoError(t, s.Schedule(ctx, "topic", &broker.Message{Body: []byte("1")}, start.Add(50*time.Millisecond)))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, b.len())
+
+	// 发布失败的消息在租约到期后重新投递
+	b.mu.Lock()
+	b.err = nil
+	b.mu.Unlock()
+	assert.Eventually(t, func() bool {
+		return b.len() == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "topic", b.published[0].Topic)
+	assert.Equal(t, []byte("1"), b.published[0].Message.Body)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, b.len())
+}
@@ -0,0 +1,233 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cago-frame/cago/database/db"
+	"github.com/cago-frame/cago/pkg/broker/broker"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BrokerMessage 消息表，发布时每个订阅了topic的消费组各有一条记录，确认后删除
+type BrokerMessage struct {
+	ID    int64  `gorm:"primaryKey"`
+	Topic string `gorm:"column:topic;type:varchar(255);not null;index:idx_topic_group_visible,priority:1"`
+	Group string `gorm:"column:consumer_group;type:varchar(255);not null;index:idx_topic_group_visible,priority:2"`
+	// Header 消息头，json格式
+	Header string `gorm:"column:header;type:text"`
+	Body   []byte `gorm:"column:body"`
+	// Attempted 已经投递的次数，同时作为消费者持有消息的凭证
+	Attempted int `gorm:"column:attempted;not null;default:0"`
+	// VisibleAt 消息可以被取出的时间(毫秒)
+	VisibleAt  int64 `gorm:"column:visible_at;not null;index:idx_topic_group_visible,priority:3"`
+	Createtime int64 `gorm:"column:createtime"`
+}
+
+// BrokerSubscription 订阅了topic的消费组，发布消息时会为每个消费组写入一条消息
+type BrokerSubscription struct {
+	Topic      string `gorm:"column:topic;type:varchar(255);primaryKey"`
+	Group      string `gorm:"column:consumer_group;type:varchar(255);primaryKey"`
+	Createtime int64  `gorm:"column:createtime"`
+}
+
+// ErrLeaseExpired 消息的可见性超时已过并被其它消费者取出，无法再确认或重新入队
+var ErrLeaseExpired = errors.New("sql broker: message lease expired")
+
+type sqlBroker struct {
+	config Config
+}
+
+// NewBroker 使用 db.Default() 中的数据表实现的 broker，会自动创建表结构
+// 发布时使用 db.Ctx(ctx)，在事务中发布时消息会在事务提交后才能被消费
+// 消费组需要订阅过topic后才能收到之后发布的消息
+func NewBroker(cfg Config) (broker.Broker, error) {
+	orm := db.Default()
+	if orm == nil {
+		return nil, errors.New("sql broker: db component is not started")
+	}
+	if err := orm.Migrator().AutoMigrate(&BrokerMessage{}, &BrokerSubscription{}); err != nil {
+		return nil, err
+	}
+	return &sqlBroker{config: cfg.withDefaults()}, nil
+}
+
+func (b *sqlBroker) Publish(ctx context.Context, topic string, data *broker.Message, opts ...broker.PublishOption) error {
+	return b.PublishBatch(ctx, topic, []*broker.Message{data}, opts...)
+}
+
+// PublishBatch 一次写入整批消息，每个消费组各有一条记录
+func (b *sqlBroker) PublishBatch(ctx context.Context, topic string, data []*broker.Message, opts ...broker.PublishOption) error {
+	if len(data) == 0 {
+		return nil
+	}
+	orm := db.Ctx(ctx)
+	groups := make([]string, 0)
+	if err := orm.Model(&BrokerSubscription{}).Where("topic = ?", topic).
+		Pluck("consumer_group", &groups).Error; err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	visibleAt := now
+	if options := broker.NewPublishOptions(opts...); !options.DeliverAt.IsZero() {
+		visibleAt = max(options.DeliverAt.UnixMilli(), now)
+	}
+	messages := make([]*BrokerMessage, 0, len(groups)*len(data))
+	for _, v := range data {
+		header, err := json.Marshal(v.Header)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			messages = append(messages, &BrokerMessage{
+				Topic:      topic,
+				Group:      group,
+				Header:     string(header),
+				Body:       v.Body,
+				VisibleAt:  visibleAt,
+				Createtime: now,
+			})
+		}
+	}
+	return orm.Create(&messages).Error
+}
+
+func (b *sqlBroker) Subscribe(ctx context.Context, topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	options := broker.NewSubscribeOptions(opts...)
+	if options.Group == "" {
+		return nil, errors.New("sql broker: Subscribe requires a non-empty Group")
+	}
+	if err := db.Default().WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&BrokerSubscription{
+			Topic:      topic,
+			Group:      options.Group,
+			Createtime: time.Now().Unix(),
+		}).Error; err != nil {
+		return nil, err
+	}
+	return newSubscriber(b, topic, h, options), nil
+}
+
+// SupportDelay 通过消息的可见时间实现延迟发布
+func (b *sqlBroker) SupportDelay(d time.Duration) bool {
+	return true
+}
+
+func (b *sqlBroker) Close() error {
+	return nil
+}
+
+func (b *sqlBroker) String() string {
+	return "sql"
+}
+
+// claim 取出可见的消息，并设置可见性超时
+// 在事务中使用 SELECT ... FOR UPDATE SKIP LOCKED 锁定取出的消息，多个消费者同时取出时跳过其它消费者锁定的行，
+// 需要数据库支持 SKIP LOCKED(MySQL 8.0+、PostgreSQL 9.5+)；SQLite 不支持行锁，使用投递次数作为乐观锁
+func (b *sqlBroker) claim(ctx context.Context, topic, group string) ([]*BrokerMessage, error) {
+	orm := db.Default().WithContext(ctx)
+	if orm.Dialector.Name() == "sqlite" {
+		return b.claimOptimistic(orm, topic, group)
+	}
+	now := time.Now().UnixMilli()
+	messages := make([]*BrokerMessage, 0)
+	err := orm.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("topic = ? AND consumer_group = ? AND visible_at <= ?", topic, group, now).
+			Order("id").Limit(b.config.Batch).Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		ids := make([]int64, 0, len(messages))
+		for _, msg := range messages {
+			ids = append(ids, msg.ID)
+		}
+		return tx.Model(&BrokerMessage{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"attempted":  gorm.Expr("attempted + 1"),
+				"visible_at": now + b.config.VisibilityTimeout.Milliseconds(),
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		msg.Attempted++
+	}
+	return messages, nil
+}
+
+// claimOptimistic 使用投递次数作为乐观锁取出消息，同一条消息只会被一个消费者取出
+func (b *sqlBroker) claimOptimistic(orm *gorm.DB, topic, group string) ([]*BrokerMessage, error) {
+	now := time.Now().UnixMilli()
+	messages := make([]*BrokerMessage, 0)
+	if err := orm.Where("topic = ? AND consumer_group = ? AND visible_at <= ?", topic, group, now).
+		Order("id").Limit(b.config.Batch).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	ret := make([]*BrokerMessage, 0, len(messages))
+	for _, msg := range messages {
+		result := orm.Model(&BrokerMessage{}).
+			Where("id = ? AND attempted = ?", msg.ID, msg.Attempted).
+			Updates(map[string]interface{}{
+				"attempted":  gorm.Expr("attempted + 1"),
+				"visible_at": now + b.config.VisibilityTimeout.Milliseconds(),
+			})
+		if result.Error != nil {
+			return ret, result.Error
+		}
+		if result.RowsAffected == 1 {
+			msg.Attempted++
+			ret = append(ret, msg)
+		}
+	}
+	return ret, nil
+}
+
+// extend 处理之前延长消息的可见性超时，同一批取出的消息依次处理，后面的消息不会在处理时超时
+// 消息已经被其它消费者取出时返回 ErrLeaseExpired
+func (b *sqlBroker) extend(ctx context.Context, msg *BrokerMessage) error {
+	result := db.Default().WithContext(ctx).Model(&BrokerMessage{}).
+		Where("id = ? AND attempted = ?", msg.ID, msg.Attempted).
+		Update("visible_at", time.Now().Add(b.config.VisibilityTimeout).UnixMilli())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+func (b *sqlBroker) ack(ctx context.Context, msg *BrokerMessage) error {
+	result := db.Default().WithContext(ctx).
+		Where("id = ? AND attempted = ?", msg.ID, msg.Attempted).Delete(&BrokerMessage{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+func (b *sqlBroker) requeue(ctx context.Context, msg *BrokerMessage, delay time.Duration) error {
+	result := db.Default().WithContext(ctx).Model(&BrokerMessage{}).
+		Where("id = ? AND attempted = ?", msg.ID, msg.Attempted).
+		Update("visible_at", time.Now().Add(delay).UnixMilli())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cago-frame/cago/database/db"
+	_ "github.com/cago-frame/cago/database/db/sqlite"
+	"github.com/cago-frame/cago/pkg/broker"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestBroker(t *testing.T, cfg Config) broker2.Broker {
+	orm, err := db.Open(&db.Config{
+		Driver: db.SQLite,
+		Dsn:    fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()),
+	})
+	require.NoError(t, err)
+	sqlDB, err := orm.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	db.SetDefault(orm)
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 10 * time.Millisecond
+	}
+	b, err := NewBroker(cfg)
+	require.NoError(t, err)
+	return b
+}
+
+type received struct {
+	sync.Mutex
+	events []broker2.Event
+}
+
+func (r *received) add(e broker2.Event) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *received) len() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.events)
+}
+
+func TestSQLFactoryRegistered(t *testing.T) {
+	assert.NotNil(t, broker.GetFactory("sql"))
+}
+
+func TestBroker_Group(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, Config{})
+	_, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		return nil
+	})
+	assert.Error(t, err)
+
+	g1, g2 := &received{}, &received{}
+	sub1, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		g1.add(event)
+		return nil
+	}, broker2.Group("g1"), broker2.WithConcurrent(2))
+	require.NoError(t, err)
+	defer sub1.Unsubscribe() //nolint:errcheck
+	sub2, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		g2.add(event)
+		return nil
+	}, broker2.Group("g2"))
+	require.NoError(t, err)
+	defer sub2.Unsubscribe() //nolint:errcheck
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{
+			Header: map[string]string{"k": "v"},
+			Body:   []byte("hello"),
+		}))
+	}
+	assert.Eventually(t, func() bool {
+		return g1.len() == 3 && g2.len() == 3
+	}, 3*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 3, g1.len())
+	e := g1.events[0]
+	assert.Equal(t, "v", e.Message().Header["k"])
+	assert.Equal(t, []byte("hello"), e.Message().Body)
+	assert.Equal(t, 1, e.Attempted())
+	// 确认后删除
+	var count int64
+	require.NoError(t, db.Default().Model(&BrokerMessage{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestBroker_Transaction(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, Config{})
+	r := &received{}
+	sub, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		r.add(event)
+		return nil
+	}, broker2.Group("g1"))
+	require.NoError(t, err)
+	defer sub.Unsubscribe() //nolint:errcheck
+
+	errRollback := errors.New("rollback")
+	err = db.Default().Transaction(func(tx *gorm.DB) error {
+		if err := b.Publish(db.WithContextDB(ctx, tx), "topic", &broker2.Message{Body: []byte("1")}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+	require.NoError(t, db.Default().Transaction(func(tx *gorm.DB) error {
+		return b.Publish(db.WithContextDB(ctx, tx), "topic", &broker2.Message{Body: []byte("2")})
+	}))
+	assert.Eventually(t, func() bool {
+		return r.len() == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, r.len())
+	assert.Equal(t, []byte("2"), r.events[0].Message().Body)
+}
+
+func TestBroker_Requeue(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, Config{VisibilityTimeout: 100 * time.Millisecond})
+	attempts := make(chan int, 10)
+	sub, err := b.Subscribe(ctx, "requeue", func(ctx context.Context, event broker2.Event) error {
+		attempts <- event.Attempted()
+		if event.Attempted() == 1 {
+			return event.Requeue(50 * time.Millisecond)
+		}
+		return nil
+	}, broker2.Group("g1"))
+	require.NoError(t, err)
+	defer sub.Unsubscribe() //nolint:errcheck
+
+	// 不确认的消息在可见性超时后重新投递
+	var first broker2.Event
+	timeout := make(chan broker2.Event, 10)
+	sub2, err := b.Subscribe(ctx, "timeout", func(ctx context.Context, event broker2.Event) error {
+		timeout <- event
+		return nil
+	}, broker2.Group("g1"), broker2.NotAutoAck())
+	require.NoError(t, err)
+	defer sub2.Unsubscribe() //nolint:errcheck
+
+	require.NoError(t, b.Publish(ctx, "requeue", &broker2.Message{Body: []byte("1")}))
+	require.NoError(t, b.Publish(ctx, "timeout", &broker2.Message{Body: []byte("2")}))
+	for i := 1; i <= 2; i++ {
+		select {
+		case n := <-attempts:
+			assert.Equal(t, i, n)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	for i := 1; i <= 2; i++ {
+		select {
+		case e := <-timeout:
+			assert.Equal(t, i, e.Attempted())
+			if first == nil {
+				first = e
+			} else {
+				// 超时后之前的消费者无法再确认
+				assert.ErrorIs(t, first.Ack(), ErrLeaseExpired)
+				assert.NoError(t, e.Ack())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestBroker_Delay(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, Config{})
+	received := make(chan time.Time, 1)
+	sub, err := b.Subscribe(ctx, "delay", func(ctx context.Context, event broker2.Event) error {
+		received <- time.Now()
+		return nil
+	}, broker2.Group("g1"))
+	require.NoError(t, err)
+	defer sub.Unsubscribe() //nolint:errcheck
+
+	start := time.Now()
+	require.NoError(t, b.Publish(ctx, "delay", &broker2.Message{Body: []byte("1")},
+		broker2.WithDelay(100*time.Millisecond)))
+	select {
+	case at := <-received:
+		assert.GreaterOrEqual(t, at.Sub(start), 100*time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestBroker_Batch(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, Config{})
+	r := &received{}
+	batches := make(chan int, 10)
+	sub, err := broker2.SubscribeBatch(ctx, b, "topic", func(ctx context.Context, events []broker2.Event) error {
+		for _, event := range events {
+			r.add(event)
+		}
+		batches <- len(events)
+		return nil
+	}, broker2.Group("g1"), broker2.WithBatch(4, 50*time.Millisecond))
+	require.NoError(t, err)
+	defer sub.Unsubscribe() //nolint:errcheck
+
+	msgs := make([]*broker2.Message, 0, 6)
+	for i := 0; i < 6; i++ {
+		msgs = append(msgs, &broker2.Message{Body: []byte(fmt.Sprintf("%d", i))})
+	}
+	require.NoError(t, broker2.PublishBatch(ctx, b, "topic", msgs))
+	assert.Eventually(t, func() bool {
+		return r.len() == 6
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 4, <-batches)
+	assert.Equal(t, 2, <-batches)
+	// 整批处理完成后确认
+	assert.Eventually(t, func() bool {
+		var count int64
+		require.NoError(t, db.Default().Model(&BrokerMessage{}).Count(&count).Error)
+		return count == 0
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestBroker_Drain(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, Config{})
+	started := make(chan struct{}, 3)
+	block := make(chan struct{})
+	sub, err := b.Subscribe(ctx, "topic", func(ctx context.Context, event broker2.Event) error {
+		started <- struct{}{}
+		<-block
+		return nil
+	}, broker2.Group("g1"))
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Publish(ctx, "topic", &broker2.Message{Body: []byte("1")}))
+	}
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Drain(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(block)
+	require.NoError(t, <-done)
+	// 正在处理的消息确认后删除，取出但是没有处理的消息立即可见
+	messages := make([]*BrokerMessage, 0)
+	require.NoError(t, db.Default().Find(&messages).Error)
+	require.Len(t, messages, 2)
+	for _, msg := range messages {
+		assert.LessOrEqual(t, msg.VisibleAt, time.Now().UnixMilli())
+	}
+}
+
+func TestBroker_Lease(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBroker(t, Config{VisibilityTimeout: 300 * time.Millisecond})
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	acks := make(chan error, 10)
+	sub, err := b.Subscribe(ctx, "lease", func(ctx context.Context, event broker2.Event) error {
+		mu.Lock()
+		handled[string(event.Message().Body)]++
+		mu.Unlock()
+		// 两条消息依次处理的总时间超过可见性超时
+		time.Sleep(200 * time.Millisecond)
+		acks <- event.Ack()
+		return nil
+	}, broker2.Group("g1"), broker2.NotAutoAck(), broker2.WithConcurrent(2))
+	require.NoError(t, err)
+	defer sub.Unsubscribe() //nolint:errcheck
+	// 一次写入两条消息，一个消费者会同时取出
+	require.NoError(t, broker2.PublishBatch(ctx, b, "lease", []*broker2.Message{
+		{Body: []byte("1")}, {Body: []byte("2")},
+	}))
+
+	for range 2 {
+		select {
+		case err := <-acks:
+			assert.NoError(t, err)
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	time.Sleep(400 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	// 后面的消息处理前延长了可见性超时，不会被其它消费者重复投递
+	assert.Equal(t, map[string]int{"1": 1, "2": 1}, handled)
+}
@@ -0,0 +1,52 @@
+package sql
+
+import (
+	"context"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker/broker"
+)
+
+type event struct {
+	ctx   context.Context
+	b     *sqlBroker
+	topic string
+	msg   *BrokerMessage
+	data  *broker.Message
+	// isAct 是否已经执行过Ack或者Requeue
+	isAct bool
+}
+
+func (e *event) Topic() string {
+	return e.topic
+}
+
+func (e *event) Message() *broker.Message {
+	return e.data
+}
+
+// Ack 删除消息
+func (e *event) Ack() error {
+	if err := e.b.ack(e.ctx, e.msg); err != nil {
+		return err
+	}
+	e.isAct = true
+	return nil
+}
+
+func (e *event) Error() error {
+	return nil
+}
+
+// Requeue 在 delay 后重新投递
+func (e *event) Requeue(delay time.Duration) error {
+	if err := e.b.requeue(e.ctx, e.msg, delay); err != nil {
+		return err
+	}
+	e.isAct = true
+	return nil
+}
+
+func (e *event) Attempted() int {
+	return e.msg.Attempted
+}
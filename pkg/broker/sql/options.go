@@ -0,0 +1,27 @@
+package sql
+
+import "time"
+
+// Config 数据库 broker 配置
+type Config struct {
+	// VisibilityTimeout 消息被取出后在该时间内对其它消费者不可见，超时未确认会被重新投递，默认为1分钟
+	// 同一批取出的消息在各自处理之前会重新计算超时时间
+	VisibilityTimeout time.Duration `yaml:"visibilityTimeout"`
+	// PollInterval 没有消息时的轮询间隔，默认为1s
+	PollInterval time.Duration `yaml:"pollInterval"`
+	// Batch 每次取出的消息数量，默认为10
+	Batch int `yaml:"batch"`
+}
+
+func (c Config) withDefaults() Config {
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = time.Minute
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.Batch <= 0 {
+		c.Batch = 10
+	}
+	return c
+}
@@ -0,0 +1,19 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/cago-frame/cago/configs"
+	"github.com/cago-frame/cago/pkg/broker"
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+)
+
+func init() {
+	broker.RegisterBroker("sql", func(ctx context.Context, cfg *configs.Config) (broker2.Broker, error) {
+		c := &Config{}
+		if err := cfg.Scan(ctx, "broker.sql", c); err != nil {
+			return nil, err
+		}
+		return NewBroker(*c)
+	})
+}
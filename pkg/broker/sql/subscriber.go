@@ -0,0 +1,146 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/gogo"
+	"github.com/cago-frame/cago/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type subscriber struct {
+	b       *sqlBroker
+	topic   string
+	handler broker.Handler
+	options broker.SubscribeOptions
+	logger  *zap.Logger
+	cancel  context.CancelFunc
+	done    sync.WaitGroup
+}
+
+func newSubscriber(b *sqlBroker, topic string, handler broker.Handler, options broker.SubscribeOptions) broker.Subscriber {
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscriber{
+		b:       b,
+		topic:   topic,
+		handler: handler,
+		options: options,
+		logger: logger.Default().With(
+			zap.String("topic", topic), zap.String("group", options.Group),
+		),
+		cancel: cancel,
+	}
+	for range max(options.Concurrent, 1) {
+		sub.done.Add(1)
+		gogo.Go(func() error {
+			defer sub.done.Done()
+			sub.poll(ctx)
+			return nil
+		})
+	}
+	return sub
+}
+
+// poll 轮询消息，直到 ctx 被取消
+func (s *subscriber) poll(ctx context.Context) {
+	for ctx.Err() == nil {
+		messages, err := s.b.claim(ctx, s.topic, s.options.Group)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("sql broker claim message error", zap.Error(err))
+		}
+		for i, msg := range messages {
+			if ctx.Err() != nil {
+				// 停止后立即释放没有处理的消息，不必等待可见性超时
+				s.release(messages[i:])
+				return
+			}
+			// 第一条消息刚刚取出，之后的消息在处理前延长可见性超时
+			if i > 0 {
+				if err := s.b.extend(ctx, msg); err != nil {
+					// 已经超时并被其它消费者取出，由其它消费者处理
+					s.logger.Warn("sql broker extend lease error", zap.Int64("id", msg.ID), zap.Error(err))
+					continue
+				}
+			}
+			s.handle(msg)
+		}
+		if len(messages) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.b.config.PollInterval):
+		}
+	}
+}
+
+func (s *subscriber) handle(msg *BrokerMessage) {
+	ctx := s.options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ev := &event{
+		ctx:   ctx,
+		b:     s.b,
+		topic: s.topic,
+		msg:   msg,
+		data:  &broker.Message{Body: msg.Body},
+	}
+	if msg.Header != "" {
+		if err := json.Unmarshal([]byte(msg.Header), &ev.data.Header); err != nil {
+			s.logger.Error("sql broker unmarshal header error", zap.Int64("id", msg.ID), zap.Error(err))
+		}
+	}
+	err := s.handler(ctx, ev)
+	if err != nil {
+		if !ev.isAct {
+			if s.options.Retry {
+				err = errors.Join(err, ev.Requeue(retryDelay(ev.Attempted())))
+				s.logger.Error("sql broker subscriber handle error", zap.Bool("retry", true), zap.Error(err))
+				return
+			} else if s.options.AutoAck {
+				err = errors.Join(err, ev.Ack())
+			}
+		}
+		s.logger.Error("sql broker subscriber handle error", zap.Error(err))
+	} else if s.options.AutoAck && !ev.isAct {
+		if err := ev.Ack(); err != nil {
+			s.logger.Error("sql broker ack error", zap.Error(err))
+		}
+	}
+}
+
+// release 让取出但是没有处理的消息立即可见
+func (s *subscriber) release(messages []*BrokerMessage) {
+	for _, msg := range messages {
+		if err := s.b.requeue(context.Background(), msg, 0); err != nil {
+			s.logger.Error("sql broker release message error", zap.Int64("id", msg.ID), zap.Error(err))
+		}
+	}
+}
+
+// retryDelay 使用 Retry 选项时重新入队的延迟
+func retryDelay(attempted int) time.Duration {
+	return min(time.Duration(attempted)*time.Second, time.Minute)
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	s.cancel()
+	s.done.Wait()
+	return nil
+}
+
+// Drain 停止取出消息，等待正在处理的消息完成并确认
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.cancel()
+	return broker.Wait(ctx, &s.done)
+}
@@ -0,0 +1,285 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/utils/validator"
+	"github.com/gin-gonic/gin/binding"
+)
+
+var (
+	// ErrInvalidMessage 消息无法解码或者没有通过校验
+	ErrInvalidMessage = errors.New("broker: invalid message")
+	// ErrIncompatibleVersion 消息的版本不在topic支持的范围内
+	ErrIncompatibleVersion = errors.New("broker: incompatible schema version")
+)
+
+// 重新导出消息头，方便使用
+const (
+	HeaderContentType   = broker2.HeaderContentType
+	HeaderSchemaVersion = broker2.HeaderSchemaVersion
+)
+
+type TopicOption func(*TopicOptions)
+
+type TopicOptions struct {
+	Codec       broker2.Codec
+	Version     int
+	MinVersion  int
+	Description string
+}
+
+// WithCodec 设置消息体的编码，默认为 broker2.JSONCodec
+func WithCodec(codec broker2.Codec) TopicOption {
+	return func(options *TopicOptions) {
+		options.Codec = codec
+	}
+}
+
+// WithVersion 设置消息结构的版本，发布时写入消息头，默认为1
+func WithVersion(version int) TopicOption {
+	return func(options *TopicOptions) {
+		options.Version = version
+	}
+}
+
+// WithMinVersion 设置可以消费的最小版本，默认为1
+// 消费时会拒绝低于最小版本或者高于当前版本的消息
+func WithMinVersion(version int) TopicOption {
+	return func(options *TopicOptions) {
+		options.MinVersion = version
+	}
+}
+
+// WithDescription 设置topic的描述，用于生成文档
+func WithDescription(description string) TopicOption {
+	return func(options *TopicOptions) {
+		options.Description = description
+	}
+}
+
+// Topic 类型化的topic，约定了消息的结构、编码与版本
+// 一般定义为包级变量，例如：
+//
+//	var OrderCreated = broker.NewTopic[*OrderCreatedMsg]("order.created", broker.WithVersion(2))
+//
+// 消费时会按 `binding` tag 校验消息，如果消息实现了 Validate() error 也会调用
+type Topic[T any] struct {
+	name    string
+	options TopicOptions
+	info    *TopicInfo
+}
+
+// NewTopic 创建类型化的topic并注册到 Topics，同名的topic重复注册会panic
+func NewTopic[T any](name string, opts ...TopicOption) *Topic[T] {
+	options := TopicOptions{
+		Codec:      broker2.JSONCodec,
+		Version:    1,
+		MinVersion: 1,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.MinVersion > options.Version {
+		panic(fmt.Sprintf("broker: topic %q min version %d greater than version %d",
+			name, options.MinVersion, options.Version))
+	}
+	t := &Topic[T]{
+		name:    name,
+		options: options,
+		info: &TopicInfo{
+			Name:        name,
+			Type:        reflect.TypeFor[T](),
+			Codec:       options.Codec.Name(),
+			Version:     options.Version,
+			MinVersion:  options.MinVersion,
+			Description: options.Description,
+		},
+	}
+	registerTopic(t.info)
+	return t
+}
+
+// Name topic名称
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Encode 将消息编码为 broker2.Message，会设置编码与版本的消息头
+func (t *Topic[T]) Encode(msg T) (*broker2.Message, error) {
+	body, err := t.options.Codec.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &broker2.Message{
+		Header: map[string]string{
+			HeaderContentType:   t.options.Codec.Name(),
+			HeaderSchemaVersion: strconv.Itoa(t.options.Version),
+		},
+		Body: body,
+	}, nil
+}
+
+// Decode 解码并校验消息
+func (t *Topic[T]) Decode(data *broker2.Message) (T, error) {
+	var ret T
+	if ct, ok := data.Header[HeaderContentType]; ok && ct != t.options.Codec.Name() {
+		return ret, fmt.Errorf("%w: topic %s content type %q, expected %q",
+			ErrInvalidMessage, t.name, ct, t.options.Codec.Name())
+	}
+	version := 1
+	if v, ok := data.Header[HeaderSchemaVersion]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return ret, fmt.Errorf("%w: topic %s schema version %q", ErrInvalidMessage, t.name, v)
+		}
+		version = n
+	}
+	if version < t.options.MinVersion || version > t.options.Version {
+		return ret, fmt.Errorf("%w: topic %s version %d, supported %d~%d",
+			ErrIncompatibleVersion, t.name, version, t.options.MinVersion, t.options.Version)
+	}
+	if err := t.options.Codec.Unmarshal(data.Body, &ret); err != nil {
+		return ret, fmt.Errorf("%w: topic %s: %v", ErrInvalidMessage, t.name, err)
+	}
+	if err := validate(ret); err != nil {
+		return ret, fmt.Errorf("%w: topic %s: %w", ErrInvalidMessage, t.name, err)
+	}
+	return ret, nil
+}
+
+// Publish 使用默认的broker发布消息
+func (t *Topic[T]) Publish(ctx context.Context, msg T, opts ...broker2.PublishOption) error {
+	return t.PublishTo(ctx, Default(), msg, opts...)
+}
+
+// PublishTo 使用指定的broker发布消息
+func (t *Topic[T]) PublishTo(ctx context.Context, b broker2.Broker, msg T, opts ...broker2.PublishOption) error {
+	data, err := t.Encode(msg)
+	if err != nil {
+		return err
+	}
+	return b.Publish(ctx, t.name, data, opts...)
+}
+
+// Subscribe 使用默认的broker订阅消息，消息无法解码或者没有通过校验时返回 ErrInvalidMessage
+// 这类错误重试也不会成功，建议配合 broker2.WithRetryPolicy 使用，超过次数后进入死信队列
+func (t *Topic[T]) Subscribe(ctx context.Context, h func(ctx context.Context, msg T, event broker2.Event) error,
+	opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	return t.SubscribeTo(ctx, Default(), h, opts...)
+}
+
+// SubscribeTo 使用指定的broker订阅消息
+func (t *Topic[T]) SubscribeTo(ctx context.Context, b broker2.Broker, h func(ctx context.Context, msg T, event broker2.Event) error,
+	opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	sub, err := b.Subscribe(ctx, t.name, func(ctx context.Context, event broker2.Event) error {
+		msg, err := t.Decode(event.Message())
+		if err != nil {
+			return err
+		}
+		return h(ctx, msg, event)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	options := broker2.NewSubscribeOptions(opts...)
+	registerConsumer(t.info, ConsumerInfo{
+		Group:   options.Group,
+		Handler: funcName(h),
+	})
+	return sub, nil
+}
+
+type validatable interface {
+	Validate() error
+}
+
+var structValidator = sync.OnceValues(func() (binding.StructValidator, error) {
+	return validator.NewValidator()
+})
+
+func validate(msg any) error {
+	v, err := structValidator()
+	if err != nil {
+		return err
+	}
+	if err := v.ValidateStruct(msg); err != nil {
+		return err
+	}
+	if m, ok := msg.(validatable); ok {
+		return m.Validate()
+	}
+	return nil
+}
+
+func funcName(f any) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
+}
+
+// TopicInfo 类型化topic的信息，用于生成文档
+type TopicInfo struct {
+	Name        string
+	Type        reflect.Type
+	Codec       string
+	Version     int
+	MinVersion  int
+	Description string
+	// Consumers 通过 Topic.Subscribe 订阅的消费者
+	Consumers []ConsumerInfo
+}
+
+// ConsumerInfo 消费者信息
+type ConsumerInfo struct {
+	// Group 消费组，为空时使用broker的默认消费组
+	Group string
+	// Handler 处理函数的名称
+	Handler string
+}
+
+var topics = struct {
+	sync.Mutex
+	m map[string]*TopicInfo
+}{m: make(map[string]*TopicInfo)}
+
+func registerTopic(info *TopicInfo) {
+	topics.Lock()
+	defer topics.Unlock()
+	if _, ok := topics.m[info.Name]; ok {
+		panic(fmt.Sprintf("broker: topic %q already registered", info.Name))
+	}
+	topics.m[info.Name] = info
+}
+
+func registerConsumer(info *TopicInfo, consumer ConsumerInfo) {
+	topics.Lock()
+	defer topics.Unlock()
+	info.Consumers = append(info.Consumers, consumer)
+}
+
+// Topics 获取所有注册的类型化topic，按名称排序
+func Topics() []TopicInfo {
+	topics.Lock()
+	defer topics.Unlock()
+	ret := make([]TopicInfo, 0, len(topics.m))
+	for _, info := range topics.m {
+		t := *info
+		t.Consumers = append([]ConsumerInfo(nil), info.Consumers...)
+		ret = append(ret, t)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
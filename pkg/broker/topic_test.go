@@ -0,0 +1,105 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type orderMsg struct {
+	ID    int64  `json:"id" binding:"required"`
+	Title string `json:"title"`
+}
+
+func (o *orderMsg) Validate() error {
+	if o.Title == "invalid" {
+		return errors.New("invalid title")
+	}
+	return nil
+}
+
+func handleOrder(ctx context.Context, msg *orderMsg, event broker2.Event) error {
+	return nil
+}
+
+func TestTopic(t *testing.T) {
+	ctx := context.Background()
+	b := newSyncBroker()
+	topic := NewTopic[*orderMsg]("test.order", WithVersion(2), WithDescription("订单"))
+
+	var received *orderMsg
+	_, err := topic.SubscribeTo(ctx, b, func(ctx context.Context, msg *orderMsg, event broker2.Event) error {
+		received = msg
+		return nil
+	}, broker2.Group("group"))
+	require.NoError(t, err)
+	require.NoError(t, topic.PublishTo(ctx, b, &orderMsg{ID: 1, Title: "hello"}))
+	assert.Equal(t, &orderMsg{ID: 1, Title: "hello"}, received)
+	data := b.published["test.order"][0]
+	assert.Equal(t, "json", data.Header[HeaderContentType])
+	assert.Equal(t, "2", data.Header[HeaderSchemaVersion])
+
+	// 校验失败
+	err = topic.PublishTo(ctx, b, &orderMsg{Title: "hello"})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+	err = topic.PublishTo(ctx, b, &orderMsg{ID: 1, Title: "invalid"})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+	// 没有消息头时认为是版本1
+	_, err = topic.Decode(&broker2.Message{Body: []byte(`{"id":1}`)})
+	assert.NoError(t, err)
+	_, err = topic.Decode(&broker2.Message{Header: map[string]string{HeaderSchemaVersion: "3"}, Body: []byte(`{"id":1}`)})
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	_, err = topic.Decode(&broker2.Message{Header: map[string]string{HeaderContentType: "protobuf"}, Body: []byte(`{"id":1}`)})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+
+	v2 := NewTopic[orderMsg]("test.order.v2", WithVersion(2), WithMinVersion(2))
+	_, err = v2.Decode(&broker2.Message{Body: []byte(`{"id":1}`)})
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+	assert.Panics(t, func() {
+		NewTopic[orderMsg]("test.order.v2")
+	})
+}
+
+func TestTopic_Protobuf(t *testing.T) {
+	ctx := context.Background()
+	b := newSyncBroker()
+	topic := NewTopic[*wrapperspb.StringValue]("test.proto", WithCodec(broker2.ProtobufCodec))
+
+	var received string
+	_, err := topic.SubscribeTo(ctx, b, func(ctx context.Context, msg *wrapperspb.StringValue, event broker2.Event) error {
+		received = msg.GetValue()
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, topic.PublishTo(ctx, b, wrapperspb.String("hello")))
+	assert.Equal(t, "hello", received)
+	assert.Equal(t, "protobuf", b.published["test.proto"][0].Header[HeaderContentType])
+}
+
+func TestTopics(t *testing.T) {
+	ctx := context.Background()
+	b := newSyncBroker()
+	topic := NewTopic[*orderMsg]("test.registry", WithDescription("注册"))
+	_, err := topic.SubscribeTo(ctx, b, handleOrder, broker2.Group("group"))
+	require.NoError(t, err)
+
+	var info *TopicInfo
+	for _, v := range Topics() {
+		if v.Name == "test.registry" {
+			info = &v
+		}
+	}
+	require.NotNil(t, info)
+	assert.Equal(t, "*broker.orderMsg", info.Type.String())
+	assert.Equal(t, "json", info.Codec)
+	assert.Equal(t, 1, info.Version)
+	assert.Equal(t, "注册", info.Description)
+	require.Len(t, info.Consumers, 1)
+	assert.Equal(t, "group", info.Consumers[0].Group)
+	assert.Equal(t, "github.com/cago-frame/cago/pkg/broker.handleOrder", info.Consumers[0].Handler)
+}
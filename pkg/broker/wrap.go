@@ -2,43 +2,377 @@ package broker
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	broker2 "github.com/cago-frame/cago/pkg/broker/broker"
+	"github.com/cago-frame/cago/pkg/logger"
 	wrap2 "github.com/cago-frame/cago/pkg/utils/wrap"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
+// ErrBatchUnsupportedOption 批量订阅不支持重试策略与去重
+var ErrBatchUnsupportedOption = errors.New("broker: SubscribeBatch does not support RetryPolicy or Deduplicator")
+
+// defaultDrainTimeout 关闭时排空订阅者的默认超时时间，小于应用停止时等待组件关闭的10秒，给其它组件留出时间
+const defaultDrainTimeout = 5 * time.Second
+
 type wrap struct {
 	broker2.Broker
 	wrap    *wrap2.Wrap
 	options *Options
+	publish PublishInvoker
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
 }
 
 // newWrap 包装原有broker
 func newWrap(broker broker2.Broker, w *wrap2.Wrap, options *Options) broker2.Broker {
-	return &wrap{Broker: broker, wrap: w, options: options}
+	ret := &wrap{Broker: broker, wrap: w, options: options, subscribers: make(map[*subscriber]struct{})}
+	ret.publish = chainPublish(options.publishInterceptors, ret.invoke)
+	return ret
 }
 
 func (t *wrap) Publish(ctx context.Context, topic string, data *broker2.Message, opts ...broker2.PublishOption) error {
+	return t.publish(ctx, topic, stampMessage(data), opts...)
+}
+
+// stampMessage 复制消息后设置消息ID，调用方没有设置消息ID时生成新的ID
+// 拦截器与链路追踪只会修改复制的消息头，同一条消息重复发布时不会沿用上次生成的ID
+func stampMessage(msg *broker2.Message) *broker2.Message {
+	header := make(map[string]string, len(msg.Header)+1)
+	maps.Copy(header, msg.Header)
+	if header[broker2.HeaderMessageID] == "" {
+		header[broker2.HeaderMessageID] = uuid.NewString()
+	}
+	return &broker2.Message{Header: header, Body: msg.Body}
+}
+
+// invoke 执行完拦截器后发布消息
+func (t *wrap) invoke(ctx context.Context, topic string, data *broker2.Message, opts ...broker2.PublishOption) error {
 	if t.options.topicPrefix != "" {
 		topic = t.options.topicPrefix + "." + topic
 	}
 	return t.wrap.Run(ctx, "Publish", []interface{}{topic, data}, func(ctx *wrap2.Context) {
+		options := broker2.NewPublishOptions(opts...)
+		// 在注入链路信息之后设置，traceparent 才能写入事件
+		if options.CloudEvents != nil {
+			encoded, err := broker2.EncodeCloudEvent(data, options.CloudEvents, time.Now())
+			if err != nil {
+				ctx.Abort(err)
+				return
+			}
+			data = encoded
+		}
+		if t.options.scheduler != nil {
+			if d := options.Delay(); d > 0 && !supportDelay(t.Broker, d) {
+				ctx.Abort(t.options.scheduler.Schedule(ctx, topic, data, options.DeliverAt))
+				return
+			}
+		}
 		ctx.Abort(t.Broker.Publish(ctx, topic, data, opts...))
 	})
 }
 
+// PublishBatch 每条消息分别执行发布拦截器后批量发布
+// 拦截器修改了topic或者发布选项时分组发布：topic相同且没有修改发布选项的连续消息为一组，
+// 修改了发布选项的消息使用自己的选项单独为一组；各组依次发布，不是原子操作，
+// 某一组发布失败时返回错误，之前的组已经发布的消息不会撤回
+func (t *wrap) PublishBatch(ctx context.Context, topic string, data []*broker2.Message, opts ...broker2.PublishOption) error {
+	type group struct {
+		topic string
+		data  []*broker2.Message
+		opts  []broker2.PublishOption
+		// origin 使用的是调用方传入的发布选项
+		origin bool
+	}
+	groups := make([]*group, 0, 1)
+	collect := chainPublish(t.options.publishInterceptors, func(ctx context.Context, topic string,
+		data *broker2.Message, msgOpts ...broker2.PublishOption) error {
+		origin := samePublishOptions(msgOpts, opts)
+		if n := len(groups); n > 0 && origin && groups[n-1].origin && groups[n-1].topic == topic {
+			groups[n-1].data = append(groups[n-1].data, data)
+			return nil
+		}
+		// 拦截器可能复用了同一个底层数组追加选项，需要复制
+		groups = append(groups, &group{topic: topic, data: []*broker2.Message{data},
+			opts: slices.Clone(msgOpts), origin: origin})
+		return nil
+	})
+	for _, msg := range data {
+		if err := collect(ctx, topic, stampMessage(msg), opts...); err != nil {
+			return err
+		}
+	}
+	for _, g := range groups {
+		if err := t.invokeBatch(ctx, g.topic, g.data, g.opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// samePublishOptions 拦截器传给下一步的发布选项是否就是调用方传入的选项
+// 发布选项是函数无法比较，只判断是否为同一个切片
+func samePublishOptions(a, b []broker2.PublishOption) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+func (t *wrap) invokeBatch(ctx context.Context, topic string, data []*broker2.Message, opts ...broker2.PublishOption) error {
+	if t.options.topicPrefix != "" {
+		topic = t.options.topicPrefix + "." + topic
+	}
+	return t.wrap.Run(ctx, "PublishBatch", []interface{}{topic, data}, func(ctx *wrap2.Context) {
+		options := broker2.NewPublishOptions(opts...)
+		if options.CloudEvents != nil {
+			now := time.Now()
+			encoded := make([]*broker2.Message, len(data))
+			for i, msg := range data {
+				var err error
+				if encoded[i], err = broker2.EncodeCloudEvent(msg, options.CloudEvents, now); err != nil {
+					ctx.Abort(err)
+					return
+				}
+			}
+			data = encoded
+		}
+		if t.options.scheduler != nil {
+			if d := options.Delay(); d > 0 && !supportDelay(t.Broker, d) {
+				for _, msg := range data {
+					if err := t.options.scheduler.Schedule(ctx, topic, msg, options.DeliverAt); err != nil {
+						ctx.Abort(err)
+						return
+					}
+				}
+				return
+			}
+		}
+		ctx.Abort(broker2.PublishBatch(ctx, t.Broker, topic, data, opts...))
+	})
+}
+
+func supportDelay(b broker2.Broker, d time.Duration) bool {
+	if p, ok := b.(broker2.DelayPublisher); ok {
+		return p.SupportDelay(d)
+	}
+	return false
+}
+
+// Close 先排空所有的订阅者，再停止调度器，最后关闭broker
+func (t *wrap) Close() error {
+	timeout := t.options.drainTimeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := t.Drain(ctx)
+	if t.options.scheduler != nil {
+		_ = t.options.scheduler.Close()
+	}
+	return errors.Join(err, t.Broker.Close())
+}
+
+// Drain 同时排空所有还没有取消的订阅者，并记录每个订阅者的结果
+// 请求者接收回复的订阅也会一起排空，等待回复的请求返回 ErrRequesterClosed
+func (t *wrap) Drain(ctx context.Context) error {
+	removeRequester(t)
+	t.mu.Lock()
+	subs := make([]*subscriber, 0, len(t.subscribers))
+	for sub := range t.subscribers {
+		subs = append(subs, sub)
+	}
+	clear(t.subscribers)
+	t.mu.Unlock()
+	errs := make([]error, len(subs))
+	wg := sync.WaitGroup{}
+	for i, sub := range subs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := sub.Subscriber.Drain(ctx)
+			fields := []zap.Field{
+				zap.String("topic", sub.Topic()), zap.String("group", sub.group),
+				zap.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				logger.Ctx(ctx).Error("broker drain subscriber error", append(fields, zap.Error(err))...)
+				errs[i] = fmt.Errorf("broker: drain %s: %w", sub.Topic(), err)
+				return
+			}
+			logger.Ctx(ctx).Info("broker subscriber drained", fields...)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// subscriber 记录订阅者，关闭broker时排空
+type subscriber struct {
+	broker2.Subscriber
+	w     *wrap
+	group string
+}
+
+func (t *wrap) track(sub broker2.Subscriber, group string) broker2.Subscriber {
+	if sub == nil {
+		return nil
+	}
+	ret := &subscriber{Subscriber: sub, w: t, group: group}
+	t.mu.Lock()
+	t.subscribers[ret] = struct{}{}
+	t.mu.Unlock()
+	return ret
+}
+
+func (s *subscriber) remove() {
+	s.w.mu.Lock()
+	delete(s.w.subscribers, s)
+	s.w.mu.Unlock()
+}
+
+func (s *subscriber) Unsubscribe() error {
+	s.remove()
+	return s.Subscriber.Unsubscribe()
+}
+
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.remove()
+	return s.Subscriber.Drain(ctx)
+}
+
 func (t *wrap) Subscribe(ctx context.Context, topic string,
 	h broker2.Handler, opts ...broker2.SubscribeOption) (sub broker2.Subscriber, err error) {
 	options := broker2.NewSubscribeOptions(opts...)
+	originTopic := topic
 	if t.options.topicPrefix != "" {
 		topic = t.options.topicPrefix + "." + topic
 	}
 	if t.options.defaultGroup != "" && options.Group == "" {
 		opts = append(opts, broker2.Group(t.options.defaultGroup))
+		options.Group = t.options.defaultGroup
 	}
-	return t.Broker.Subscribe(ctx, topic, func(ctx context.Context, event broker2.Event) error {
+	if options.Deduplicator != nil {
+		h = t.deduplicate(h, options)
+	}
+	handler := h
+	if options.RetryPolicy != nil {
+		handler = func(ctx context.Context, event broker2.Event) error {
+			return t.retry(ctx, originTopic, event, h, options)
+		}
+	}
+	handler = chainSubscribe(t.options.subscribeInterceptors,
+		&SubscribeInfo{Topic: originTopic, Options: options}, handler)
+	sub, err = t.Broker.Subscribe(ctx, topic, func(ctx context.Context, event broker2.Event) error {
+		// 在提取链路信息之前转换，结构化模式的 traceparent 才能生效
+		// 转换失败的消息重试也不会成功，与批量订阅一致记录日志后确认，不交给处理函数
+		if options.CloudEvents {
+			if err := broker2.DecodeCloudEvent(event.Message()); err != nil {
+				dropCloudEvent(ctx, event, err)
+				return nil
+			}
+		}
+		if t.options.metrics != nil {
+			event = t.options.metrics.event(event, topic, options.Group)
+		}
 		return t.wrap.Run(ctx, "Subscribe", []interface{}{topic, event, options}, func(ctx *wrap2.Context) {
-			ctx.Abort(h(ctx, event))
+			ctx.Abort(handler(ctx, event))
 		})
 	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return t.track(sub, options.Group), nil
+}
+
+// SubscribeBatch 批量订阅，broker不支持时逐条订阅凑批
+// 消费拦截器、重试策略与去重对批量订阅不生效，设置了 RetryPolicy 或 Deduplicator 时返回错误
+func (t *wrap) SubscribeBatch(ctx context.Context, topic string,
+	h broker2.BatchHandler, opts ...broker2.SubscribeOption) (broker2.Subscriber, error) {
+	options := broker2.NewSubscribeOptions(opts...)
+	if options.RetryPolicy != nil || options.Deduplicator != nil {
+		return nil, ErrBatchUnsupportedOption
+	}
+	if t.options.topicPrefix != "" {
+		topic = t.options.topicPrefix + "." + topic
+	}
+	if t.options.defaultGroup != "" && options.Group == "" {
+		opts = append(opts, broker2.Group(t.options.defaultGroup))
+		options.Group = t.options.defaultGroup
+	}
+	sub, err := broker2.SubscribeBatch(ctx, t.Broker, topic, func(ctx context.Context, events []broker2.Event) error {
+		if options.CloudEvents {
+			events = decodeCloudEvents(ctx, events)
+			if len(events) == 0 {
+				return nil
+			}
+		}
+		if t.options.metrics != nil {
+			wrapped := make([]broker2.Event, 0, len(events))
+			for _, event := range events {
+				wrapped = append(wrapped, t.options.metrics.event(event, topic, options.Group))
+			}
+			events = wrapped
+		}
+		return t.wrap.Run(ctx, "SubscribeBatch", []interface{}{topic, events, options}, func(ctx *wrap2.Context) {
+			ctx.Abort(h(ctx, events))
+		})
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return t.track(sub, options.Group), nil
+}
+
+// decodeCloudEvents 逐条转换 CloudEvents 消息，转换失败的消息记录日志并确认后不交给处理函数，
+// 不会让整批消息失败
+func decodeCloudEvents(ctx context.Context, events []broker2.Event) []broker2.Event {
+	ret := make([]broker2.Event, 0, len(events))
+	for _, event := range events {
+		if err := broker2.DecodeCloudEvent(event.Message()); err != nil {
+			dropCloudEvent(ctx, event, err)
+			continue
+		}
+		ret = append(ret, event)
+	}
+	return ret
+}
+
+// dropCloudEvent 丢弃无法转换的 CloudEvents 消息，重试也无法转换，直接确认避免一直重新投递
+func dropCloudEvent(ctx context.Context, event broker2.Event, err error) {
+	logger.Ctx(ctx).Error("broker drop invalid cloud event", zap.String("topic", event.Topic()),
+		zap.String("message_id", broker2.MessageID(event.Message())), zap.Error(err))
+	if err := event.Ack(); err != nil {
+		logger.Ctx(ctx).Error("broker ack invalid cloud event error", zap.String("topic", event.Topic()), zap.Error(err))
+	}
+}
+
+// deduplicate 跳过消费组已经处理过的消息，没有消息ID时直接处理
+func (t *wrap) deduplicate(h broker2.Handler, options broker2.SubscribeOptions) broker2.Handler {
+	return func(ctx context.Context, event broker2.Event) error {
+		id := broker2.MessageID(event.Message())
+		if id == "" {
+			return h(ctx, event)
+		}
+		duplicate, err := options.Deduplicator.Do(ctx, options.Group, id, func(ctx context.Context) error {
+			return h(ctx, event)
+		})
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			logger.Ctx(ctx).Info("broker skip duplicate message", zap.String("message_id", id))
+			if !options.AutoAck {
+				return event.Ack()
+			}
+		}
+		return nil
+	}
 }
@@ -74,9 +74,14 @@ func Database() cago.Component {
 	return db.Database()
 }
 
-// Broker 消息队列组件
-func Broker() cago.FuncComponent {
-	return broker.Broker
+// Broker 消息队列组件，可以传入选项注册拦截器等，应用停止时在后台排空订阅者
+func Broker(opts ...broker.Option) cago.FuncComponent {
+	return broker.BrokerWith(opts...)
+}
+
+// BrokerComponent 消息队列组件，应用停止时先排空订阅者再关闭之前注册的组件
+func BrokerComponent(opts ...broker.Option) cago.Component {
+	return broker.Component(opts...)
 }
 
 // Mongo mongodb组件
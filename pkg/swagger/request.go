@@ -286,6 +286,8 @@ func (s *Swagger) parseRoute(filename string, file *ast.File, decl *ast.GenDecl,
 				},
 			},
 		}}
+		// 解析路由中间件标签
+		s.parseMetaTags(operation, tag)
 
 		// 添加tag
 		base := path.Base(filename)
@@ -316,3 +318,60 @@ func (s *Swagger) parseRoute(filename string, file *ast.File, decl *ast.GenDecl,
 	}
 	return nil
 }
+
+// metaTag 路由Meta上已知的中间件标签
+type metaTag struct {
+	description string
+	// status 中间件拒绝请求时的状态码
+	status int
+}
+
+var metaTags = map[string]metaTag{
+	"auth":    {description: "认证", status: http.StatusUnauthorized},
+	"perm":    {description: "权限", status: http.StatusForbidden},
+	"limit":   {description: "限流", status: http.StatusTooManyRequests},
+	"timeout": {description: "超时"},
+}
+
+// routeTags 已经由swagger解析的路由标签，不作为中间件标签
+var routeTags = map[string]struct{}{
+	"path":        {},
+	"method":      {},
+	"contentType": {},
+}
+
+// parseMetaTags 将路由Meta上的标签写入 x-<tag> 扩展字段与描述
+// 包括通过 mux.RegisterMetaTag 注册的自定义标签，已知的中间件标签还会添加可能返回的错误响应
+func (s *Swagger) parseMetaTags(operation *spec.Operation, tag string) {
+	var desc []string
+	for _, kv := range utils.ParseTags(tag) {
+		name, value := kv[0], kv[1]
+		if _, ok := routeTags[name]; ok {
+			continue
+		}
+		operation.AddExtension("x-"+name, value)
+		v, ok := metaTags[name]
+		if !ok {
+			desc = append(desc, name+": "+value)
+			continue
+		}
+		desc = append(desc, v.description+": "+value)
+		// 可选认证不会拒绝请求
+		if v.status == 0 || (name == "auth" && value == "optional") {
+			continue
+		}
+		operation.Responses.StatusCodeResponses[v.status] = spec.Response{
+			ResponseProps: spec.ResponseProps{
+				Description: http.StatusText(v.status),
+				Schema: &spec.Schema{
+					SchemaProps: spec.SchemaProps{
+						Ref: spec.MustCreateRef("#/definitions/BadRequest"),
+					},
+				},
+			},
+		}
+	}
+	if len(desc) > 0 {
+		operation.Description = strings.TrimSpace(operation.Description + "\n\n" + strings.Join(desc, "\n\n"))
+	}
+}
@@ -1,6 +1,7 @@
 package swagger
 
 import (
+	"net/http"
 	"path"
 	"testing"
 
@@ -23,6 +24,26 @@ func TestSwagger_gen(t *testing.T) {
 	err := s.gen()
 	assert.Nil(t, err)
 	paths := s.swagger.Paths.Paths
-	assert.Equalf(t, 1, len(paths), "swagger path")
+	assert.Equalf(t, 2, len(paths), "swagger path")
 	//assert.Equal(t, "application/json", paths["/test/{uid}"].Get.Consumes[0])
 }
+
+func TestSwagger_metaTags(t *testing.T) {
+	s := NewSwagger(TestPath)
+	err := s.gen()
+	assert.Nil(t, err)
+	get := s.swagger.Paths.Paths["/script/{id}"].Get
+	assert.Equal(t, "required", get.Extensions["x-auth"])
+	assert.Equal(t, "script:read", get.Extensions["x-perm"])
+	assert.Equal(t, "10/60s", get.Extensions["x-limit"])
+	assert.Equal(t, "3s", get.Extensions["x-timeout"])
+	assert.Contains(t, get.Description, "权限: script:read")
+	// 自定义标签也会写入扩展字段
+	assert.Equal(t, "script", get.Extensions["x-audit"])
+	assert.Contains(t, get.Description, "audit: script")
+	assert.NotContains(t, get.Extensions, "x-path")
+	assert.NotContains(t, get.Extensions, "x-method")
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests} {
+		assert.Contains(t, get.Responses.StatusCodeResponses, status)
+	}
+}
@@ -10,6 +10,12 @@ type Item struct {
 	ID int64 `json:"id"`
 }
 
+// ScriptRequest 获取脚本详情
+type ScriptRequest struct {
+	mux.Meta `path:"/script/:id" method:"GET" auth:"required" perm:"script:read" limit:"10/60s" timeout:"3s" audit:"script"`
+	ID       int64 `uri:"id"`
+}
+
 // ListRequest 获取脚本列表
 type ListRequest struct {
 	mux.Meta              `path:"/script" method:"GET"`
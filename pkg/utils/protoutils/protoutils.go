@@ -0,0 +1,39 @@
+package protoutils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotMessage 值没有实现 proto.Message
+var ErrNotMessage = errors.New("value is not a proto.Message")
+
+// Marshal 序列化 proto.Message
+func Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNotMessage, v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal 反序列化到 proto.Message，也支持传入指向 proto.Message 指针的指针，指针为nil时会创建
+func Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		elem := rv.Elem()
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		if m, ok := elem.Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+	return fmt.Errorf("%w: %T", ErrNotMessage, v)
+}
@@ -0,0 +1,26 @@
+package protoutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnmarshal(t *testing.T) {
+	data, err := Marshal(wrapperspb.String("hello"))
+	require.NoError(t, err)
+	_, err = Marshal(1)
+	assert.ErrorIs(t, err, ErrNotMessage)
+
+	msg := &wrapperspb.StringValue{}
+	require.NoError(t, Unmarshal(data, msg))
+	assert.Equal(t, "hello", msg.GetValue())
+	// 指向nil指针的指针
+	var ptr *wrapperspb.StringValue
+	require.NoError(t, Unmarshal(data, &ptr))
+	assert.Equal(t, "hello", ptr.GetValue())
+	var i int
+	assert.ErrorIs(t, Unmarshal(data, &i), ErrNotMessage)
+}
@@ -2,6 +2,7 @@ package testutils
 
 import (
 	"context"
+	"os"
 	"testing"
 
 	"github.com/cago-frame/cago/pkg/logger"
@@ -10,6 +11,7 @@ import (
 
 func TestMain(m *testing.M) {
 	RunTestEnv()
+	os.Exit(m.Run())
 }
 
 func TestComponent(t *testing.T) {
@@ -0,0 +1,133 @@
+package testutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cago-frame/cago/database/db"
+	_ "github.com/cago-frame/cago/database/db/sqlite"
+	"github.com/ghodss/yaml"
+	"gorm.io/gorm"
+)
+
+var sqliteSeq int64
+
+// sqliteDSN 第n个测试内存数据库的连接串，共享缓存模式下同名的连接看到的是同一个数据库
+func sqliteDSN(n int64) string {
+	return fmt.Sprintf("file:cago_test_%d?mode=memory&cache=shared", n)
+}
+
+// SQLiteDatabase 创建基于 SQLite 内存数据库的测试环境
+// 每次调用都会创建一个独立的内存数据库，并自动迁移传入的模型
+// 返回的 context 中注入的是一个事务，测试结束时会自动回滚并关闭数据库，业务代码通过 db.Ctx(ctx) 自动使用该事务
+//
+//	ctx, tx := testutils.SQLiteDatabase(t, &user_entity.User{})
+//	testutils.LoadFixtures(t, ctx, "testdata/user.yaml")
+func SQLiteDatabase(t *testing.T, models ...interface{}) (context.Context, *gorm.DB) {
+	t.Helper()
+	// 每个内存数据库只有一个连接，否则不同连接之间看到的是不同的数据库
+	gormDB, err := db.Open(&db.Config{
+		Driver: db.SQLite,
+		Dsn:    sqliteDSN(atomic.AddInt64(&sqliteSeq, 1)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	if len(models) > 0 {
+		if err := gormDB.AutoMigrate(models...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx := gormDB.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	// Cleanup 后进先出，会在关闭数据库之前回滚
+	t.Cleanup(func() { tx.Rollback() })
+	ctx := db.WithContextDB(context.Background(), tx)
+	return ctx, tx
+}
+
+// LoadFixtures 将 YAML/JSON 格式的数据文件写入 context 中的数据库
+// 文件的顶层是表名，值是该表的数据行，例如：
+//
+//	user:
+//	  - id: 1
+//	    username: admin
+func LoadFixtures(t *testing.T, ctx context.Context, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		tables, err := readFixture(file)
+		if err != nil {
+			t.Fatalf("load fixture %s: %v", file, err)
+		}
+		names := make([]string, 0, len(tables))
+		for name := range tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, row := range tables[name] {
+				if err := db.Ctx(ctx).Table(name).Create(row).Error; err != nil {
+					t.Fatalf("load fixture %s: table %s: %v", file, name, err)
+				}
+			}
+		}
+	}
+}
+
+func readFixture(file string) (map[string][]map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// JSON 是 YAML 的子集，统一转换为 JSON 处理
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	tables := make(map[string][]map[string]interface{})
+	if err := decoder.Decode(&tables); err != nil {
+		return nil, err
+	}
+	for _, rows := range tables {
+		for _, row := range rows {
+			for k, v := range row {
+				row[k] = fixtureValue(v)
+			}
+		}
+	}
+	return tables, nil
+}
+
+func fixtureValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		// 嵌套的结构以 JSON 字符串的形式存储
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return v
+}
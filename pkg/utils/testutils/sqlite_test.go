@@ -0,0 +1,52 @@
+package testutils
+
+import (
+	"database/sql"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cago-frame/cago/database/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type FixtureUser struct {
+	ID       int64  `gorm:"primaryKey"`
+	Username string `gorm:"column:username"`
+}
+
+func TestSQLiteDatabase(t *testing.T) {
+	t.Run("fixtures", func(t *testing.T) {
+		ctx, _ := SQLiteDatabase(t, &FixtureUser{})
+		LoadFixtures(t, ctx, "testdata/user.yaml", "testdata/user.json")
+
+		user := &FixtureUser{}
+		assert.NoError(t, db.Ctx(ctx).First(user, 1).Error)
+		assert.Equal(t, "admin", user.Username)
+		var count int64
+		assert.NoError(t, db.Ctx(ctx).Model(&FixtureUser{}).Count(&count).Error)
+		assert.Equal(t, int64(3), count)
+	})
+	// 内存数据库在最后一个连接关闭后就会销毁，保持一个连接来检查测试结束后的数据
+	outer := t
+	var dsn string
+	t.Run("write", func(t *testing.T) {
+		ctx, _ := SQLiteDatabase(t, &FixtureUser{})
+		dsn = sqliteDSN(atomic.LoadInt64(&sqliteSeq))
+		conn, err := sql.Open("sqlite", dsn)
+		require.NoError(t, err)
+		require.NoError(t, conn.Ping())
+		// 在父测试结束时才关闭，确保子测试回滚后数据库仍然存在
+		outer.Cleanup(func() { _ = conn.Close() })
+		assert.NoError(t, db.Ctx(ctx).Create(&FixtureUser{Username: "new"}).Error)
+	})
+	t.Run("rollback", func(t *testing.T) {
+		require.NotEmpty(t, dsn)
+		conn, err := sql.Open("sqlite", dsn)
+		require.NoError(t, err)
+		defer conn.Close()
+		var count int64
+		require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM fixture_user").Scan(&count))
+		assert.Equal(t, int64(0), count)
+	})
+}
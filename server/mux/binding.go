@@ -4,12 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"reflect"
-	"strconv"
 
-	"github.com/cago-frame/cago/pkg/utils"
 	"github.com/cago-frame/cago/pkg/utils/httputils"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -17,11 +17,17 @@ import (
 )
 
 type bind struct {
-	ctx *gin.Context
+	ctx  *gin.Context
+	plan *bindPlan
 }
 
+// ShouldBindWith 绑定请求参数
+// json 请求体先解码到结构体，然后按照 uri、header、form 标签的顺序从请求中取值覆盖，
+// form 在 GET、DELETE 请求中为 query 参数，在表单请求中为表单字段；
+// 没有标签的结构体字段会继续绑定其中的字段，值无法转换时返回参数对应的400错误
 func ShouldBindWith(c *gin.Context, obj any) error {
-	return c.ShouldBindWith(obj, &bind{ctx: c})
+	b := bind{ctx: c}
+	return b.Bind(c.Request, obj)
 }
 
 func (b *bind) Name() string {
@@ -33,109 +39,114 @@ type Validate interface {
 	Validate(ctx context.Context) error
 }
 
+// Converter 把请求中的字符串转换为自定义类型的值
+type Converter func(value string) (any, error)
+
+var converters = map[reflect.Type]Converter{
+	reflect.TypeOf(primitive.ObjectID{}): func(value string) (any, error) {
+		return primitive.ObjectIDFromHex(value)
+	},
+}
+
+// RegisterConverter 注册自定义类型的转换函数，重复注册会覆盖
+// 需要在绑定路由与处理请求之前注册(例如在 init 中)，绑定计划在绑定路由或者第一次绑定时编译，之后注册的转换函数不会生效
+// typ 为该类型的零值，例如 mux.RegisterConverter(decimal.Decimal{}, ...)，
+// 转换函数的优先级高于 encoding.TextUnmarshaler
+func RegisterConverter(typ any, f Converter) {
+	converters[reflect.TypeOf(typ)] = f
+}
+
 func (b *bind) Bind(req *http.Request, ptr any) error {
 	if err := b.bind(req, ptr); err != nil {
 		return err
 	}
-	return binding.Validator.ValidateStruct(ptr)
+	if err := binding.Validator.ValidateStruct(ptr); err != nil {
+		return err
+	}
+	// 绑定与校验之后执行自定义校验
+	if v, ok := ptr.(Validate); ok {
+		if err := v.Validate(b.ctx); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (b *bind) bind(req *http.Request, ptr any) error {
-	// 根据tag绑定数据
-	if v, ok := ptr.(Validate); ok {
-		if err := v.Validate(b.ctx); err != nil {
+	val := reflect.ValueOf(ptr)
+	if val.Kind() != reflect.Pointer || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("mux: bind target must be a pointer to struct, got %T", ptr)
+	}
+	plan := b.plan
+	if plan == nil {
+		var err error
+		if plan, err = planOf(val.Type().Elem()); err != nil {
 			return err
 		}
 	}
-	// Check if ptr is a map
-	ptrVal := reflect.ValueOf(ptr)
-	ptrElem := ptrVal.Elem()
-	ptrType := ptrElem.Type()
-	var form func(key string) []string
+	src := &bindSource{ctx: b.ctx}
 	if req.Method == http.MethodGet ||
 		req.Method == http.MethodDelete {
-		form = b.ctx.QueryArray
+		src.form = formQuery
 	} else {
 		switch b.ctx.ContentType() {
 		case binding.MIMEJSON:
 			if req.Body == nil {
-				return httputils.NewInternalServerError(-1, "json body is nil")
+				return httputils.NewBadRequestError(-1, "请求体不能为空")
 			}
-			decoder := json.NewDecoder(req.Body)
-			if err := decoder.Decode(ptr); err != nil {
-				if !errors.Is(err, io.EOF) {
-					return httputils.NewInternalServerError(-1, err.Error())
-				}
+			if err := json.NewDecoder(req.Body).Decode(ptr); err != nil && !errors.Is(err, io.EOF) {
+				return jsonError(err)
 			}
-		case binding.MIMEMultipartPOSTForm, binding.MIMEPOSTForm:
-			form = b.ctx.PostFormArray
+		case binding.MIMEMultipartPOSTForm:
+			src.form = formMultipart
+		case binding.MIMEPOSTForm:
+			src.form = formPost
 		}
 	}
-	for i := 0; i < ptrElem.NumField(); i++ {
-		tag := ptrType.Field(i).Tag
-		if tag == "" {
-			continue
-		}
-		fieldElem := ptrElem.Field(i)
-		if key := tag.Get("form"); key != "" {
-			if key == "-" {
-				continue
-			}
-			if key == ",inline" {
-				if err := b.bind(req, fieldElem.Addr().Interface()); err != nil {
-					return err
-				}
-			} else {
-				// 处理key,label的情况,例如: key,default=1
-				key, opts := utils.Head(key, ",")
-				opts, val := utils.Head(opts, "=")
-				if opts == "default" && fieldElem.IsZero() && (form == nil || len(form(key)) == 0) {
-					setValue(fieldElem, tag, []string{val})
-				} else if form != nil {
-					setValue(fieldElem, tag, form(key))
-				}
-			}
-		} else if uri := tag.Get("uri"); uri != "" {
-			setValue(ptrElem.Field(i), tag, []string{b.ctx.Param(uri)})
-		} else if header := tag.Get("header"); header != "" {
-			setValue(ptrElem.Field(i), tag, []string{b.ctx.GetHeader(header)})
-		}
+	return plan.bind(val.Elem(), src)
+}
+
+// formKind form 标签取值的来源
+type formKind int
+
+const (
+	formNone formKind = iota
+	formQuery
+	formPost
+	formMultipart
+)
+
+// bindSource 请求参数的来源
+type bindSource struct {
+	ctx  *gin.Context
+	form formKind
+}
+
+func (s *bindSource) values(key string) []string {
+	switch s.form {
+	case formQuery:
+		return s.ctx.QueryArray(key)
+	case formPost, formMultipart:
+		return s.ctx.PostFormArray(key)
 	}
 	return nil
 }
 
-// 设置值,暂时只支持基础类型
-func setValue(field reflect.Value, tag reflect.StructTag, value []string) {
-	if len(value) == 0 {
-		return
+func (s *bindSource) files(key string) []*multipart.FileHeader {
+	if s.form != formMultipart {
+		return nil
 	}
-	switch field.Kind() {
-	case reflect.String:
-		field.SetString(value[0])
-	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
-		i, _ := strconv.ParseInt(value[0], 10, 64)
-		field.SetInt(i)
-	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
-		i, _ := strconv.ParseUint(value[0], 10, 64)
-		field.SetUint(i)
-	case reflect.Float32, reflect.Float64:
-		i, _ := strconv.ParseFloat(value[0], 64)
-		field.SetFloat(i)
-	case reflect.Bool:
-		i, _ := strconv.ParseBool(value[0])
-		field.SetBool(i)
-	case reflect.Slice:
-		if field.Type() == reflect.TypeOf([]string{}) {
-			field.Set(reflect.ValueOf(value))
-		}
-	case reflect.Map:
-		// JSON解析
-		_ = json.Unmarshal([]byte(value[0]), field.Addr().Interface())
-	default:
-		if field.Type() == reflect.TypeOf(primitive.ObjectID{}) {
-			if id, err := primitive.ObjectIDFromHex(value[0]); err == nil {
-				field.Set(reflect.ValueOf(id))
-			}
-		}
+	if f, err := s.ctx.MultipartForm(); err == nil {
+		return f.File[key]
+	}
+	return nil
+}
+
+// jsonError 把json解码的错误转换为400错误
+func jsonError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return httputils.NewBadRequestError(-1, fmt.Sprintf("参数 %s 格式错误", typeErr.Field))
 	}
+	return httputils.NewBadRequestError(-1, "请求体不是有效的json: "+err.Error())
 }
@@ -0,0 +1,274 @@
+package mux
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/utils"
+	"github.com/cago-frame/cago/pkg/utils/httputils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type benchRequest struct {
+	Meta        `path:"/bench/:id" method:"GET,POST"`
+	bindingPage `form:",inline"`
+	ID          int64     `uri:"id"`
+	Token       string    `header:"X-Token"`
+	Name        string    `form:"name" json:"name"`
+	Age         *int      `form:"age" json:"age"`
+	IDs         []int     `form:"ids" json:"ids"`
+	Sort        string    `form:"sort,default=createtime" json:"sort"`
+	Time        time.Time `form:"time" json:"time"`
+}
+
+type benchResponse struct {
+	ID int64 `json:"id"`
+}
+
+func benchEngine() *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	r := &Router{Routes: &Routes{IRoutes: engine}, IRouter: engine}
+	r.Bind(func(ctx context.Context, req *benchRequest) (*benchResponse, error) {
+		return &benchResponse{ID: req.ID}, nil
+	})
+	return engine
+}
+
+// BenchmarkBind 只绑定请求参数，与没有绑定计划时每次反射解析结构体的绑定对比
+func BenchmarkBind(b *testing.B) {
+	query := url.Values{
+		"name": {"cago"}, "age": {"18"}, "ids": {"1", "2", "3"}, "page": {"2"},
+		"time": {"2026-01-02T03:04:05Z"},
+	}.Encode()
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	c := gin.CreateTestContextOnly(httptest.NewRecorder(), engine)
+	c.Params = gin.Params{{Key: "id", Value: "10"}}
+	req := httptest.NewRequest(http.MethodGet, "/bench/10?"+query, nil)
+	req.Header.Set("X-Token", "token")
+	for _, bench := range []struct {
+		name string
+		bind func(c *gin.Context, ptr any) error
+	}{
+		{"plan", ShouldBindWith},
+		{"legacy", legacyBindWith},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.Request = req
+				c.Keys = nil
+				r := &benchRequest{}
+				if err := bench.bind(c, r); err != nil {
+					b.Fatal(err)
+				}
+				if r.ID != 10 || r.Name != "cago" || len(r.IDs) != 3 || r.Sort != "createtime" {
+					b.Fatalf("unexpected result: %+v", r)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkHandler 完整的请求处理，包括路由、绑定、调用控制器与返回
+func BenchmarkHandler(b *testing.B) {
+	engine := benchEngine()
+	b.Run("query", func(b *testing.B) {
+		req := httptest.NewRequest(http.MethodGet, "/bench/10?name=cago&age=18&ids=1&ids=2&page=2", nil)
+		req.Header.Set("X-Token", "token")
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Fatal(w.Body.String())
+			}
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		body := `{"name":"cago","age":18,"ids":[1,2,3],"time":"2026-01-02T03:04:05Z"}`
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/bench/10", io.NopCloser(strings.NewReader(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Fatal(w.Body.String())
+			}
+		}
+	})
+}
+
+// legacyBindWith 没有绑定计划之前的绑定实现，每次请求都通过反射解析结构体的标签与类型，只用于基准测试对比
+func legacyBindWith(c *gin.Context, ptr any) error {
+	req := c.Request
+	var form func(key string) []string
+	if req.Method == http.MethodGet || req.Method == http.MethodDelete {
+		form = c.QueryArray
+	} else if c.ContentType() == binding.MIMEJSON {
+		if err := json.NewDecoder(req.Body).Decode(ptr); err != nil && !errors.Is(err, io.EOF) {
+			return jsonError(err)
+		}
+	} else {
+		form = c.PostFormArray
+	}
+	if err := legacyBindStruct(c, reflect.ValueOf(ptr).Elem(), form); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(ptr)
+}
+
+func legacyBindStruct(c *gin.Context, ptrElem reflect.Value, form func(key string) []string) error {
+	ptrType := ptrElem.Type()
+	for i := 0; i < ptrElem.NumField(); i++ {
+		field := ptrType.Field(i)
+		fieldElem := ptrElem.Field(i)
+		if !field.IsExported() {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := legacyBindStruct(c, fieldElem, form); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		tag := field.Tag
+		if uri := tag.Get("uri"); uri != "" {
+			if value, ok := c.Params.Get(uri); ok {
+				if err := legacySetField(fieldElem, tag, uri, []string{value}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if header := tag.Get("header"); header != "" {
+			if err := legacySetField(fieldElem, tag, header, c.Request.Header.Values(header)); err != nil {
+				return err
+			}
+			continue
+		}
+		key := tag.Get("form")
+		switch key {
+		case "-":
+			continue
+		case "", ",inline":
+			typ := field.Type
+			if typ.Kind() == reflect.Struct && (key == ",inline" || !isValueType(typ)) {
+				if err := legacyBindStruct(c, fieldElem, form); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		key, opts := utils.Head(key, ",")
+		opts, val := utils.Head(opts, "=")
+		var value []string
+		if form != nil {
+			value = form(key)
+		}
+		if len(value) == 0 && opts == "default" && fieldElem.IsZero() {
+			value = []string{val}
+		}
+		if err := legacySetField(fieldElem, tag, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func legacySetField(field reflect.Value, tag reflect.StructTag, key string, value []string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	typ := field.Type()
+	switch {
+	case typ.Kind() == reflect.Pointer:
+		v := reflect.New(typ.Elem())
+		if err := legacySetField(v.Elem(), tag, key, value); err != nil {
+			return err
+		}
+		field.Set(v)
+		return nil
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 && !isValueType(typ):
+		slice := reflect.MakeSlice(typ, len(value), len(value))
+		for i, v := range value {
+			if err := legacySetField(slice.Index(i), tag, key, []string{v}); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	if err := legacySetValue(field, tag, value[0]); err != nil {
+		return httputils.NewBadRequestError(-1, fmt.Sprintf("参数 %s 格式错误: %q", key, value[0]))
+	}
+	return nil
+}
+
+func legacySetValue(field reflect.Value, tag reflect.StructTag, value string) error {
+	typ := field.Type()
+	if f, ok := converters[typ]; ok {
+		v, err := f(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if typ == timeType {
+		t, err := compileTime(tag)(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		i, err := strconv.ParseInt(value, 10, typ.Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		i, err := strconv.ParseUint(value, 10, typ.Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, typ.Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/utils/httputils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type money int64
+
+type bindingPage struct {
+	Page int `form:"page,default=1"`
+}
+
+type bindingFilter struct {
+	Tags []string `form:"tag"`
+}
+
+type bindingRequest struct {
+	Meta        `path:"/bind/:id" method:"GET,POST"`
+	bindingPage `form:",inline"`
+	Filter      bindingFilter
+	Optional    *bindingFilter
+	ID          int64              `uri:"id"`
+	Token       string             `header:"X-Token"`
+	Name        string             `form:"name" json:"name"`
+	Age         *int               `form:"age" json:"age"`
+	IDs         []int              `form:"ids"`
+	Time        time.Time          `form:"time"`
+	Date        time.Time          `form:"date" time_format:"2006-01-02" time_utc:"true"`
+	Unix        time.Time          `form:"unix" time_format:"unix"`
+	Timeout     time.Duration      `form:"timeout"`
+	OID         primitive.ObjectID `form:"oid"`
+	Price       money              `form:"price"`
+	Level       bindingLevel       `form:"level"`
+	Extra       map[string]int     `form:"extra"`
+}
+
+type bindingLevel struct {
+	Value string
+}
+
+func (l *bindingLevel) UnmarshalText(text []byte) error {
+	if string(text) == "" {
+		return errors.New("empty level")
+	}
+	l.Value = strings.ToUpper(string(text))
+	return nil
+}
+
+type bindingFileRequest struct {
+	Name  string                  `form:"name"`
+	File  *multipart.FileHeader   `form:"file"`
+	Files []*multipart.FileHeader `form:"files"`
+}
+
+func testBind(t *testing.T, req *http.Request, ptr any) error {
+	var err error
+	engine := gin.New()
+	engine.Handle(req.Method, "/bind/:id", func(c *gin.Context) {
+		err = ShouldBindWith(c, ptr)
+	})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	return err
+}
+
+func init() {
+	// 自定义类型的转换函数，金额转换为分
+	RegisterConverter(money(0), func(value string) (any, error) {
+		f, err := strconv.ParseFloat(value, 64)
+		return money(math.Round(f * 100)), err
+	})
+}
+
+func TestBinding(t *testing.T) {
+	query := url.Values{
+		"name": {"cago"}, "age": {"18"}, "ids": {"1", "2"}, "tag": {"a", "b"},
+		"time": {"2026-01-02T03:04:05Z"}, "date": {"2026-01-02"}, "unix": {"1700000000"},
+		"timeout": {"3s"}, "oid": {"65a0f0f0f0f0f0f0f0f0f0f0"}, "price": {"1.5"},
+		"level": {"info"}, "extra": {`{"a":1}`},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/bind/10?"+query.Encode(), nil)
+	req.Header.Set("X-Token", "token")
+	r := &bindingRequest{}
+	require.NoError(t, testBind(t, req, r))
+	assert.Equal(t, int64(10), r.ID)
+	assert.Equal(t, "token", r.Token)
+	assert.Equal(t, 1, r.Page)
+	assert.Equal(t, "cago", r.Name)
+	assert.Equal(t, 18, *r.Age)
+	assert.Equal(t, []int{1, 2}, r.IDs)
+	assert.Equal(t, []string{"a", "b"}, r.Filter.Tags)
+	assert.Equal(t, []string{"a", "b"}, r.Optional.Tags)
+	assert.Equal(t, 2026, r.Time.Year())
+	assert.Equal(t, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), r.Date)
+	assert.Equal(t, int64(1700000000), r.Unix.Unix())
+	assert.Equal(t, 3*time.Second, r.Timeout)
+	assert.Equal(t, "65a0f0f0f0f0f0f0f0f0f0f0", r.OID.Hex())
+	assert.Equal(t, money(150), r.Price)
+	assert.Equal(t, "INFO", r.Level.Value)
+	assert.Equal(t, map[string]int{"a": 1}, r.Extra)
+
+	// 解析失败时返回字段对应的400错误
+	for key, value := range map[string]string{
+		"age": "a", "ids": "x", "time": "2026", "oid": "1", "level": "", "extra": "{",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/bind/10?"+key+"="+url.QueryEscape(value), nil)
+		err := testBind(t, req, &bindingRequest{})
+		var httpErr *httputils.Error
+		require.ErrorAs(t, err, &httpErr, key)
+		assert.Equal(t, http.StatusBadRequest, httpErr.Status)
+		assert.Contains(t, httpErr.Msg, key)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/bind/abc", nil)
+	assert.ErrorContains(t, testBind(t, req, &bindingRequest{}), "id")
+
+	// json请求体与uri、header合并
+	req = httptest.NewRequest(http.MethodPost, "/bind/11", strings.NewReader(`{"name":"json","age":20}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Token", "token")
+	r = &bindingRequest{}
+	require.NoError(t, testBind(t, req, r))
+	assert.Equal(t, "json", r.Name)
+	assert.Equal(t, 20, *r.Age)
+	assert.Equal(t, int64(11), r.ID)
+	assert.Equal(t, "token", r.Token)
+	assert.Equal(t, 1, r.Page)
+	assert.Nil(t, r.Optional)
+
+	req = httptest.NewRequest(http.MethodPost, "/bind/11", strings.NewReader(`{"age":"a"}`))
+	req.Header.Set("Content-Type", "application/json")
+	err := testBind(t, req, &bindingRequest{})
+	var httpErr *httputils.Error
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusBadRequest, httpErr.Status)
+	assert.Contains(t, httpErr.Msg, "age")
+}
+
+func TestBinding_File(t *testing.T) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	require.NoError(t, w.WriteField("name", "upload"))
+	for _, field := range []string{"file", "files", "files"} {
+		fw, err := w.CreateFormFile(field, field+".txt")
+		require.NoError(t, err)
+		_, _ = fw.Write([]byte(field))
+	}
+	require.NoError(t, w.Close())
+	req := httptest.NewRequest(http.MethodPost, "/bind/1", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	r := &bindingFileRequest{}
+	require.NoError(t, testBind(t, req, r))
+	assert.Equal(t, "upload", r.Name)
+	require.NotNil(t, r.File)
+	assert.Equal(t, "file.txt", r.File.Filename)
+	assert.Len(t, r.Files, 2)
+}
+
+type bindingNode struct {
+	Name   string `form:"name"`
+	Parent *bindingNode
+	Page   *bindingPage
+}
+
+type bindingTree struct {
+	Name  string `form:"name"`
+	Child *bindingLeaf
+}
+
+type bindingLeaf struct {
+	Size int `form:"size"`
+	Tree *bindingTree
+	Next *bindingLeaf
+}
+
+func TestBinding_Cycle(t *testing.T) {
+	// 没有标签的指针字段相互引用时不会无限递归
+	req := httptest.NewRequest(http.MethodGet, "/bind/1?name=tree&size=2", nil)
+	r := &bindingTree{}
+	require.NoError(t, testBind(t, req, r))
+	assert.Equal(t, "tree", r.Name)
+	require.NotNil(t, r.Child)
+	assert.Equal(t, 2, r.Child.Size)
+	assert.Nil(t, r.Child.Tree)
+	assert.Nil(t, r.Child.Next)
+
+	// json中已经存在的递归结构体不会再绑定其中递归的字段
+	req = httptest.NewRequest(http.MethodPost, "/bind/1",
+		strings.NewReader(`{"Name":"json","Child":{"Next":{"Next":{}}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	r = &bindingTree{}
+	require.NoError(t, testBind(t, req, r))
+	assert.Equal(t, "json", r.Name)
+	require.NotNil(t, r.Child.Next)
+	assert.Equal(t, 0, r.Child.Next.Size)
+}
+
+func TestBinding_Plan(t *testing.T) {
+	// 递归引用自身的结构体不会无限绑定
+	req := httptest.NewRequest(http.MethodGet, "/bind/1?name=node", nil)
+	r := &bindingNode{}
+	require.NoError(t, testBind(t, req, r))
+	assert.Equal(t, "node", r.Name)
+	assert.Nil(t, r.Parent)
+	assert.Equal(t, 1, r.Page.Page)
+
+	plan, err := planOf(reflect.TypeOf(bindingNode{}))
+	require.NoError(t, err)
+	cached, err := planOf(reflect.TypeOf(bindingNode{}))
+	require.NoError(t, err)
+	assert.Same(t, plan, cached)
+
+	assert.Error(t, testBind(t, httptest.NewRequest(http.MethodGet, "/bind/1", nil), &map[string]string{}))
+}
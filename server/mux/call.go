@@ -0,0 +1,66 @@
+package mux
+
+import (
+	"context"
+	"reflect"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 常见的控制器方法签名在绑定时转换为直接调用的函数，请求时不再使用 reflect.Value.Call
+// *Req 与 *Resp 都是指针，与 unsafe.Pointer 的调用约定相同，只需要在绑定时校验签名
+type (
+	ctxRespFunc func(ctx context.Context, req unsafe.Pointer) (unsafe.Pointer, error)
+	ctxErrFunc  func(ctx context.Context, req unsafe.Pointer) error
+	ginRespFunc func(ctx unsafe.Pointer, req unsafe.Pointer) (unsafe.Pointer, error)
+	ginErrFunc  func(ctx unsafe.Pointer, req unsafe.Pointer) error
+)
+
+// callFunc 调用控制器方法，返回响应与错误，没有响应时为nil
+type callFunc func(c *gin.Context, req reflect.Value) (any, error)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// compileCall 为函数类型的控制器编译调用函数，不是常见的签名时返回nil，使用反射调用
+func compileCall(method reflect.Value, request reflect.Type, ginContext bool) callFunc {
+	t := method.Type()
+	if t.NumIn() != 2 || t.In(1) != reflect.PointerTo(request) {
+		return nil
+	}
+	fn := method.Interface()
+	switch {
+	case t.NumOut() == 1 && t.Out(0) == errorType:
+		if ginContext {
+			f := funcOf[ginErrFunc](fn)
+			return func(c *gin.Context, req reflect.Value) (any, error) {
+				return nil, f(unsafe.Pointer(c), req.UnsafePointer())
+			}
+		}
+		f := funcOf[ctxErrFunc](fn)
+		return func(c *gin.Context, req reflect.Value) (any, error) {
+			return nil, f(c.Request.Context(), req.UnsafePointer())
+		}
+	case t.NumOut() == 2 && t.Out(0).Kind() == reflect.Pointer && t.Out(1) == errorType:
+		resp := t.Out(0).Elem()
+		if ginContext {
+			f := funcOf[ginRespFunc](fn)
+			return func(c *gin.Context, req reflect.Value) (any, error) {
+				p, err := f(unsafe.Pointer(c), req.UnsafePointer())
+				return reflect.NewAt(resp, p).Interface(), err
+			}
+		}
+		f := funcOf[ctxRespFunc](fn)
+		return func(c *gin.Context, req reflect.Value) (any, error) {
+			p, err := f(c.Request.Context(), req.UnsafePointer())
+			return reflect.NewAt(resp, p).Interface(), err
+		}
+	}
+	return nil
+}
+
+// funcOf 把函数转换为参数与返回值形状相同的函数类型，函数在接口中直接保存函数值
+func funcOf[F any](fn any) F {
+	data := (*[2]unsafe.Pointer)(unsafe.Pointer(&fn))[1]
+	return *(*F)(unsafe.Pointer(&data))
+}
@@ -0,0 +1,111 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetaTagFunc 根据Meta字段上标签的值生成路由中间件
+// 返回错误时绑定路由会panic，返回nil表示不需要中间件
+type MetaTagFunc func(value string) (gin.HandlerFunc, error)
+
+var metaTags = map[string]MetaTagFunc{
+	"timeout": timeoutTag,
+	// 以下标签需要由对应的组件注册，没有注册时绑定会失败，避免路由在没有鉴权的情况下暴露
+	"auth":  unregisteredTag("auth"),
+	"perm":  unregisteredTag("perm"),
+	"limit": unregisteredTag("limit"),
+}
+
+// RegisterMetaTag 注册Meta字段的标签，需要在绑定路由之前注册，重复注册会覆盖
+// 绑定时按照标签在Meta上出现的顺序生成中间件，并放在处理函数之前，例如：
+//
+//	mux.RegisterMetaTag("auth", metatags.Auth(authn.Default(), nil))
+//	type UpdateRequest struct {
+//		mux.Meta `path:"/user" method:"PUT" auth:"required" perm:"user:write" limit:"10/60s" timeout:"3s"`
+//	}
+//
+// 内置了 timeout 标签，值为 time.ParseDuration 支持的格式，会设置请求上下文的超时时间
+// auth、perm、limit 标签的实现在 metatags 包中
+func RegisterMetaTag(name string, f MetaTagFunc) {
+	metaTags[name] = f
+}
+
+func unregisteredTag(name string) MetaTagFunc {
+	return func(value string) (gin.HandlerFunc, error) {
+		return nil, fmt.Errorf("mux: meta tag %q is not registered, call mux.RegisterMetaTag first", name)
+	}
+}
+
+func timeoutTag(value string) (gin.HandlerFunc, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("mux: invalid timeout %q", value)
+	}
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}, nil
+}
+
+// metaMiddleware 根据Meta字段上注册过的标签生成中间件
+func metaMiddleware(tag reflect.StructTag) ([]gin.HandlerFunc, error) {
+	var handlers []gin.HandlerFunc
+	for _, kv := range parseTag(tag) {
+		f, ok := metaTags[kv[0]]
+		if !ok {
+			continue
+		}
+		h, err := f(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			handlers = append(handlers, h)
+		}
+	}
+	return handlers, nil
+}
+
+// parseTag 按照出现的顺序解析结构体标签，格式与 reflect.StructTag 一致
+func parseTag(tag reflect.StructTag) [][2]string {
+	var ret [][2]string
+	s := string(tag)
+	for s != "" {
+		s = strings.TrimLeft(s, " ")
+		i := 0
+		for i < len(s) && s[i] > ' ' && s[i] != ':' && s[i] != '"' && s[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(s) || s[i] != ':' || s[i+1] != '"' {
+			break
+		}
+		name := s[:i]
+		s = s[i+1:]
+		i = 1
+		for i < len(s) && s[i] != '"' {
+			if s[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		value, err := strconv.Unquote(s[:i+1])
+		if err != nil {
+			break
+		}
+		s = s[i+1:]
+		ret = append(ret, [2]string{name, value})
+	}
+	return ret
+}
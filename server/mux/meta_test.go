@@ -0,0 +1,67 @@
+package mux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type metaRequest struct {
+	Meta `path:"/meta" method:"GET" second:"2" first:"1" timeout:"3s"`
+}
+
+type unregisteredRequest struct {
+	Meta `path:"/perm" method:"GET" perm:"user:write"`
+}
+
+func TestMetaTag(t *testing.T) {
+	var order []string
+	tag := func(value string) (gin.HandlerFunc, error) {
+		return func(c *gin.Context) {
+			order = append(order, value)
+		}, nil
+	}
+	RegisterMetaTag("first", tag)
+	RegisterMetaTag("second", tag)
+	defer func() {
+		delete(metaTags, "first")
+		delete(metaTags, "second")
+	}()
+
+	engine := gin.New()
+	r := &Router{Routes: &Routes{IRoutes: engine}, IRouter: engine}
+	var hasDeadline bool
+	r.Bind(func(ctx context.Context, req *metaRequest) error {
+		_, hasDeadline = ctx.Deadline()
+		return nil
+	})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/meta", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	// 按照标签出现的顺序执行
+	assert.Equal(t, []string{"2", "1"}, order)
+	assert.True(t, hasDeadline)
+
+	// 没有注册的鉴权标签不能绑定
+	assert.Panics(t, func() {
+		r.Bind(func(ctx context.Context, req *unregisteredRequest) error {
+			return nil
+		})
+	})
+	_, err := timeoutTag("3")
+	assert.Error(t, err)
+}
+
+func TestParseTag(t *testing.T) {
+	tags := parseTag(`path:"/a,/b" method:"GET" limit:"10/60s" desc:"a \"b\""`)
+	require.Len(t, tags, 4)
+	assert.Equal(t, [2]string{"path", "/a,/b"}, tags[0])
+	assert.Equal(t, [2]string{"limit", "10/60s"}, tags[2])
+	assert.Equal(t, "a \"b\"", tags[3][1])
+	assert.Empty(t, parseTag(`   `))
+}
@@ -0,0 +1,105 @@
+// Package metatags 路由Meta上 auth、perm、limit 标签的实现，组件包不需要依赖 mux
+//
+//	mux.RegisterMetaTag("auth", metatags.Auth(authn.Default(), nil))
+//	mux.RegisterMetaTag("perm", metatags.Perm(p, subject))
+//	mux.RegisterMetaTag("limit", metatags.Limit(redis.Default(), "limit:route"))
+package metatags
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cago-frame/cago/middleware/permission"
+	"github.com/cago-frame/cago/pkg/iam/authn"
+	"github.com/cago-frame/cago/pkg/limit"
+	"github.com/cago-frame/cago/pkg/utils/httputils"
+	"github.com/cago-frame/cago/server/mux"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrForbidden perm 标签检查不通过时返回的错误
+var ErrForbidden = httputils.NewForbiddenError(-1, "没有权限")
+
+// SubjectFunc 获取请求的访问者
+type SubjectFunc func(ctx *gin.Context) (string, error)
+
+// Auth auth 标签，值为 required 时强制要求认证，为 optional 时可选认证
+func Auth(a *authn.Authn, middleware authn.Middleware) mux.MetaTagFunc {
+	return func(value string) (gin.HandlerFunc, error) {
+		switch value {
+		case "required":
+			return a.Middleware(true, middleware), nil
+		case "optional":
+			return a.Middleware(false, middleware), nil
+		}
+		return nil, fmt.Errorf("metatags: invalid auth tag %q, must be required or optional", value)
+	}
+}
+
+// Perm perm 标签，值为 "资源:操作"，例如 perm:"user:write"，需要放在 auth 标签之后
+func Perm(p *permission.Permission, subject SubjectFunc, opts ...permission.CheckOption) mux.MetaTagFunc {
+	return func(value string) (gin.HandlerFunc, error) {
+		resource, action, ok := strings.Cut(value, ":")
+		if !ok || resource == "" || action == "" {
+			return nil, fmt.Errorf("metatags: invalid perm tag %q, must be resource:action", value)
+		}
+		return func(ctx *gin.Context) {
+			sub, err := subject(ctx)
+			if err != nil {
+				httputils.HandleResp(ctx, err)
+				return
+			}
+			err = p.Check(ctx.Request.Context(), &permission.Request{
+				Subject:  sub,
+				Resource: resource,
+				Action:   action,
+			}, opts...)
+			if err != nil {
+				if errors.Is(err, permission.ErrPermissionDenied) {
+					err = ErrForbidden
+				}
+				httputils.HandleResp(ctx, err)
+				return
+			}
+		}, nil
+	}
+}
+
+// Limit limit 标签，值为 "次数/周期"，例如 limit:"10/60s" 表示每个ip每60秒最多请求10次
+// 周期的单位为秒，每个路由单独计数
+func Limit(limitStore *redis.Client, keyPrefix string) mux.MetaTagFunc {
+	return func(value string) (gin.HandlerFunc, error) {
+		quota, period, err := parseLimit(value)
+		if err != nil {
+			return nil, err
+		}
+		l := limit.NewPeriodLimit(period, quota, limitStore, keyPrefix)
+		return func(ctx *gin.Context) {
+			key := ctx.Request.Method + ":" + ctx.FullPath() + ":" + ctx.ClientIP()
+			if _, err := l.Take(ctx.Request.Context(), key); err != nil {
+				httputils.HandleResp(ctx, err)
+				return
+			}
+		}, nil
+	}
+}
+
+func parseLimit(value string) (int64, int64, error) {
+	q, p, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("metatags: invalid limit tag %q, must be quota/period", value)
+	}
+	quota, err := strconv.ParseInt(q, 10, 64)
+	if err != nil || quota <= 0 {
+		return 0, 0, fmt.Errorf("metatags: invalid limit tag %q, quota must be positive", value)
+	}
+	period, err := time.ParseDuration(p)
+	if err != nil || period < time.Second || period%time.Second != 0 {
+		return 0, 0, fmt.Errorf("metatags: invalid limit tag %q, period must be whole seconds", value)
+	}
+	return quota, int64(period / time.Second), nil
+}
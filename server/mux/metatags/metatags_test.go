@@ -0,0 +1,57 @@
+package metatags
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cago-frame/cago/middleware/permission"
+	"github.com/cago-frame/cago/middleware/permission/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerm(t *testing.T) {
+	ctx := context.Background()
+	memStorage := storage.NewMemory()
+	p := permission.NewPermission(memStorage)
+	_ = memStorage.AddPolicy(ctx, &permission.Policy{
+		Subject:  "user1",
+		Resource: "user",
+		Actions:  []string{"read"},
+		Effect:   permission.Allow,
+	})
+	tag := Perm(p, func(ctx *gin.Context) (string, error) {
+		return ctx.GetHeader("X-User"), nil
+	})
+	_, err := tag("user")
+	assert.Error(t, err)
+
+	r := gin.New()
+	for _, v := range []string{"read", "write"} {
+		h, err := tag("user:" + v)
+		assert.Nil(t, err)
+		r.GET("/"+v, h, func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+	}
+	for path, status := range map[string]int{"/read": http.StatusOK, "/write": http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User", "user1")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, path)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	quota, period, err := parseLimit("10/60s")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), quota)
+	assert.Equal(t, int64(60), period)
+	for _, value := range []string{"10", "0/60s", "10/1500ms", "10/x"} {
+		_, err := Limit(nil, "limit:route")(value)
+		assert.Error(t, err, value)
+	}
+}
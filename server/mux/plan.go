@@ -0,0 +1,448 @@
+package mux
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cago-frame/cago/pkg/utils"
+	"github.com/cago-frame/cago/pkg/utils/httputils"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	fileHeaderType = reflect.TypeOf(&multipart.FileHeader{})
+	unmarshalType  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	// plans 已经编译的绑定计划，key为请求结构体的类型
+	plans sync.Map
+)
+
+// bindPlan 请求结构体的绑定计划
+// 字段的标签、默认值与类型转换在第一次使用时编译，之后的请求不再解析
+type bindPlan struct {
+	fields []fieldPlan
+}
+
+// fieldSource 字段取值的来源
+type fieldSource int
+
+const (
+	sourceNested fieldSource = iota
+	sourceURI
+	sourceHeader
+	sourceForm
+	sourceFile
+	sourceFiles
+)
+
+type fieldPlan struct {
+	index  int
+	source fieldSource
+	key    string
+	// def 默认值，仅在 hasDefault 为 true 时有效
+	def        string
+	hasDefault bool
+	// one 与 many 只有一个不为nil
+	one  setOne
+	many setMany
+	// nested 继续绑定的结构体，ptr 为指针结构体的元素类型
+	nested *bindPlan
+	ptr    reflect.Type
+}
+
+// setOne 把请求中的一个值设置到字段
+type setOne func(field reflect.Value, value string) error
+
+// setMany 把请求中的多个值设置到切片字段，value 至少有一个元素
+type setMany func(field reflect.Value, value []string) error
+
+// valueError 值无法转换为字段的类型
+type valueError struct {
+	value string
+}
+
+func (e *valueError) Error() string {
+	return fmt.Sprintf("invalid value %q", e.value)
+}
+
+// planOf 获取类型的绑定计划，没有时编译并缓存
+func planOf(typ reflect.Type) (*bindPlan, error) {
+	if plan, ok := plans.Load(typ); ok {
+		return plan.(*bindPlan), nil
+	}
+	plan, err := compilePlan(typ, make(map[reflect.Type]*bindPlan))
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := plans.LoadOrStore(typ, plan)
+	return actual.(*bindPlan), nil
+}
+
+func compilePlan(typ reflect.Type, compiling map[reflect.Type]*bindPlan) (*bindPlan, error) {
+	plan := &bindPlan{}
+	compiling[typ] = plan
+	defer delete(compiling, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fp := fieldPlan{index: i}
+		if !field.IsExported() {
+			// 非导出的内嵌结构体仍然可以绑定其中导出的字段
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := compileNested(&fp, field.Type, true, compiling); err != nil {
+					return nil, err
+				}
+				if fp.nested != nil {
+					plan.fields = append(plan.fields, fp)
+				}
+			}
+			continue
+		}
+		tag := field.Tag
+		if uri := tag.Get("uri"); uri != "" {
+			fp.source, fp.key = sourceURI, uri
+		} else if header := tag.Get("header"); header != "" {
+			fp.source, fp.key = sourceHeader, header
+		} else {
+			key := tag.Get("form")
+			switch key {
+			case "-":
+				continue
+			case "", ",inline":
+				// 内嵌或者没有标签的结构体，继续绑定其中的字段
+				if err := compileNested(&fp, field.Type, key == ",inline", compiling); err != nil {
+					return nil, err
+				}
+				if fp.nested != nil {
+					plan.fields = append(plan.fields, fp)
+				}
+				continue
+			}
+			// 处理key,label的情况,例如: key,default=1
+			key, opts := utils.Head(key, ",")
+			opts, val := utils.Head(opts, "=")
+			fp.source, fp.key = sourceForm, key
+			fp.def, fp.hasDefault = val, opts == "default"
+			switch field.Type {
+			case fileHeaderType:
+				fp.source = sourceFile
+			case reflect.SliceOf(fileHeaderType):
+				fp.source = sourceFiles
+			}
+		}
+		fp.one, fp.many = compileSetter(field.Type, tag)
+		plan.fields = append(plan.fields, fp)
+	}
+	return plan, nil
+}
+
+// compileNested 编译结构体字段中的字段，不需要绑定时 fp.nested 为nil
+func compileNested(fp *fieldPlan, typ reflect.Type, inline bool, compiling map[reflect.Type]*bindPlan) error {
+	var ptr reflect.Type
+	if typ.Kind() == reflect.Pointer {
+		ptr = typ.Elem()
+		typ = ptr
+	}
+	// 作为值转换的结构体不再继续绑定
+	if typ.Kind() != reflect.Struct || (!inline && isValueType(typ)) {
+		return nil
+	}
+	if _, ok := compiling[typ]; ok {
+		// 递归引用自身的指针不会自动创建，避免无限递归；非指针的结构体不会出现递归
+		return nil
+	}
+	plan, err := compilePlan(typ, compiling)
+	if err != nil {
+		return err
+	}
+	if len(plan.fields) == 0 {
+		return nil
+	}
+	fp.source, fp.nested, fp.ptr = sourceNested, plan, ptr
+	return nil
+}
+
+// isValueType 类型是否可以直接从字符串转换
+func isValueType(typ reflect.Type) bool {
+	if _, ok := converters[typ]; ok {
+		return true
+	}
+	return typ == timeType || reflect.PointerTo(typ).Implements(unmarshalType)
+}
+
+// compileSetter 根据字段类型生成设置函数，切片类型返回 many，其它类型返回 one
+func compileSetter(typ reflect.Type, tag reflect.StructTag) (setOne, setMany) {
+	switch {
+	case typ.Kind() == reflect.Pointer:
+		elem := typ.Elem()
+		one, many := compileSetter(elem, tag)
+		if many != nil {
+			return nil, func(field reflect.Value, value []string) error {
+				v := reflect.New(elem)
+				if err := many(v.Elem(), value); err != nil {
+					return err
+				}
+				field.Set(v)
+				return nil
+			}
+		}
+		return func(field reflect.Value, value string) error {
+			v := reflect.New(elem)
+			if err := one(v.Elem(), value); err != nil {
+				return err
+			}
+			field.Set(v)
+			return nil
+		}, nil
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8 && !isValueType(typ):
+		one, many := compileSetter(typ.Elem(), tag)
+		return nil, func(field reflect.Value, value []string) error {
+			slice := reflect.MakeSlice(typ, len(value), len(value))
+			for i := range value {
+				var err error
+				if one != nil {
+					err = one(slice.Index(i), value[i])
+				} else {
+					err = many(slice.Index(i), value[i:i+1])
+				}
+				if err != nil {
+					return err
+				}
+			}
+			field.Set(slice)
+			return nil
+		}
+	}
+	set := compileValue(typ, tag)
+	return func(field reflect.Value, value string) error {
+		if err := set(field, value); err != nil {
+			return &valueError{value: value}
+		}
+		return nil
+	}, nil
+}
+
+// compileValue 根据字段类型生成字符串的转换函数
+func compileValue(typ reflect.Type, tag reflect.StructTag) func(field reflect.Value, value string) error {
+	if f, ok := converters[typ]; ok {
+		return func(field reflect.Value, value string) error {
+			v, err := f(value)
+			if err != nil {
+				return err
+			}
+			rv := reflect.ValueOf(v)
+			if !rv.IsValid() || !rv.Type().AssignableTo(typ) {
+				return fmt.Errorf("converter returned %T, want %s", v, typ)
+			}
+			field.Set(rv)
+			return nil
+		}
+	}
+	if typ == timeType {
+		parse := compileTime(tag)
+		return func(field reflect.Value, value string) error {
+			t, err := parse(value)
+			if err != nil {
+				return err
+			}
+			*(field.Addr().Interface().(*time.Time)) = t
+			return nil
+		}
+	}
+	if reflect.PointerTo(typ).Implements(unmarshalType) {
+		return func(field reflect.Value, value string) error {
+			return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		}
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return func(field reflect.Value, value string) error {
+			field.SetString(value)
+			return nil
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		if typ == durationType {
+			return func(field reflect.Value, value string) error {
+				d, err := time.ParseDuration(value)
+				if err != nil {
+					return err
+				}
+				field.SetInt(int64(d))
+				return nil
+			}
+		}
+		bits := typ.Bits()
+		return func(field reflect.Value, value string) error {
+			i, err := strconv.ParseInt(value, 10, bits)
+			if err != nil {
+				return err
+			}
+			field.SetInt(i)
+			return nil
+		}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint:
+		bits := typ.Bits()
+		return func(field reflect.Value, value string) error {
+			i, err := strconv.ParseUint(value, 10, bits)
+			if err != nil {
+				return err
+			}
+			field.SetUint(i)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		bits := typ.Bits()
+		return func(field reflect.Value, value string) error {
+			f, err := strconv.ParseFloat(value, bits)
+			if err != nil {
+				return err
+			}
+			field.SetFloat(f)
+			return nil
+		}
+	case reflect.Bool:
+		return func(field reflect.Value, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			field.SetBool(b)
+			return nil
+		}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return func(field reflect.Value, value string) error {
+				field.SetBytes([]byte(value))
+				return nil
+			}
+		}
+		return unmarshalJSON
+	case reflect.Map, reflect.Struct, reflect.Array:
+		// JSON解析
+		return unmarshalJSON
+	}
+	return func(field reflect.Value, value string) error {
+		return fmt.Errorf("unsupported type %s", typ)
+	}
+}
+
+func unmarshalJSON(field reflect.Value, value string) error {
+	return json.Unmarshal([]byte(value), field.Addr().Interface())
+}
+
+// compileTime 根据 time_format 标签生成时间的解析函数，支持 unix、unixmilli、unixnano，默认为 RFC3339
+// time_utc 为 true 时使用UTC时区，否则使用本地时区
+func compileTime(tag reflect.StructTag) func(value string) (time.Time, error) {
+	format := tag.Get("time_format")
+	switch format {
+	case "unix", "unixmilli", "unixnano":
+		return func(value string) (time.Time, error) {
+			i, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			switch format {
+			case "unix":
+				return time.Unix(i, 0), nil
+			case "unixmilli":
+				return time.UnixMilli(i), nil
+			}
+			return time.Unix(0, i), nil
+		}
+	case "":
+		format = time.RFC3339
+	}
+	loc := time.Local
+	if utc, _ := strconv.ParseBool(tag.Get("time_utc")); utc {
+		loc = time.UTC
+	}
+	return func(value string) (time.Time, error) {
+		return time.ParseInLocation(format, value, loc)
+	}
+}
+
+// bind 按照计划绑定结构体
+func (p *bindPlan) bind(v reflect.Value, src *bindSource) error {
+	for i := range p.fields {
+		fp := &p.fields[i]
+		field := v.Field(fp.index)
+		var (
+			value []string
+			// single 只有一个值时不需要创建切片
+			single string
+			ok     bool
+		)
+		switch fp.source {
+		case sourceNested:
+			if err := fp.bindNested(field, src); err != nil {
+				return err
+			}
+			continue
+		case sourceURI:
+			single, ok = src.ctx.Params.Get(fp.key)
+		case sourceHeader:
+			value = src.ctx.Request.Header.Values(fp.key)
+		case sourceFile, sourceFiles:
+			if fh := src.files(fp.key); len(fh) > 0 {
+				if fp.source == sourceFile {
+					field.Set(reflect.ValueOf(fh[0]))
+				} else {
+					field.Set(reflect.ValueOf(fh))
+				}
+				continue
+			}
+			value = src.values(fp.key)
+		case sourceForm:
+			value = src.values(fp.key)
+			if len(value) == 0 && fp.hasDefault && field.IsZero() {
+				single, ok = fp.def, true
+			}
+		}
+		if !ok {
+			if len(value) == 0 {
+				continue
+			}
+			single = value[0]
+		}
+		var err error
+		if fp.many != nil {
+			if value == nil {
+				value = []string{single}
+			}
+			err = fp.many(field, value)
+		} else {
+			err = fp.one(field, single)
+		}
+		if err != nil {
+			if ve, ok := err.(*valueError); ok {
+				return httputils.NewBadRequestError(-1, fmt.Sprintf("参数 %s 格式错误: %q", fp.key, ve.value))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// bindNested 绑定结构体字段中的字段，指针为nil时只在绑定到值之后才设置
+func (fp *fieldPlan) bindNested(field reflect.Value, src *bindSource) error {
+	if fp.ptr == nil {
+		return fp.nested.bind(field, src)
+	}
+	if !field.IsNil() {
+		return fp.nested.bind(field.Elem(), src)
+	}
+	v := reflect.New(fp.ptr)
+	if err := fp.nested.bind(v.Elem(), src); err != nil {
+		return err
+	}
+	if !v.Elem().IsZero() {
+		field.Set(v)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package mux
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
@@ -78,6 +79,12 @@ func (r *Routes) requestHandle(requestEl reflect.Type, handlers ...gin.HandlerFu
 	if !ok || route.Type != reflect.TypeOf(Meta{}) {
 		panic("invalid method, second parameter must have Meta field")
 	}
+	// Meta上声明的中间件放在处理函数之前
+	middleware, err := metaMiddleware(route.Tag)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", requestEl.Name(), err))
+	}
+	handlers = append(middleware, handlers...)
 	paths := strings.Split(route.Tag.Get("path"), ",")
 	methods := strings.Split(route.Tag.Get("method"), ",")
 	for _, path := range paths {
@@ -117,57 +124,90 @@ func (r *Routes) bindFunc(controller reflect.Value, method reflect.Value, isFunc
 		}
 		ginContext = true
 	}
-	var call func(a reflect.Value, b interface{}) []reflect.Value
-	if !isFunc {
-		call = func(a reflect.Value, b interface{}) []reflect.Value {
-			return method.Call([]reflect.Value{controller, a, reflect.ValueOf(b)})
-		}
-	} else {
-		call = func(a reflect.Value, b interface{}) []reflect.Value {
-			return method.Call([]reflect.Value{a, reflect.ValueOf(b)})
-		}
+	// 绑定时编译请求参数的绑定计划，请求时不再解析结构体
+	plan, err := planOf(request)
+	if err != nil {
+		return err
 	}
-
-	r.requestHandle(request, r.bindHandler(request, call, ginContext))
+	h := &handlerPlan{
+		request:    request,
+		bind:       plan,
+		controller: controller,
+		method:     method,
+		isFunc:     isFunc,
+		ginContext: ginContext,
+		numOut:     methodType.NumOut(),
+	}
+	if isFunc {
+		h.call = compileCall(method, request, ginContext)
+	}
+	r.requestHandle(request, h.handle)
 	return nil
 }
 
-func (r *Routes) bindHandler(request reflect.Type,
-	call func(a reflect.Value, b interface{}) []reflect.Value,
-	ginContext bool) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 创建请求参数
-		req := reflect.New(request)
-		// 绑定请求参数
-		i := req.Interface()
-		if err := ShouldBindWith(c, i); err != nil {
+// handlerPlan 控制器方法的调用计划
+type handlerPlan struct {
+	request    reflect.Type
+	bind       *bindPlan
+	controller reflect.Value
+	method     reflect.Value
+	isFunc     bool
+	ginContext bool
+	numOut     int
+	// call 常见签名的直接调用，为nil时使用反射调用
+	call callFunc
+}
+
+func (h *handlerPlan) handle(c *gin.Context) {
+	// 创建请求参数
+	req := reflect.New(h.request)
+	// 绑定请求参数
+	b := bind{ctx: c, plan: h.bind}
+	if err := b.Bind(c.Request, req.Interface()); err != nil {
+		httputils.HandleResp(c, err)
+		return
+	}
+	if h.call != nil {
+		resp, err := h.call(c, req)
+		switch {
+		case err == nil:
+			if h.numOut == 2 {
+				httputils.HandleResp(c, resp)
+			}
+		case h.numOut == 1:
+			_ = httputils.HandleError(c, err)
+		default:
 			httputils.HandleResp(c, err)
-			return
 		}
-		// 调用控制器方法
-		var ctx reflect.Value
-		if ginContext {
-			ctx = reflect.ValueOf(c)
-		} else {
-			ctx = reflect.ValueOf(c.Request.Context())
+		return
+	}
+	// 调用控制器方法
+	var args [3]reflect.Value
+	in := args[:0]
+	if !h.isFunc {
+		in = append(in, h.controller)
+	}
+	if h.ginContext {
+		in = append(in, reflect.ValueOf(c))
+	} else {
+		in = append(in, reflect.ValueOf(c.Request.Context()))
+	}
+	resp := h.method.Call(append(in, req))
+	switch len(resp) {
+	case 0:
+		return
+	case 1:
+		// 一个参数只能接受error
+		if resp[0].IsNil() {
+			return
 		}
-		resp := call(ctx, req.Interface())
-		switch len(resp) {
-		case 0:
+		_ = httputils.HandleError(c, resp[0].Interface().(error))
+	case 2:
+		// 两个参数，第一个是返回值，第二个是error
+		if resp[1].IsNil() {
+			httputils.HandleResp(c, resp[0].Interface())
 			return
-		case 1:
-			// 一个参数只能接受error
-			if resp[0].IsNil() {
-				return
-			}
-			_ = httputils.HandleError(c, resp[0].Interface().(error))
-		case 2:
-			// 两个参数，第一个是返回值，第二个是error
-			if resp[1].IsNil() {
-				httputils.HandleResp(c, resp[0].Interface())
-				return
-			}
-			httputils.HandleResp(c, resp[1].Interface())
 		}
+		httputils.HandleResp(c, resp[1].Interface())
 	}
 }
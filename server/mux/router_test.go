@@ -1,8 +1,14 @@
 package mux
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 
+	"github.com/cago-frame/cago/pkg/utils/httputils"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,3 +21,59 @@ func TestMetadata(t *testing.T) {
 	assert.Equal(t, "/a", path)
 	assert.Equal(t, "GET", method)
 }
+
+type callRequest struct {
+	Meta `path:"/call" method:"GET"`
+	Name string `form:"name"`
+}
+
+type callResponse struct {
+	Name string `json:"name"`
+}
+
+func TestBind_Call(t *testing.T) {
+	errBad := httputils.NewBadRequestError(-1, "bad")
+	for _, tt := range []struct {
+		name    string
+		handler any
+		typed   bool
+		status  int
+		body    string
+	}{
+		{"ctx resp", func(ctx context.Context, req *callRequest) (*callResponse, error) {
+			return &callResponse{Name: req.Name}, nil
+		}, true, http.StatusOK, `"name":"cago"`},
+		{"ctx error", func(ctx context.Context, req *callRequest) error {
+			return errBad
+		}, true, http.StatusBadRequest, "bad"},
+		{"gin resp", func(ctx *gin.Context, req *callRequest) (*callResponse, error) {
+			return &callResponse{Name: ctx.Query("name")}, nil
+		}, true, http.StatusOK, `"name":"cago"`},
+		{"gin resp error", func(ctx *gin.Context, req *callRequest) (*callResponse, error) {
+			return nil, errBad
+		}, true, http.StatusBadRequest, "bad"},
+		{"gin error", func(ctx *gin.Context, req *callRequest) error {
+			ctx.String(http.StatusOK, req.Name)
+			return nil
+		}, true, http.StatusOK, "cago"},
+		// 响应不是指针时使用反射调用
+		{"reflect", func(ctx context.Context, req *callRequest) ([]string, error) {
+			return []string{req.Name}, nil
+		}, false, http.StatusOK, `["cago"]`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			method := reflect.ValueOf(tt.handler)
+			ginContext := method.Type().In(0) == reflect.TypeOf((*gin.Context)(nil))
+			call := compileCall(method, reflect.TypeOf(callRequest{}), ginContext)
+			assert.Equal(t, tt.typed, call != nil)
+
+			engine := gin.New()
+			r := &Router{Routes: &Routes{IRoutes: engine}, IRouter: engine}
+			r.Bind(tt.handler)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/call?name=cago", nil))
+			assert.Equal(t, tt.status, w.Code)
+			assert.Contains(t, w.Body.String(), tt.body)
+		})
+	}
+}
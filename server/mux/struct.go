@@ -1,5 +1,6 @@
 package mux
 
 // Meta 路由
+// path 与 method 标签定义路由，其它标签通过 RegisterMetaTag 注册后生成路由中间件
 type Meta struct {
 }